@@ -0,0 +1,39 @@
+package DB
+
+// the placeholders ValidCoordinates rejects, as sql
+const missingCoordinates = `((latitude = -1 AND longitude = -1) OR (latitude = -1.1 AND longitude = -1.1)
+	OR (latitude = 1 AND longitude = 1) OR (latitude = 0 AND longitude = 0))`
+
+// UngeocodedVenues returns up to limit venues that still have placeholder coordinates, busiest first
+func (s *Storage) UngeocodedVenues(limit int) ([]Venue, error) {
+	var venues []Venue
+	err := s.Database.Where(missingCoordinates + " AND normalized_address <> ''").
+		Order("event_count DESC, id").Limit(limit).Find(&venues).Error
+	return venues, err
+}
+
+// SetVenueCoordinates stores the coordinates of a venue and of the geo points of its events
+func (s *Storage) SetVenueCoordinates(venueID int, lat, long float64) error {
+	err := s.Database.Model(&Venue{}).Where("id = ?", venueID).
+		Updates(map[string]interface{}{"latitude": lat, "longitude": long, "geocode_failed_at": nil}).Error
+	if err != nil {
+		return err
+	}
+	return s.Database.Exec("UPDATE geo_points SET latitude = ?, longitude = ? WHERE event_id IN (SELECT id FROM events WHERE venue_id = ?)",
+		lat, long, venueID).Error
+}
+
+// UngeocodedGeoPoints returns up to limit geo points of events without a venue that still have placeholder
+// coordinates but an address to look up
+func (s *Storage) UngeocodedGeoPoints(limit int) ([]GeoPoint, error) {
+	var points []GeoPoint
+	err := s.Database.Where(missingCoordinates + " AND (canonical <> '' OR address <> '')").
+		Where("event_id NOT IN (SELECT id FROM events WHERE venue_id <> 0)").
+		Order("id").Limit(limit).Find(&points).Error
+	return points, err
+}
+
+func (s *Storage) SetGeoPointCoordinates(id int, lat, long float64) error {
+	return s.Database.Model(&GeoPoint{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"latitude": lat, "longitude": long}).Error
+}
@@ -0,0 +1,214 @@
+package DB
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+/*
+The same event gets listed more than once: an organizer posts it twice, or it shows up on the results
+page of several cities under different urls. The dedup pass clusters events that start at the same
+time, have nearly the same title and are (when we know where they are) close to each other. The best
+listing of each cluster stays canonical and the rest point at it through duplicate_of
+*/
+
+const (
+	duplicateTitleSimilarity = 0.8
+	duplicateRadiusKm        = 1.0
+	// without coordinates to compare we want the titles to be all but identical
+	duplicateTitleNoGeo = 0.95
+)
+
+type DedupReport struct {
+	Clusters   int `json:"clusters"`
+	Duplicates int `json:"duplicates"`
+}
+
+type dedupCandidate struct {
+	ID          int       `gorm:"column:id"`
+	Title       string    `gorm:"column:title"`
+	Host        string    `gorm:"column:host"`
+	Description string    `gorm:"column:description"`
+	StartsAt    time.Time `gorm:"column:starts_at"`
+	DuplicateOf int       `gorm:"column:duplicate_of"`
+	Latitude    *float64  `gorm:"column:latitude"`
+	Longitude   *float64  `gorm:"column:longitude"`
+
+	normalized string
+}
+
+func (c *dedupCandidate) hasCoordinates() bool {
+	return c.Latitude != nil && c.Longitude != nil && ValidCoordinates(*c.Latitude, *c.Longitude)
+}
+
+// Deduplicate runs the dedup pass over every event with a known start time
+func (s *Storage) Deduplicate() (DedupReport, error) {
+	var candidates []dedupCandidate
+	err := s.Database.Raw(`SELECT events.id, events.title, events.host, events.description, events.starts_at, events.duplicate_of,
+			geo_points.latitude, geo_points.longitude
+		FROM events LEFT JOIN geo_points ON geo_points.event_id = events.id
+		WHERE events.starts_at IS NOT NULL
+		GROUP BY events.id
+		ORDER BY events.starts_at, events.id`).Scan(&candidates).Error
+	if err != nil {
+		return DedupReport{}, err
+	}
+
+	var report DedupReport
+	changed := false
+	// only events starting at the exact same time can be duplicates, so work one start time at a time
+	for start := 0; start < len(candidates); {
+		end := start + 1
+		for end < len(candidates) && candidates[end].StartsAt.Equal(candidates[start].StartsAt) {
+			end++
+		}
+		group := candidates[start:end]
+		start = end
+		for i := range group {
+			group[i].normalized = normalizeTitle(group[i].Title)
+		}
+		for _, cluster := range clusterDuplicates(group) {
+			canonical := pickCanonical(cluster)
+			if len(cluster) > 1 {
+				report.Clusters++
+				report.Duplicates += len(cluster) - 1
+			}
+			for _, member := range cluster {
+				want := canonical.ID
+				if member.ID == canonical.ID {
+					want = 0
+				}
+				if member.DuplicateOf == want {
+					continue
+				}
+				if err := s.Database.Model(&Event{}).Where("id = ?", member.ID).Update("duplicate_of", want).Error; err != nil {
+					return report, err
+				}
+				changed = true
+			}
+		}
+	}
+	if changed {
+		// reposts dont count towards the venue they are at or whoever hosts them
+		if err := countAllEvents(s.Database, "venues", "venue_id"); err != nil {
+			return report, err
+		}
+		if err := countAllEvents(s.Database, "organizers", "organizer_id"); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// clusterDuplicates groups events that look like the same listing. Matching is transitive, if a~b and
+// b~c all three end up in one cluster
+func clusterDuplicates(group []dedupCandidate) [][]*dedupCandidate {
+	parent := make([]int, len(group))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range group {
+		for j := i + 1; j < len(group); j++ {
+			if isDuplicate(&group[i], &group[j]) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+	clusters := make(map[int][]*dedupCandidate)
+	var roots []int
+	for i := range group {
+		root := find(i)
+		if _, ok := clusters[root]; !ok {
+			roots = append(roots, root)
+		}
+		clusters[root] = append(clusters[root], &group[i])
+	}
+	out := make([][]*dedupCandidate, 0, len(roots))
+	for _, root := range roots {
+		out = append(out, clusters[root])
+	}
+	return out
+}
+
+func isDuplicate(a, b *dedupCandidate) bool {
+	similarity := TitleSimilarity(a.normalized, b.normalized)
+	if a.hasCoordinates() && b.hasCoordinates() {
+		return similarity >= duplicateTitleSimilarity &&
+			HaversineKm(*a.Latitude, *a.Longitude, *b.Latitude, *b.Longitude) <= duplicateRadiusKm
+	}
+	return similarity >= duplicateTitleNoGeo
+}
+
+// pickCanonical keeps the listing with the most to show for it: coordinates, then the longer
+// description, then the oldest row
+func pickCanonical(cluster []*dedupCandidate) *dedupCandidate {
+	sorted := append([]*dedupCandidate(nil), cluster...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.hasCoordinates() != b.hasCoordinates() {
+			return a.hasCoordinates()
+		}
+		if len(a.Description) != len(b.Description) {
+			return len(a.Description) > len(b.Description)
+		}
+		return a.ID < b.ID
+	})
+	return sorted[0]
+}
+
+// normalizeTitle lower cases the title and strips punctuation and the extra whitespace
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space && b.Len() > 0 {
+			b.WriteRune(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// TitleSimilarity is the dice coefficient of the character bigrams of two normalized titles, 1 means identical
+func TitleSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+	bigrams := func(s string) map[string]int {
+		r := []rune(s)
+		out := make(map[string]int, len(r))
+		for i := 0; i < len(r)-1; i++ {
+			out[string(r[i:i+2])]++
+		}
+		return out
+	}
+	aGrams, bGrams := bigrams(a), bigrams(b)
+	var overlap, total int
+	for gram, count := range aGrams {
+		total += count
+		if other, ok := bGrams[gram]; ok {
+			overlap += min(count, other)
+		}
+	}
+	for _, count := range bGrams {
+		total += count
+	}
+	return 2 * float64(overlap) / float64(total)
+}
@@ -0,0 +1,52 @@
+package DB
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduplicate(t *testing.T) {
+	db, queries := newTestDB(t)
+	storage := &Storage{Database: db}
+
+	start := time.Date(2025, 3, 1, 20, 0, 0, 0, time.UTC)
+	other := start.Add(time.Hour)
+	events := []Event{
+		{Title: "Jazz Night @ The Stone Pony!", Description: "short", StartsAt: &start},
+		{Title: "Jazz Night at The Stone Pony", Description: "the longest description of the lot", StartsAt: &start},
+		{Title: "jazz night at the stone pony", StartsAt: &start},                            // far away, not a duplicate
+		{Title: "Jazz Night at The Stone Pony", Description: "later show", StartsAt: &other}, // different time
+		{Title: "Pottery Class", StartsAt: &start},
+	}
+	for i := range events {
+		db.Create(&events[i])
+	}
+	db.Create(&GeoPoint{EventID: events[0].ID, Latitude: 40.2204, Longitude: -73.9987})
+	db.Create(&GeoPoint{EventID: events[1].ID, Latitude: 40.2206, Longitude: -73.9990})
+	db.Create(&GeoPoint{EventID: events[2].ID, Latitude: 39.3643, Longitude: -74.4229})
+
+	report, err := storage.Deduplicate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Duplicates != 1 || report.Clusters != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	var got []Event
+	db.Order("id").Find(&got)
+	want := []int{events[1].ID, 0, 0, 0, 0}
+	for i := range got {
+		if got[i].DuplicateOf != want[i] {
+			t.Errorf("event %d (%s): duplicate_of = %d, want %d", got[i].ID, got[i].Title, got[i].DuplicateOf, want[i])
+		}
+	}
+
+	listed, err := queries.FindEvents(EventFilter{}, 0, 10)
+	if err != nil || len(listed) != 4 {
+		t.Fatalf("duplicates should be hidden by default, got %d events (%v)", len(listed), err)
+	}
+	listed, _ = queries.FindEvents(EventFilter{IncludeDuplicates: true}, 0, 10)
+	if len(listed) != 5 {
+		t.Fatalf("expected all 5 events with duplicates included, got %d", len(listed))
+	}
+}
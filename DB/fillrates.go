@@ -0,0 +1,43 @@
+package DB
+
+import (
+	"time"
+)
+
+// FillRate records how often one field came back non empty during one scrape run of a source
+type FillRate struct {
+	ID     int       `db:"id" json:"id"`
+	RunAt  time.Time `db:"run_at" json:"run_at" gorm:"index"`
+	Source string    `db:"source" json:"source" gorm:"index"`
+	Field  string    `db:"field" json:"field"`
+	Filled int       `db:"filled" json:"filled"`
+	Total  int       `db:"total" json:"total"`
+	Rate   float64   `db:"rate" json:"rate"`
+}
+
+func (f *FillRate) isEvent() {}
+
+func (s *Storage) AddFillRates(rates []FillRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+	return s.Database.Create(&rates).Error
+}
+
+// FillRateBaseline is the average rate of field over the last runs of source. found is false until
+// there is some history to compare against
+func (s *Storage) FillRateBaseline(source, field string, runs int) (baseline float64, found bool) {
+	var rates []float64
+	err := s.Database.Model(&FillRate{}).
+		Where("source = ? AND field = ? AND total > 0", source, field).
+		Order("run_at DESC, id DESC").Limit(runs).
+		Pluck("rate", &rates).Error
+	if err != nil || len(rates) == 0 {
+		return 0, false
+	}
+	var sum float64
+	for _, rate := range rates {
+		sum += rate
+	}
+	return sum / float64(len(rates)), true
+}
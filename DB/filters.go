@@ -0,0 +1,146 @@
+package DB
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// EventFilter narrows down /events and /search. The zero value matches everything
+type EventFilter struct {
+	Tag string
+	// From and To bound the start of the event, To is exclusive
+	From *time.Time
+	To   *time.Time
+	// only events within RadiusKm of Lat/Long, ignored unless Near is set
+	Near     bool
+	Lat      float64
+	Long     float64
+	RadiusKm float64
+	// duplicates found by the dedup pass are left out unless this is set
+	IncludeDuplicates bool
+	// in_person, online or hybrid, empty for all of them
+	Mode string
+	// only the events at this venue or hosted by this organizer, 0 for any
+	VenueID     int
+	OrganizerID int
+}
+
+// where builds the sql for the filter against the events table. Every condition is an EXISTS or a plain
+// column check so the caller never gets the same event twice
+func (f EventFilter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if !f.IncludeDuplicates {
+		conditions = append(conditions, "events.duplicate_of = 0")
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM event_tags JOIN tags ON tags.id = event_tags.tag_id
+			WHERE event_tags.event_id = events.id AND tags.name = ?)`)
+		args = append(args, NormalizeTag(f.Tag))
+	}
+	if f.Mode != "" {
+		conditions = append(conditions, "events.attendance_mode = ?")
+		args = append(args, f.Mode)
+	}
+	if f.VenueID != 0 {
+		conditions = append(conditions, "events.venue_id = ?")
+		args = append(args, f.VenueID)
+	}
+	if f.OrganizerID != 0 {
+		conditions = append(conditions, "events.organizer_id = ?")
+		args = append(args, f.OrganizerID)
+	}
+	if f.From != nil || f.To != nil {
+		// a series matches when any one of its dates is in range
+		eventRange, eventArgs := f.dateRange("events.starts_at")
+		occurrenceRange, occurrenceArgs := f.dateRange("o.starts_at")
+		conditions = append(conditions, "(("+eventRange+") OR EXISTS (SELECT 1 FROM occurrences o WHERE o.event_id = events.id AND "+occurrenceRange+"))")
+		args = append(append(args, eventArgs...), occurrenceArgs...)
+	}
+	if f.Near {
+		// equirectangular distance, plenty accurate at city scale and sqlite can do it without math functions
+		latDelta, longDelta := boundingBox(f.Lat, f.RadiusKm)
+		kmPerLong := 111.0 * math.Cos(f.Lat*math.Pi/180)
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM geo_points g WHERE g.event_id = events.id
+			AND g.latitude BETWEEN ? AND ? AND g.longitude BETWEEN ? AND ?
+			AND ((g.latitude - ?) * 111.0) * ((g.latitude - ?) * 111.0) + ((g.longitude - ?) * ?) * ((g.longitude - ?) * ?) <= ?)`)
+		args = append(args,
+			f.Lat-latDelta, f.Lat+latDelta, f.Long-longDelta, f.Long+longDelta,
+			f.Lat, f.Lat, f.Long, kmPerLong, f.Long, kmPerLong, f.RadiusKm*f.RadiusKm)
+	}
+	if len(conditions) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// dateRange bounds column by From and To. starts_at is always written in UTC so comparing the stored text works
+func (f EventFilter) dateRange(column string) (string, []interface{}) {
+	var bounds []string
+	var args []interface{}
+	if f.From != nil {
+		bounds = append(bounds, column+" >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if f.To != nil {
+		bounds = append(bounds, column+" < ?")
+		args = append(args, f.To.UTC())
+	}
+	return strings.Join(bounds, " AND "), args
+}
+
+func boundingBox(lat, radiusKm float64) (latDelta, longDelta float64) {
+	latDelta = radiusKm / 111.0
+	longDelta = radiusKm / (111.0 * math.Max(math.Cos(lat*math.Pi/180), 0.01))
+	return latDelta, longDelta
+}
+
+// FindEvents returns the events matching the filter, soonest first when a date range is given
+func (q *Queries) FindEvents(filter EventFilter, offset, limit uint) ([]Event, error) {
+	var events []Event
+	where, args := filter.where()
+	order := "events.id"
+	if filter.From != nil || filter.To != nil {
+		order = "events.starts_at, events.id"
+	}
+	query := "SELECT events.* FROM events WHERE " + where + " ORDER BY " + order + " limit ? offset ? "
+	err := q.db.Select(&events, query, append(args, limit, offset)...)
+	if err != nil {
+		logger.Error("failed to fetch events", "err", err)
+		return nil, err
+	}
+	return events, q.attachOccurrences(events, filter)
+}
+
+// attachOccurrences loads the dates of every series in events. With a date range only the dates inside it
+// are attached, so a weekly event lists each week it runs in the requested window
+func (q *Queries) attachOccurrences(events []Event, filter EventFilter) error {
+	index := make(map[int]int)
+	var ids []interface{}
+	for i := range events {
+		if events[i].IsSeries {
+			index[events[i].ID] = i
+			ids = append(ids, events[i].ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	query := "SELECT * FROM occurrences WHERE event_id IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+	args := ids
+	if dateRange, rangeArgs := filter.dateRange("starts_at"); dateRange != "" {
+		query += " AND " + dateRange
+		args = append(args, rangeArgs...)
+	}
+	var occurrences []Occurrence
+	if err := q.db.Select(&occurrences, query+" ORDER BY starts_at", args...); err != nil {
+		logger.Error("failed to fetch occurrences", "err", err)
+		return err
+	}
+	for _, o := range occurrences {
+		event := &events[index[o.EventID]]
+		event.Occurrences = append(event.Occurrences, o)
+	}
+	return nil
+}
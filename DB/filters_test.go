@@ -0,0 +1,71 @@
+package DB
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindEventsMatchesSeriesOccurrences(t *testing.T) {
+	db, queries := newTestDB(t)
+	storage := &Storage{Database: db}
+
+	first := time.Date(2025, 3, 5, 23, 0, 0, 0, time.UTC)
+	weekly := Event{Title: "Weekly Trivia", IsSeries: true, StartsAt: &first}
+	oneOff := Event{Title: "Pottery Class", StartsAt: &first}
+	db.Create(&weekly)
+	db.Create(&oneOff)
+	var occurrences []Occurrence
+	for week := 0; week < 4; week++ {
+		occurrences = append(occurrences, Occurrence{StartsAt: first.AddDate(0, 0, 7*week)})
+	}
+	storage.AddOccurrences(weekly.Title, weekly.ID, occurrences)
+
+	// third week only
+	from, to := first.AddDate(0, 0, 13), first.AddDate(0, 0, 15)
+	events, err := queries.FindEvents(EventFilter{From: &from, To: &to}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].ID != weekly.ID {
+		t.Fatalf("expected only the series, got %+v", events)
+	}
+	if len(events[0].Occurrences) != 1 || !events[0].Occurrences[0].StartsAt.Equal(first.AddDate(0, 0, 14)) {
+		t.Fatalf("expected the third week's occurrence attached, got %+v", events[0].Occurrences)
+	}
+}
+
+func TestEventsByVenueAndOrganizer(t *testing.T) {
+	db, queries := newTestDB(t)
+	storage := &Storage{Database: db}
+
+	first := time.Date(2025, 3, 5, 23, 0, 0, 0, time.UTC)
+	weekly := Event{Title: "Weekly Trivia", IsSeries: true, StartsAt: &first, VenueID: 7, OrganizerID: 3}
+	repost := Event{Title: "Weekly Trivia!", StartsAt: &first, VenueID: 7, OrganizerID: 3}
+	elsewhere := Event{Title: "Pottery Class", StartsAt: &first, VenueID: 8, OrganizerID: 4}
+	db.Create(&weekly)
+	repost.DuplicateOf = weekly.ID
+	db.Create(&repost)
+	db.Create(&elsewhere)
+	storage.AddOccurrences(weekly.Title, weekly.ID, []Occurrence{{StartsAt: first}, {StartsAt: first.AddDate(0, 0, 7)}})
+
+	lists := []struct {
+		name string
+		list func(int, uint, uint) ([]Event, error)
+		id   int
+	}{
+		{"venue", queries.EventsByVenue, weekly.VenueID},
+		{"organizer", queries.EventsByOrganizer, weekly.OrganizerID},
+	}
+	for _, tt := range lists {
+		events, err := tt.list(tt.id, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].ID != weekly.ID {
+			t.Fatalf("%s: expected only the series without its repost, got %+v", tt.name, events)
+		}
+		if len(events[0].Occurrences) != 2 {
+			t.Errorf("%s: expected the dates of the series, got %+v", tt.name, events[0].Occurrences)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package DB
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CrawlTarget is one url the crawl frontier schedules: a seed listing or an event detail page
+type CrawlTarget struct {
+	ID         int    `db:"id" json:"id"`
+	URL        string `db:"url" json:"url" gorm:"uniqueIndex"`
+	Kind       string `db:"kind" json:"kind" gorm:"index"` // listing or detail
+	Population int    `db:"population" json:"population"`
+	Visits     int    `db:"visits" json:"visits"`
+	// new events per visit, a moving average so one odd visit doesnt swing the schedule
+	Yield float64 `db:"yield" json:"yield"`
+	// visits in a row that found nothing new
+	EmptyVisits int        `db:"empty_visits" json:"empty_visits"`
+	LastVisit   *time.Time `db:"last_visit" json:"last_visit"`
+	NextVisit   time.Time  `db:"next_visit" json:"next_visit" gorm:"index"`
+	// when the event of a detail page starts, revisits get closer together as it nears
+	EventStartsAt *time.Time `db:"event_starts_at" json:"event_starts_at"`
+}
+
+func (c *CrawlTarget) isEvent() {}
+
+// CrawlTargets loads every target of the frontier
+func (s *Storage) CrawlTargets() ([]CrawlTarget, error) {
+	var targets []CrawlTarget
+	err := s.Database.Order("id").Find(&targets).Error
+	return targets, err
+}
+
+// SaveCrawlTargets inserts new targets and overwrites the schedule of known ones, in one transaction
+func (s *Storage) SaveCrawlTargets(targets []*CrawlTarget) error {
+	return s.Database.Transaction(func(tx *gorm.DB) error {
+		for _, target := range targets {
+			if err := tx.Save(target).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
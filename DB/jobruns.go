@@ -0,0 +1,39 @@
+package DB
+
+import (
+	"time"
+)
+
+// outcomes of a scheduled job run
+const (
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	// the job came due while another one was still running
+	JobSkipped = "skipped"
+)
+
+// JobRun records one run of a scheduled job
+type JobRun struct {
+	ID         int       `db:"id" json:"id"`
+	Job        string    `db:"job" json:"job" gorm:"index"`
+	StartedAt  time.Time `db:"started_at" json:"started_at" gorm:"index"`
+	FinishedAt time.Time `db:"finished_at" json:"finished_at"`
+	Status     string    `db:"status" json:"status"`
+	Error      string    `db:"error" json:"error,omitempty"`
+}
+
+func (j *JobRun) isEvent() {}
+
+func (s *Storage) AddJobRun(run *JobRun) error {
+	return s.Database.Create(run).Error
+}
+
+// LastJobRun returns the latest run of job, skipped ones included
+func (s *Storage) LastJobRun(job string) (*JobRun, bool) {
+	var run JobRun
+	result := s.Database.Where("job = ?", job).Order("started_at DESC, id DESC").Limit(1).Find(&run)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false
+	}
+	return &run, true
+}
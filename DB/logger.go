@@ -0,0 +1,53 @@
+package DB
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+/*
+gorm logs on its own to stdout, this hands what it logs to the db logger instead: failed statements as
+errors, slow ones as warnings and every other one at debug, so LOG_LEVELS=db=debug shows all the sql
+*/
+
+// statements taking longer than this are logged as slow
+const slowStatement = 200 * time.Millisecond
+
+type gormLogger struct{}
+
+func (g gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return g
+}
+
+func (gormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	took := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		logger.ErrorContext(ctx, "statement failed", "sql", sql, "rows", rows, "took", took, "err", err)
+	case took > slowStatement:
+		sql, rows := fc()
+		logger.WarnContext(ctx, "slow statement", "sql", sql, "rows", rows, "took", took)
+	case logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		logger.DebugContext(ctx, "statement", "sql", sql, "rows", rows, "took", took)
+	}
+}
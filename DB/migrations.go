@@ -0,0 +1,77 @@
+package DB
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/*
+AutoMigrate only takes care of the table shapes. Anything that has to touch existing rows goes in here,
+each migration runs once and is recorded in schema_migrations, in the same transaction as its changes.
+Only ever append to this list
+*/
+
+type SchemaMigration struct {
+	Name      string    `gorm:"primaryKey"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+type migration struct {
+	name string
+	run  func(db *gorm.DB) error
+}
+
+var migrations = []migration{
+	{name: "0001_backfill_event_tags", run: backfillEventTags},
+	{name: "0002_geo_point_location_text", run: replaceNullAddress},
+	{name: "0003_count_venue_events", run: countVenueEvents},
+	{name: "0004_count_organizer_events", run: countOrganizerEvents},
+}
+
+// countVenueEvents corrects the venue counts, every store of an event used to add one to them, revisits too
+func countVenueEvents(db *gorm.DB) error {
+	return countAllEvents(db, "venues", "venue_id")
+}
+
+// countOrganizerEvents does the same for the organizer counts
+func countOrganizerEvents(db *gorm.DB) error {
+	return countAllEvents(db, "organizers", "organizer_id")
+}
+
+// replaceNullAddress swaps the "NUllAddress" placeholder that geo points of events without an exact address
+// used to get for the location text of their event, which is what those geo points hold now
+func replaceNullAddress(db *gorm.DB) error {
+	return db.Exec(`UPDATE geo_points SET address = COALESCE((SELECT location FROM events WHERE events.id = geo_points.event_id), '')
+		WHERE address = 'NUllAddress'`).Error
+}
+
+// runMigrations applies every migration that hasnt been recorded yet and returns the names it applied
+func runMigrations(db *gorm.DB) ([]string, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var applied []string
+	for _, m := range migrations {
+		var count int64
+		if err := db.Model(&SchemaMigration{}).Where("name = ?", m.name).Count(&count).Error; err != nil {
+			return applied, err
+		}
+		if count > 0 {
+			continue
+		}
+		// a migration that fails halfway leaves nothing behind, and is tried again next time
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.run(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+		applied = append(applied, m.name)
+	}
+	return applied, nil
+}
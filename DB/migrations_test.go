@@ -0,0 +1,23 @@
+package DB
+
+import "testing"
+
+func TestReplaceNullAddress(t *testing.T) {
+	db, _ := newTestDB(t)
+	event := Event{Title: "Salsa Night", Location: "Asbury Park, NJ"}
+	db.Create(&event)
+	placeholder := GeoPoint{EventID: event.ID, Latitude: -1.1, Longitude: -1.1, Address: "NUllAddress"}
+	exact := GeoPoint{EventID: event.ID, Latitude: 40.22, Longitude: -73.99, Address: "913 Ocean Ave"}
+	db.Create(&placeholder)
+	db.Create(&exact)
+	db.Exec("DELETE FROM schema_migrations WHERE name = ?", "0002_geo_point_location_text")
+
+	if applied, err := runMigrations(db); err != nil || len(applied) != 1 {
+		t.Fatalf("applied %v (%v)", applied, err)
+	}
+	var points []GeoPoint
+	db.Order("id").Find(&points)
+	if points[0].Address != "Asbury Park, NJ" || points[1].Address != "913 Ocean Ave" {
+		t.Errorf("addresses after the migration %q, %q", points[0].Address, points[1].Address)
+	}
+}
@@ -19,10 +19,19 @@ type GeoPoint struct {
 	Longitude float64 `db:"longitude" json:"longitude"`
 	Address   string  `db:"address" json:"address"` // street name, etc.
 	EventID   int     `db:"event_id" json:"event_id"`
+	// parsed pieces of Address, filled in by the offline parser in Scrape
+	Venue      string `db:"venue" json:"venue"`
+	Street     string `db:"street" json:"street"`
+	City       string `db:"city" json:"city"`
+	State      string `db:"state" json:"state"`
+	PostalCode string `db:"postal_code" json:"postal_code"`
+	Country    string `db:"country" json:"country"`
+	Canonical  string `db:"canonical" json:"canonical" gorm:"index"` // used for dedup + geocoding
 }
 
 type Event struct {
 	ID             int    `db:"id" json:"id"`
+	URL            string `json:"url" db:"url" gorm:"index"` // detail page the event was scraped from
 	ImageUrl       string `json:"image_url" db:"image_url"`
 	Host           string `json:"host" db:"host"`
 	Title          string `json:"title" db:"title"`
@@ -31,9 +40,60 @@ type Event struct {
 	Description    string `json:"description" db:"description"`
 	Tags           string `json:"tags" db:"tags"`
 	ExtraInfo      string `json:"extra_info" db:"extra_info"`
-	Bio            string `json:"bio" db:"bio"`
+	Bio            string `json:"bio" db:"bio"` // only on events from before organizers, the bio is kept there now
 	ExactAddress   bool   `json:"exact_address" db:"exact_address"`
 	AcceptsRefunds bool   `json:"accepts_refunds" db:"accepts_refunds"`
+	VenueID        int    `json:"venue_id" db:"venue_id" gorm:"index"` // 0 when the event has no usable address
+	OrganizerID    int    `json:"organizer_id" db:"organizer_id" gorm:"index"`
+	// filled in by the rule based classifier, CategoryRules is the version of the rules that produced it
+	Category           string  `json:"category" db:"category" gorm:"index"`
+	CategoryConfidence float64 `json:"category_confidence" db:"category_confidence"`
+	CategoryRules      string  `json:"-" db:"category_rules"`
+	// Date parsed into real times, nil when the page didnt give us anything we could read
+	StartsAt *time.Time `json:"starts_at" db:"starts_at" gorm:"index"`
+	EndsAt   *time.Time `json:"ends_at" db:"ends_at"`
+	// id of the canonical listing when the dedup pass decided this one is a repost of it, 0 otherwise
+	DuplicateOf int `json:"duplicate_of" db:"duplicate_of" gorm:"index;default:0"`
+	// in_person, online or hybrid. Platform is the streaming service for online and hybrid events when the page names one
+	AttendanceMode string `json:"attendance_mode" db:"attendance_mode" gorm:"index;default:'in_person'"`
+	Platform       string `json:"platform" db:"platform"`
+	// a recurring series keeps its dates in the occurrences table, StartsAt/EndsAt hold the next one
+	IsSeries    bool         `json:"is_series" db:"is_series"`
+	Occurrences []Occurrence `json:"occurrences,omitempty" db:"-" gorm:"-"`
+}
+
+// Occurrence is one date of a recurring series
+type Occurrence struct {
+	ID                int        `db:"id" json:"id"`
+	EventID           int        `db:"event_id" json:"event_id" gorm:"index"` // the parent series
+	StartsAt          time.Time  `db:"starts_at" json:"starts_at" gorm:"index"`
+	EndsAt            *time.Time `db:"ends_at" json:"ends_at"`
+	MaxCapacity       int        `db:"max_capacity" json:"max_capacity"`
+	RemainingCapacity int        `db:"remaining_capacity" json:"remaining_capacity"`
+	URL               string     `db:"url" json:"url"`
+}
+
+// Organizer is whoever is hosting the event. Host on Event is kept for older clients
+type Organizer struct {
+	ID         int    `db:"id" json:"id"`
+	Name       string `db:"name" json:"name" gorm:"index"`
+	ProfileURL string `db:"profile_url" json:"profile_url" gorm:"index"`
+	Bio        string `db:"bio" json:"bio"`
+	Followers  int    `db:"followers" json:"followers"` // 0 when the page doesnt show it
+	EventCount int    `db:"event_count" json:"event_count"`
+}
+
+// Venue is a place events happen at. Many events point at the same venue so it only gets geocoded once
+type Venue struct {
+	ID                int     `db:"id" json:"id"`
+	Name              string  `db:"name" json:"name"`
+	NormalizedAddress string  `db:"normalized_address" json:"normalized_address" gorm:"index"`
+	Latitude          float64 `db:"latitude" json:"latitude"`
+	Longitude         float64 `db:"longitude" json:"longitude"`
+	EventCount        int     `db:"event_count" json:"event_count"`
+	// when the last lookup of the coordinates failed, nil once it has them. The crawl doesnt ask again,
+	// the geocode backfill job does
+	GeocodeFailedAt *time.Time `db:"geocode_failed_at" json:"geocode_failed_at,omitempty"`
 }
 
 type EventInfo struct {
@@ -48,9 +108,12 @@ type EventInfo struct {
 	LastUpdated     time.Time `db:"last_updated" json:"last_updated"`
 }
 
-func (e *EventInfo) isEvent() {}
-func (e *Event) isEvent()     {}
-func (e *GeoPoint) isEvent()  {}
+func (e *EventInfo) isEvent()  {}
+func (e *Event) isEvent()      {}
+func (e *GeoPoint) isEvent()   {}
+func (v *Venue) isEvent()      {}
+func (o *Organizer) isEvent()  {}
+func (o *Occurrence) isEvent() {}
 
 // for raw SQl querys
 type Queries struct {
@@ -0,0 +1,66 @@
+package DB
+
+import (
+	"strings"
+)
+
+// ResolveOrganizer finds the organizer by profile url, or by name among the ones without a url, and creates
+// it when we havent seen it before. Newer bios and follower counts replace the stored ones
+func (s *Storage) ResolveOrganizer(name, profileURL, bio string, followers int) *Organizer {
+	name = strings.TrimSpace(name)
+	if name == "" && profileURL == "" {
+		return nil
+	}
+	s.orgMu.Lock()
+	defer s.orgMu.Unlock()
+
+	var organizer Organizer
+	found := false
+	if profileURL != "" {
+		found = s.findOrganizer(&organizer, "profile_url = ?", profileURL)
+	}
+	if !found && name != "" {
+		// a page without the link made the organizer by name, the first page with it fills it in
+		found = s.findOrganizer(&organizer, "LOWER(name) = ? AND profile_url = ''", strings.ToLower(name))
+	}
+	if found {
+		updates := map[string]interface{}{}
+		if profileURL != "" && organizer.ProfileURL == "" {
+			updates["profile_url"] = profileURL
+			organizer.ProfileURL = profileURL
+		}
+		if bio != "" && bio != organizer.Bio {
+			updates["bio"] = bio
+			organizer.Bio = bio
+		}
+		if followers > 0 && followers != organizer.Followers {
+			updates["followers"] = followers
+			organizer.Followers = followers
+		}
+		if len(updates) > 0 {
+			s.Database.Model(&organizer).Updates(updates)
+		}
+		return &organizer
+	}
+
+	organizer = Organizer{
+		Name:       name,
+		ProfileURL: profileURL,
+		Bio:        bio,
+		Followers:  followers,
+	}
+	s.Database.Create(&organizer)
+	logger.Debug("created organizer", "organizer", name, "url", profileURL)
+	return &organizer
+}
+
+func (s *Storage) findOrganizer(organizer *Organizer, query string, args ...interface{}) bool {
+	result := s.Database.Where(query, args...).Limit(1).Find(organizer)
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// CountOrganizerEvents sets the event count of the organizers to the events they host, reposts left out,
+// the same way CountVenueEvents does for venues
+func (s *Storage) CountOrganizerEvents(organizerIDs ...int) error {
+	return countEvents(s.Database, "organizers", "organizer_id", organizerIDs)
+}
@@ -0,0 +1,55 @@
+package DB
+
+import "testing"
+
+func TestResolveOrganizer(t *testing.T) {
+	db, _ := newTestDB(t)
+	storage := &Storage{Database: db}
+
+	// the first page had no profile link, the second one does
+	byName := storage.ResolveOrganizer("Newark Jazz Society", "", "", 0)
+	withURL := storage.ResolveOrganizer("Newark Jazz Society", "https://www.eventbrite.com/o/newark-jazz-1", "Jazz in the city", 1200)
+	if byName.ID != withURL.ID {
+		t.Fatalf("the page with the link made organizer %d next to %d", withURL.ID, byName.ID)
+	}
+	again := storage.ResolveOrganizer("Newark Jazz Society Inc", "https://www.eventbrite.com/o/newark-jazz-1", "", 0)
+	if again.ID != byName.ID || again.Bio != "Jazz in the city" || again.Followers != 1200 {
+		t.Errorf("by url got %+v", again)
+	}
+
+	// a different host with the same name but another link is someone else
+	other := storage.ResolveOrganizer("Newark Jazz Society", "https://www.eventbrite.com/o/newark-jazz-2", "", 0)
+	if other.ID == byName.ID {
+		t.Error("two profile urls were merged into one organizer")
+	}
+	var count int64
+	db.Model(&Organizer{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d organizers, want 2", count)
+	}
+	var stored Organizer
+	db.First(&stored, byName.ID)
+	if stored.ProfileURL != "https://www.eventbrite.com/o/newark-jazz-1" {
+		t.Errorf("profile url not filled in: %+v", stored)
+	}
+}
+
+func TestCountOrganizerEvents(t *testing.T) {
+	db, _ := newTestDB(t)
+	storage := &Storage{Database: db}
+	host := storage.ResolveOrganizer("Newark Jazz Society", "https://www.eventbrite.com/o/newark-jazz-1", "", 0)
+
+	jazz := Event{URL: "https://www.eventbrite.com/e/jazz-1", Title: "Jazz Night", OrganizerID: host.ID}
+	for i := 0; i < 3; i++ {
+		// revisits of the same page
+		storage.AddEvent(jazz)
+		storage.CountOrganizerEvents(host.ID)
+	}
+	storage.AddEvent(Event{URL: "https://www.eventbrite.com/e/jam-2", Title: "Jam Session", OrganizerID: host.ID})
+	storage.CountOrganizerEvents(host.ID)
+	var stored Organizer
+	db.First(&stored, host.ID)
+	if stored.EventCount != 2 {
+		t.Errorf("organizer counts %d events, want 2", stored.EventCount)
+	}
+}
@@ -1,9 +1,9 @@
 package DB
 
 import (
-	"log"
-
 	"github.com/jmoiron/sqlx"
+
+	"lite/logging"
 )
 
 /*
@@ -13,20 +13,21 @@ func connect(databasePath string) *sqlx.DB {
 	// Open the SQLite database file
 	db, err := sqlx.Open("sqlite3", databasePath)
 	if err != nil {
-		log.Fatalf("Failed to connect to SQLite database: %v", err)
+		logging.Fatal(logger, "failed to connect to the sqlite database", "path", databasePath, "err", err)
 	}
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
-		log.Fatalf("Failed to ping SQLite database: %v", err)
+		logging.Fatal(logger, "failed to ping the sqlite database", "path", databasePath, "err", err)
 	}
 
-	log.Println("Connected to SQLite database successfully!")
+	logger.Info("connected to the sqlite database", "path", databasePath)
 	return db
 }
 
-func NewQuery() *Queries {
-	Connection := connect("./startup.g")
+// NewQuery reads the database at path, the same file the scraper's Storage writes
+func NewQuery(path string) *Queries {
+	Connection := connect(path)
 	return &Queries{db: Connection}
 }
 
@@ -35,7 +36,7 @@ func (q *Queries) GetAllEvents(offset, limit uint) ([]Event, error) {
 	query := "SELECT * FROM events limit ? offset ? " // Replace "events" with your table name
 	err := q.db.Select(&events, query, limit, offset)
 	if err != nil {
-		log.Printf("Failed to fetch events: %v", err)
+		logger.Error("failed to fetch events", "err", err)
 		return nil, err
 	}
 	return events, nil
@@ -46,12 +47,77 @@ func (q *Queries) GetAllEventslocations(offset, limit uint) ([]GeoPoint, error)
 	query := "SELECT * FROM GeoPoint limit ? offset ? " // Replace "events" with your table name
 	err := q.db.Select(&GeoPoints, query, limit, offset)
 	if err != nil {
-		log.Printf("Failed to fetch events: %v", err)
+		logger.Error("failed to fetch events", "err", err)
 		return nil, err
 	}
 	return GeoPoints, nil
 }
 
+func (q *Queries) GetVenues(offset, limit uint) ([]Venue, error) {
+	var venues []Venue
+	query := "SELECT * FROM venues ORDER BY event_count DESC, id limit ? offset ? "
+	err := q.db.Select(&venues, query, limit, offset)
+	if err != nil {
+		logger.Error("failed to fetch venues", "err", err)
+		return nil, err
+	}
+	return venues, nil
+}
+
+func (q *Queries) GetVenue(id int) (*Venue, error) {
+	var venue Venue
+	err := q.db.Get(&venue, "SELECT * FROM venues WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	return &venue, nil
+}
+
+func (q *Queries) EventsByVenue(venueID int, offset, limit uint) ([]Event, error) {
+	return q.FindEvents(EventFilter{VenueID: venueID}, offset, limit)
+}
+
+func (q *Queries) GetOrganizers(offset, limit uint) ([]Organizer, error) {
+	var organizers []Organizer
+	query := "SELECT * FROM organizers ORDER BY event_count DESC, id limit ? offset ? "
+	err := q.db.Select(&organizers, query, limit, offset)
+	if err != nil {
+		logger.Error("failed to fetch organizers", "err", err)
+		return nil, err
+	}
+	return organizers, nil
+}
+
+func (q *Queries) GetOrganizer(id int) (*Organizer, error) {
+	var organizer Organizer
+	err := q.db.Get(&organizer, "SELECT * FROM organizers WHERE id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	return &organizer, nil
+}
+
+func (q *Queries) EventsByOrganizer(organizerID int, offset, limit uint) ([]Event, error) {
+	return q.FindEvents(EventFilter{OrganizerID: organizerID}, offset, limit)
+}
+
+func (q *Queries) TagCounts(offset, limit uint) ([]TagCount, error) {
+	var counts []TagCount
+	query := `SELECT tags.name AS name, COUNT(event_tags.event_id) AS count FROM tags
+		JOIN event_tags ON event_tags.tag_id = tags.id
+		GROUP BY tags.id ORDER BY count DESC, tags.name limit ? offset ? `
+	err := q.db.Select(&counts, query, limit, offset)
+	if err != nil {
+		logger.Error("failed to fetch tag counts", "err", err)
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (q *Queries) EventsByTag(tag string, offset, limit uint) ([]Event, error) {
+	return q.FindEvents(EventFilter{Tag: tag}, offset, limit)
+}
+
 func (q *Queries) EventbyLocation(lat, long float64, offset, limit uint) ([]GeoPoint, error) {
 	return nil, nil
 }
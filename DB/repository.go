@@ -2,72 +2,75 @@ package DB
 
 import (
 	"fmt"
-	"log"
-	"os"
 	"sync"
 	"time"
 
 	"gorm.io/gorm"
 
-	"lite/pkg"
+	"lite/logging"
 
 	"gorm.io/driver/sqlite"
 )
 
 type Storage struct {
 	Database *gorm.DB
-	logFile  *os.File
+	venueMu  sync.Mutex // keeps concurrent workers from creating the same venue twice
+	orgMu    sync.Mutex // same thing for organizers
 }
 
-func (s Storage) Start() error {
-	GetStorage()
+// Start is there for pkg.SetUp, the database is ready once NewStorage returns
+func (s *Storage) Start() error {
 	return nil
 }
 
-var (
-	colorOutput *pkg.TextStyler
-	// Singleton instance of Storage
-	storageInstance *Storage
-	// Mutex to synchronize creation
-	once sync.Once
-)
+var logger = logging.For(logging.DB)
 
-// Storage struct encapsulates the database connection and log file
-
-// GetStorage returns the singleton instance of Storage
-func GetStorage() *Storage {
-	// Ensure the instance is created only once
-	once.Do(func() {
-		// Initialize the Storage instance
-		colorOutput = pkg.NewTextStyler()
-		colorOutput.Red("Configed Color Ouput")
-		storageInstance = &Storage{
-			Database: createDatabaseConnection(),
-			logFile:  pkg.CreateLogFile("DB/_Database"),
-		}
+// Transaction runs fn against a Storage whose statements all go into one transaction, committed when fn
+// returns nil and rolled back otherwise
+func (s *Storage) Transaction(fn func(tx *Storage) error) error {
+	return s.Database.Transaction(func(tx *gorm.DB) error {
+		return fn(&Storage{Database: tx})
 	})
-	return storageInstance
 }
 
-// createDatabaseConnection initializes the gorm.DB connection
-func createDatabaseConnection() *gorm.DB {
-	// Replace this with your actual database configuration
-	db, err := gorm.Open(sqlite.Open("DataStore.db"), &gorm.Config{})
+// NewStorage opens (and migrates) the database at path
+func NewStorage(path string) (*Storage, error) {
+	db, err := openDatabase(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		Database: db,
+	}, nil
+}
+
+func openDatabase(path string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: gormLogger{}})
 	if err != nil {
-		log.Fatalf("failed to connect to the database: %v", err)
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	if err := updateModels(db); err != nil {
+		return nil, err
 	}
-	err = updateModels(db)
+	applied, err := runMigrations(db)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	for _, name := range applied {
+		logger.Info("applied migration", "migration", name)
 	}
-	return db
+	if err := ensureSearchIndex(db); err != nil {
+		// search is optional, the scraper and the rest of the api dont depend on it
+		logger.Warn("full text search disabled", "err", err)
+	}
+	return db, nil
 }
 
 // createLogFile initializes the log file
 
 func updateModels(db *gorm.DB) error {
 	// very easy to just add them in here
-	return db.AutoMigrate(&Event{}, &EventInfo{}, &GeoPoint{})
+	return db.AutoMigrate(&Event{}, &EventInfo{}, &GeoPoint{}, &Venue{}, &Organizer{}, &Tag{}, &EventTag{}, &Occurrence{}, &Snapshot{}, &FillRate{}, &CrawlTarget{}, &JobRun{}, &ScrapeRun{})
 }
 func newEventInfo(EventId int, bio string, maxCapacity, currentCap int, hostname string, eligibal bool, tags string) *EventInfo {
 	return &EventInfo{
@@ -82,7 +85,6 @@ func newEventInfo(EventId int, bio string, maxCapacity, currentCap int, hostname
 	}
 }
 func NewGeoPoint(Lat, Long float64, streetName string) *GeoPoint {
-	fmt.Printf("New GeoPoint at %s with cordnates %v , %v ", streetName, Lat, Long)
 	return &GeoPoint{
 		Latitude:  Lat,
 		Longitude: Long,
@@ -93,27 +95,135 @@ func NewGeoPoint(Lat, Long float64, streetName string) *GeoPoint {
 // Handle insert statments for the data first and formost we can query the data very easily later
 func (s *Storage) createEvent(event *Event) {
 	s.Database.Create(event)
-	var constMessage = fmt.Sprintf("Created Event %s at %v\n", event.Title, time.Now())
-	s.logFile.Write([]byte(constMessage))
+	logger.Debug("created event", "event_id", event.ID, "title", event.Title)
 }
 
 func (s *Storage) createEventInfo(title string, eventInfo *EventInfo) {
 	s.Database.Create(eventInfo)
-	var constMessage = fmt.Sprintf("Created EventInfo %s at %v\n", title, time.Now())
-	s.logFile.Write([]byte(constMessage))
+	logger.Debug("created event info", "title", title)
 }
 
 func (s *Storage) createEventGeo(title string, Geo *GeoPoint) {
 	s.Database.Create(Geo)
-	var constMessage = fmt.Sprintf("Created EventGeo Point %s: %v at %v \n", title, *Geo, time.Now())
-	s.logFile.Write([]byte(constMessage))
+	logger.Debug("created geo point", "title", title, "address", Geo.Address, "lat", Geo.Latitude, "long", Geo.Longitude)
 }
-func (s *Storage) AddEvent(event Event) int {
+
+// AddEvent stores the event under its url. An event we already have from that url is updated in place and
+// its info, tags, dates and geo point are dropped for the caller to add again, so a revisit never leaves a
+// second row behind. Returns the id of the event and whether it was already there
+func (s *Storage) AddEvent(event Event) (int, bool) {
+	if event.URL != "" {
+		var existing Event
+		found := s.Database.Select("id", "duplicate_of", "venue_id", "organizer_id").Where("url = ?", event.URL).Order("id").Limit(1).Find(&existing)
+		if found.Error == nil && found.RowsAffected > 0 {
+			event.ID = existing.ID
+			// whether the listing is a repost is for the dedup pass to say, not the page
+			event.DuplicateOf = existing.DuplicateOf
+			s.updateEvent(&event)
+			if existing.VenueID != event.VenueID {
+				// the event moved, the venue it was at has one less
+				if err := s.CountVenueEvents(existing.VenueID); err != nil {
+					logger.Error("counting venue events failed", "venue_id", existing.VenueID, "err", err)
+				}
+			}
+			if existing.OrganizerID != event.OrganizerID {
+				if err := s.CountOrganizerEvents(existing.OrganizerID); err != nil {
+					logger.Error("counting organizer events failed", "organizer_id", existing.OrganizerID, "err", err)
+				}
+			}
+			return event.ID, true
+		}
+	}
 	s.createEvent(&event)
 	//s.createEventInfo(newEvent.Name, newEventInfo(newEvent.ID, bio, maxCapacity, currentCap, hostname, eligibal, ""))
-	return event.ID
+	return event.ID, false
+}
+
+func (s *Storage) updateEvent(event *Event) {
+	s.Database.Save(event)
+	if err := s.deleteEventRows([]int{event.ID}); err != nil {
+		logger.Error("clearing the old rows of the event failed", "event_id", event.ID, "err", err)
+	}
+	logger.Debug("updated event", "event_id", event.ID, "title", event.Title)
 }
+
+// countEvents recomputes event_count for the rows of table with the given ids from the events pointing at
+// them through column
+func countEvents(db *gorm.DB, table, column string, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.Exec(countEventsQuery(table, column)+" WHERE id IN ?", ids).Error
+}
+
+// countAllEvents recomputes event_count for every row of table
+func countAllEvents(db *gorm.DB, table, column string) error {
+	return db.Exec(countEventsQuery(table, column)).Error
+}
+
+func countEventsQuery(table, column string) string {
+	return "UPDATE " + table + " SET event_count = (SELECT COUNT(*) FROM events WHERE events." + column + " = " +
+		table + ".id AND events.duplicate_of = 0)"
+}
+
+// eventTables hang off events through event_id
+var eventTables = []string{"event_tags", "occurrences", "geo_points", "event_infos"}
+
+// deleteEventRows drops what hangs off the events, the events themselves stay
+func (s *Storage) deleteEventRows(ids []int) error {
+	for _, table := range eventTables {
+		if err := s.Database.Exec("DELETE FROM "+table+" WHERE event_id IN ?", ids).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddEventInfo stores the ticketing details of an event
+func (s *Storage) AddEventInfo(title string, eventID int, info EventInfo) {
+	info.EventID = eventID
+	info.CreatedAt = time.Now()
+	info.LastUpdated = info.CreatedAt
+	s.createEventInfo(title, &info)
+}
+
+// AddOccurrences stores the dates of a recurring series under its parent event
+func (s *Storage) AddOccurrences(title string, eventID int, occurrences []Occurrence) {
+	for i := range occurrences {
+		occurrences[i].EventID = eventID
+	}
+	if len(occurrences) == 0 {
+		return
+	}
+	s.Database.Create(&occurrences)
+	logger.Debug("created occurrences", "title", title, "occurrences", len(occurrences))
+}
+
 func (s *Storage) AddGeoPoint(title string, eventId int, Geo *GeoPoint) {
 	Geo.EventID = eventId
 	s.createEventGeo(title, Geo)
 }
+
+// UpdateStaleCategories runs classify over every event whose category wasnt produced by rulesVersion and
+// saves the result. Returns the number of events updated
+func (s *Storage) UpdateStaleCategories(rulesVersion string, classify func(*Event)) (int, error) {
+	var batch []Event
+	updated := 0
+	result := s.Database.Where("category_rules IS NULL OR category_rules <> ?", rulesVersion).
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				classify(&batch[i])
+				err := s.Database.Model(&Event{}).Where("id = ?", batch[i].ID).Updates(map[string]interface{}{
+					"category":            batch[i].Category,
+					"category_confidence": batch[i].CategoryConfidence,
+					"category_rules":      batch[i].CategoryRules,
+				}).Error
+				if err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		})
+	return updated, result.Error
+}
@@ -0,0 +1,117 @@
+package DB
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// scrape run states
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+// Counts is a set of named counters kept in one json column
+type Counts map[string]int
+
+func (c Counts) Value() (driver.Value, error) {
+	if len(c) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(map[string]int(c))
+	return string(raw), err
+}
+
+func (c *Counts) Scan(value interface{}) error {
+	var raw []byte
+	switch v := value.(type) {
+	case nil:
+		*c = Counts{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("counts: cant scan %T", value)
+	}
+	counts := Counts{}
+	if err := json.Unmarshal(raw, &counts); err != nil {
+		return err
+	}
+	*c = counts
+	return nil
+}
+
+func (Counts) GormDataType() string {
+	return "text"
+}
+
+// ScrapeRun is what one crawl did, written when it starts and again when it ends
+type ScrapeRun struct {
+	ID         int        `db:"id" json:"id"`
+	Kind       string     `db:"kind" json:"kind"`   // full, lists, seeds, url or recheck
+	Lists      string     `db:"lists" json:"lists"` // seed lists crawled, comma separated
+	Status     string     `db:"status" json:"status" gorm:"index"`
+	Error      string     `db:"error" json:"error,omitempty"`
+	StartedAt  time.Time  `db:"started_at" json:"started_at" gorm:"index"`
+	FinishedAt *time.Time `db:"finished_at" json:"finished_at"`
+	// what was queued: due seeds and detail pages due for a revisit
+	Seeds          int   `db:"seeds" json:"seeds"`
+	DetailRevisits int   `db:"detail_revisits" json:"detail_revisits"`
+	ListingPages   int   `db:"listing_pages" json:"listing_pages"`
+	DetailPages    int   `db:"detail_pages" json:"detail_pages"`
+	Bytes          int64 `db:"bytes" json:"bytes"`
+	// failed requests by kind of failure: not_found, rate_limited, server_error, timeout ...
+	Errors         Counts `db:"errors" json:"errors"`
+	EventsInserted int    `db:"events_inserted" json:"events_inserted"`
+	// pages of events we already had, stored over the existing row of their url
+	EventsUpdated   int    `db:"events_updated" json:"events_updated"`
+	Duplicates      int    `db:"duplicates" json:"duplicates"`
+	GeocodeCalls    int    `db:"geocode_calls" json:"geocode_calls"`
+	SelectorVersion string `db:"selector_version" json:"selector_version"`
+	QualityAlerts   int    `db:"quality_alerts" json:"quality_alerts"`
+}
+
+func (r *ScrapeRun) isEvent() {}
+
+// StartScrapeRun stores a run as it begins, filling in its id
+func (s *Storage) StartScrapeRun(run *ScrapeRun) error {
+	run.Status = RunRunning
+	return s.Database.Create(run).Error
+}
+
+// SaveScrapeRun overwrites the stored run, used for progress and when it finishes
+func (s *Storage) SaveScrapeRun(run *ScrapeRun) error {
+	return s.Database.Save(run).Error
+}
+
+// EventExists reports whether an event was already scraped from url
+func (s *Storage) EventExists(url string) bool {
+	var count int64
+	s.Database.Model(&Event{}).Where("url = ?", url).Limit(1).Count(&count)
+	return count > 0
+}
+
+// ScrapeRuns lists runs, newest first
+func (q *Queries) ScrapeRuns(offset, limit uint) ([]ScrapeRun, error) {
+	var runs []ScrapeRun
+	err := q.db.Select(&runs, "SELECT * FROM scrape_runs ORDER BY id DESC limit ? offset ? ", limit, offset)
+	if err != nil {
+		logger.Error("failed to fetch scrape runs", "err", err)
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (q *Queries) ScrapeRun(id int) (*ScrapeRun, error) {
+	var run ScrapeRun
+	if err := q.db.Get(&run, "SELECT * FROM scrape_runs WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
@@ -0,0 +1,43 @@
+package DB
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScrapeRunRoundTrip(t *testing.T) {
+	db, queries := newTestDB(t)
+	storage := &Storage{Database: db}
+	run := &ScrapeRun{Kind: "lists", Lists: "nj", StartedAt: time.Now(), Seeds: 30}
+	if err := storage.StartScrapeRun(run); err != nil {
+		t.Fatal(err)
+	}
+	finished := time.Now()
+	run.Status, run.FinishedAt = RunSucceeded, &finished
+	run.Errors = Counts{"not_found": 2, "rate_limited": 1}
+	run.DetailPages, run.Bytes = 12, 1<<20
+	if err := storage.SaveScrapeRun(run); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.StartScrapeRun(&ScrapeRun{Kind: "recheck", StartedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := queries.ScrapeRuns(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Kind != "recheck" || runs[0].Status != RunRunning || runs[0].FinishedAt != nil {
+		t.Fatalf("runs = %+v, want the running recheck first", runs)
+	}
+	got, err := queries.ScrapeRun(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != RunSucceeded || got.Errors["not_found"] != 2 || got.Errors["rate_limited"] != 1 || got.Bytes != 1<<20 || got.FinishedAt == nil {
+		t.Errorf("run = %+v", got)
+	}
+	if _, err := queries.ScrapeRun(run.ID + 10); err == nil {
+		t.Error("found a run that doesnt exist")
+	}
+}
@@ -0,0 +1,118 @@
+package DB
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+/*
+Full text search over events. events_fts is an FTS5 external content table that points back at the
+events table, the triggers below keep it in sync on every insert, update and delete so the scraper
+doesnt need to know it exists.
+FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag (the dockerfile and ci pass it),
+without it search is switched off and everything else keeps working
+*/
+
+var ErrSearchUnavailable = errors.New("full text search is not available in this build (missing sqlite_fts5 build tag)")
+
+var searchSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5(
+		title, description, host, tags,
+		content='events', content_rowid='id', tokenize='porter unicode61')`,
+	`CREATE TRIGGER IF NOT EXISTS events_fts_insert AFTER INSERT ON events BEGIN
+		INSERT INTO events_fts(rowid, title, description, host, tags) VALUES (new.id, new.title, new.description, new.host, new.tags);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS events_fts_delete AFTER DELETE ON events BEGIN
+		INSERT INTO events_fts(events_fts, rowid, title, description, host, tags) VALUES ('delete', old.id, old.title, old.description, old.host, old.tags);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS events_fts_update AFTER UPDATE OF title, description, host, tags ON events BEGIN
+		INSERT INTO events_fts(events_fts, rowid, title, description, host, tags) VALUES ('delete', old.id, old.title, old.description, old.host, old.tags);
+		INSERT INTO events_fts(rowid, title, description, host, tags) VALUES (new.id, new.title, new.description, new.host, new.tags);
+	END`,
+}
+
+// ensureSearchIndex creates the fts table and its triggers, and fills the index from the events
+// already in the table the first time it is created
+func ensureSearchIndex(db *gorm.DB) error {
+	var existing int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'events_fts'").Scan(&existing).Error; err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range searchSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				if strings.Contains(err.Error(), "no such module") {
+					return ErrSearchUnavailable
+				}
+				return err
+			}
+		}
+		if existing == 0 {
+			return tx.Exec("INSERT INTO events_fts(events_fts) VALUES ('rebuild')").Error
+		}
+		return nil
+	})
+}
+
+// SearchResult is an event plus how well it matched
+type SearchResult struct {
+	Event
+	Rank    float64 `db:"rank" json:"rank"` // bm25, lower is better
+	Snippet string  `db:"snippet" json:"snippet"`
+	// title with the matched terms wrapped in <mark>
+	TitleHighlight string `db:"title_highlight" json:"title_highlight"`
+}
+
+// MatchQuery turns what the user typed into an fts5 query. Every word becomes a quoted prefix term so
+// punctuation cant break the query syntax and "jaz" still finds jazz
+func MatchQuery(input string) string {
+	words := strings.FieldsFunc(input, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, fmt.Sprintf(`"%s"*`, strings.ToLower(word)))
+	}
+	return strings.Join(terms, " ")
+}
+
+// Search runs a full text query over title, description, host and tags, combined with the filter
+func (q *Queries) Search(text string, filter EventFilter, offset, limit uint) ([]SearchResult, error) {
+	match := MatchQuery(text)
+	if match == "" {
+		return nil, fmt.Errorf("search query %q has no searchable words", text)
+	}
+	where, args := filter.where()
+	// column weights for bm25: title matters most, then host, tags and the description last
+	query := `SELECT events.*,
+			bm25(events_fts, 10.0, 1.0, 5.0, 3.0) AS rank,
+			snippet(events_fts, 1, '<mark>', '</mark>', '…', 16) AS snippet,
+			highlight(events_fts, 0, '<mark>', '</mark>') AS title_highlight
+		FROM events_fts JOIN events ON events.id = events_fts.rowid
+		WHERE events_fts MATCH ? AND ` + where + `
+		ORDER BY rank limit ? offset ? `
+	var results []SearchResult
+	err := q.db.Select(&results, query, append(append([]interface{}{match}, args...), limit, offset)...)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table: events_fts") || strings.Contains(err.Error(), "no such module") {
+			return nil, ErrSearchUnavailable
+		}
+		logger.Error("failed to search events", "err", err)
+		return nil, err
+	}
+	events := make([]Event, len(results))
+	for i := range results {
+		events[i] = results[i].Event
+	}
+	if err := q.attachOccurrences(events, filter); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Occurrences = events[i].Occurrences
+	}
+	return results, nil
+}
@@ -0,0 +1,83 @@
+package DB
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDB sets up a throw away database the same way createDatabaseConnection does
+func newTestDB(t *testing.T) (*gorm.DB, *Queries) {
+	t.Helper()
+	path := t.TempDir() + "/test.db"
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := updateModels(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := sqlx.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return db, &Queries{db: conn}
+}
+
+func TestSearch(t *testing.T) {
+	db, queries := newTestDB(t)
+	if err := ensureSearchIndex(db); errors.Is(err, ErrSearchUnavailable) {
+		t.Skip("built without sqlite_fts5")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	soon := time.Date(2025, 3, 1, 20, 0, 0, 0, time.UTC)
+	later := soon.AddDate(0, 1, 0)
+	events := []Event{
+		{Title: "Jazz Night at the Pony", Description: "Live jazz trio", Host: "Asbury Jazz", Tags: "#Music", StartsAt: &soon},
+		{Title: "Startup Pitch Night", Description: "Founders pitch, jazz band after", Host: "NJ Tech", Tags: "#Tech", StartsAt: &later},
+		{Title: "Pottery Class", Description: "Hands on", Host: "Clay Studio", Tags: "#Arts", StartsAt: &soon},
+	}
+	for i := range events {
+		db.Create(&events[i])
+	}
+	db.Create(&GeoPoint{EventID: events[0].ID, Latitude: 40.22, Longitude: -74.0})
+	db.Create(&GeoPoint{EventID: events[1].ID, Latitude: 40.73, Longitude: -74.17})
+
+	results, err := queries.Search("jaz", EventFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].ID != events[0].ID {
+		t.Fatalf("expected the title match first, got %+v", results)
+	}
+	if !strings.Contains(results[0].TitleHighlight, "<mark>Jazz</mark>") {
+		t.Fatalf("missing highlight in %q", results[0].TitleHighlight)
+	}
+
+	// same query, only events near asbury park
+	near := EventFilter{Near: true, Lat: 40.22, Long: -74.0, RadiusKm: 5}
+	if results, err = queries.Search("jazz", near, 0, 10); err != nil || len(results) != 1 || results[0].ID != events[0].ID {
+		t.Fatalf("location filter: %+v %v", results, err)
+	}
+	from := soon.AddDate(0, 0, 7)
+	if results, err = queries.Search("jazz", EventFilter{From: &from}, 0, 10); err != nil || len(results) != 1 || results[0].ID != events[1].ID {
+		t.Fatalf("date filter: %+v %v", results, err)
+	}
+
+	// the triggers keep the index in sync with updates
+	db.Model(&events[2]).Update("title", "Jazz Pottery")
+	if results, err = queries.Search("pottery", EventFilter{}, 0, 10); err != nil || len(results) != 1 || !strings.Contains(results[0].TitleHighlight, "Jazz") {
+		t.Fatalf("update not indexed: %+v %v", results, err)
+	}
+}
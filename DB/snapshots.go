@@ -0,0 +1,84 @@
+package DB
+
+import (
+	"time"
+)
+
+// Snapshot indexes one fetched page in the html archive. The body itself lives on disk, gzipped,
+// under its sha256 so identical pages are only stored once
+type Snapshot struct {
+	ID        int       `db:"id" json:"id"`
+	URL       string    `db:"url" json:"url" gorm:"index"`
+	Kind      string    `db:"kind" json:"kind" gorm:"index"` // listing or detail
+	Status    int       `db:"status" json:"status"`
+	Headers   string    `db:"headers" json:"headers"` // response headers as json
+	Hash      string    `db:"hash" json:"hash" gorm:"index"`
+	Size      int       `db:"size" json:"size"` // uncompressed
+	FetchedAt time.Time `db:"fetched_at" json:"fetched_at" gorm:"index"`
+}
+
+func (s *Snapshot) isEvent() {}
+
+func (s *Storage) AddSnapshot(snapshot *Snapshot) error {
+	return s.Database.Create(snapshot).Error
+}
+
+// LatestSnapshot returns the most recent capture of url
+func (s *Storage) LatestSnapshot(url string) (*Snapshot, bool) {
+	var snapshot Snapshot
+	result := s.Database.Where("url = ?", url).Order("fetched_at DESC, id DESC").Limit(1).Find(&snapshot)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false
+	}
+	return &snapshot, true
+}
+
+// LatestSnapshots returns the newest capture of every url of the given kind, oldest url first
+func (s *Storage) LatestSnapshots(kind string) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	err := s.Database.Raw(`SELECT * FROM snapshots WHERE id IN (
+			SELECT MAX(id) FROM snapshots WHERE kind = ? GROUP BY url
+		) ORDER BY id`, kind).Scan(&snapshots).Error
+	return snapshots, err
+}
+
+// ResetEvents drops the events scraped from urls and what hangs off them so the archive can rebuild them
+// from scratch. Events from any other url are left alone. Venues and organizers are kept (along with their
+// coordinates) and counted again without the dropped events
+func (s *Storage) ResetEvents(urls []string) error {
+	// sqlite caps the number of parameters a statement takes
+	const chunk = 500
+	for start := 0; start < len(urls); start += chunk {
+		if err := s.resetEvents(urls[start:min(start+chunk, len(urls))]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storage) resetEvents(urls []string) error {
+	var events []Event
+	if err := s.Database.Select("id", "venue_id", "organizer_id").Where("url IN ?", urls).Find(&events).Error; err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	ids := make([]int, len(events))
+	venues, organizers := make([]int, len(events)), make([]int, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+		venues[i] = event.VenueID
+		organizers[i] = event.OrganizerID
+	}
+	if err := s.deleteEventRows(ids); err != nil {
+		return err
+	}
+	if err := s.Database.Exec("DELETE FROM events WHERE id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := s.CountVenueEvents(venues...); err != nil {
+		return err
+	}
+	return s.CountOrganizerEvents(organizers...)
+}
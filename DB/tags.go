@@ -0,0 +1,141 @@
+package DB
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag is one normalized tag, events link to it through EventTag
+type Tag struct {
+	ID   int    `db:"id" json:"id"`
+	Name string `db:"name" json:"name" gorm:"uniqueIndex"`
+}
+
+type EventTag struct {
+	EventID int `db:"event_id" json:"event_id" gorm:"primaryKey;autoIncrement:false"`
+	TagID   int `db:"tag_id" json:"tag_id" gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+type TagCount struct {
+	Name  string `db:"name" json:"name"`
+	Count int    `db:"count" json:"count"`
+}
+
+func (t *Tag) isEvent()      {}
+func (e *EventTag) isEvent() {}
+
+// different spellings that should land on the same tag
+var tagSynonyms = map[string]string{
+	"musical":          "music",
+	"live music":       "music",
+	"concerts":         "concert",
+	"djs":              "dj",
+	"technology":       "tech",
+	"networking event": "networking",
+	"food and drink":   "food & drink",
+	"food drink":       "food & drink",
+	"foodie":           "food & drink",
+	"arts":             "art",
+	"artist":           "art",
+	"kids":             "family",
+	"family friendly":  "family",
+	"comedy show":      "comedy",
+	"standup":          "comedy",
+	"stand up comedy":  "comedy",
+	"virtual":          "online",
+	"online events":    "online",
+	"workshops":        "workshop",
+	"parties":          "party",
+}
+
+var (
+	tagCamelCase = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+	tagSeparator = regexp.MustCompile(`[\s_\-]+`)
+)
+
+// NormalizeTag lower cases the tag, drops the leading hashes Eventbrite puts on them, splits hashtag
+// camel case ("#LiveMusic") and maps known synonyms. Returns "" for tags that are nothing but noise
+func NormalizeTag(raw string) string {
+	tag := strings.TrimSpace(raw)
+	tag = strings.TrimLeft(tag, "#")
+	tag = tagCamelCase.ReplaceAllString(tag, "$1 $2")
+	tag = strings.ToLower(tag)
+	tag = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || r == '&' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, tag)
+	tag = strings.TrimSpace(tagSeparator.ReplaceAllString(tag, " "))
+	if synonym, ok := tagSynonyms[tag]; ok {
+		tag = synonym
+	}
+	return tag
+}
+
+// NormalizeTags normalizes a list of tags and drops empties and duplicates, keeping the original order
+func NormalizeTags(raw []string) []string {
+	seen := make(map[string]bool, len(raw))
+	var tags []string
+	for _, r := range raw {
+		tag := NormalizeTag(r)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// SplitTags undoes the ", " join the scraper stores in Event.Tags
+func SplitTags(joined string) []string {
+	if strings.TrimSpace(joined) == "" {
+		return nil
+	}
+	return strings.Split(joined, ",")
+}
+
+// TagEvent links the event to each of the tags, creating any tag we havent seen yet
+func (s *Storage) TagEvent(eventID int, rawTags []string) error {
+	return tagEvent(s.Database, eventID, rawTags)
+}
+
+func tagEvent(db *gorm.DB, eventID int, rawTags []string) error {
+	tags := NormalizeTags(rawTags)
+	if eventID == 0 || len(tags) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, name := range tags {
+			tag := Tag{Name: name}
+			if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+				return err
+			}
+			link := EventTag{EventID: eventID, TagID: tag.ID}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&link).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backfillEventTags fills event_tags from the comma joined Tags column of rows scraped before the tags table existed
+func backfillEventTags(db *gorm.DB) error {
+	var batch []Event
+	return db.Select("id", "tags").Where("tags <> ''").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		// tx still carries the batch query, the writes need a clean statement on the same connection
+		tx = tx.Session(&gorm.Session{NewDB: true})
+		for _, event := range batch {
+			if err := tagEvent(tx, event.ID, SplitTags(event.Tags)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,55 @@
+package DB
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	raw := []string{"#Music", " music", "#LiveMusic", "Things To Do In Newark", "#nj_events", "Food-and-Drink", "#", "Technology"}
+	want := []string{"music", "things to do in newark", "nj events", "food & drink", "tech"}
+	if got := NormalizeTags(raw); !reflect.DeepEqual(got, want) {
+		t.Fatalf("NormalizeTags(%q)\n got  %q\n want %q", raw, got, want)
+	}
+}
+
+func TestBackfillEventTags(t *testing.T) {
+	db, _ := newTestDB(t)
+	// rows from before the tags table, the backfill hasnt run on them yet
+	events := []Event{{Title: "Jazz Night", Tags: "#Jazz, Live Music"}, {Title: "Pottery", Tags: ""}, {Title: "Food Fair", Tags: "Food-and-Drink,#music"}}
+	for i := range events {
+		db.Create(&events[i])
+	}
+	db.Exec("DELETE FROM schema_migrations")
+
+	applied, err := runMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []string{"0001_backfill_event_tags", "0002_geo_point_location_text", "0003_count_venue_events", "0004_count_organizer_events"}) {
+		t.Fatalf("applied %v", applied)
+	}
+	links := func() map[int][]string {
+		var rows []struct {
+			EventID int
+			Name    string
+		}
+		db.Raw("SELECT event_tags.event_id, tags.name FROM event_tags JOIN tags ON tags.id = event_tags.tag_id ORDER BY event_tags.event_id, tags.name").Scan(&rows)
+		got := map[int][]string{}
+		for _, row := range rows {
+			got[row.EventID] = append(got[row.EventID], row.Name)
+		}
+		return got
+	}
+	want := map[int][]string{events[0].ID: {"jazz", "music"}, events[2].ID: {"food & drink", "music"}}
+	if got := links(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("event tags %v, want %v", got, want)
+	}
+
+	if applied, err := runMigrations(db); err != nil || len(applied) != 0 {
+		t.Fatalf("second run applied %v (%v)", applied, err)
+	}
+	if got := links(); !reflect.DeepEqual(got, want) {
+		t.Errorf("event tags after the second run %v", got)
+	}
+}
@@ -0,0 +1,110 @@
+package DB
+
+import (
+	"math"
+	"strings"
+	"time"
+)
+
+// two listings within this distance of each other are treated as the same building
+const venueMatchRadiusKm = 0.05
+
+const earthRadiusKm = 6371.0
+
+// HaversineKm returns the great circle distance between two points in kilometers
+func HaversineKm(lat1, long1, lat2, long2 float64) float64 {
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLong := toRad(long2 - long1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLong/2)*math.Sin(dLong/2)
+	return 2 * earthRadiusKm * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// ValidCoordinates is false for the -1 placeholders the geocoders hand back on failure
+func ValidCoordinates(lat, long float64) bool {
+	if lat == -1 && long == -1 || lat == -1.1 && long == -1.1 || lat == 1 && long == 1 {
+		return false
+	}
+	return lat >= -90 && lat <= 90 && long >= -180 && long <= 180 && !(lat == 0 && long == 0)
+}
+
+// HasCoordinates reports whether the venue has already been geocoded
+func (v *Venue) HasCoordinates() bool {
+	return ValidCoordinates(v.Latitude, v.Longitude)
+}
+
+// VenueByAddress looks a venue up by its normalized address
+func (s *Storage) VenueByAddress(normalized string) (*Venue, bool) {
+	if normalized == "" {
+		return nil, false
+	}
+	var venue Venue
+	result := s.Database.Where("LOWER(normalized_address) = ?", strings.ToLower(normalized)).Limit(1).Find(&venue)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, false
+	}
+	return &venue, true
+}
+
+// NearestVenue returns the closest venue within radiusKm of the point
+func (s *Storage) NearestVenue(lat, long, radiusKm float64) (*Venue, bool) {
+	if !ValidCoordinates(lat, long) {
+		return nil, false
+	}
+	// cheap bounding box first, then the exact distance in go
+	latDelta, longDelta := boundingBox(lat, radiusKm)
+	var candidates []Venue
+	err := s.Database.Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+		lat-latDelta, lat+latDelta, long-longDelta, long+longDelta).Find(&candidates).Error
+	if err != nil {
+		return nil, false
+	}
+	var best *Venue
+	bestDistance := radiusKm
+	for i := range candidates {
+		d := HaversineKm(lat, long, candidates[i].Latitude, candidates[i].Longitude)
+		if d <= bestDistance {
+			best, bestDistance = &candidates[i], d
+		}
+	}
+	return best, best != nil
+}
+
+// ResolveVenue finds the venue for an address, matching first on the normalized address and then on
+// proximity, and creates one when nothing close enough exists
+func (s *Storage) ResolveVenue(name, normalized string, lat, long float64) *Venue {
+	s.venueMu.Lock()
+	defer s.venueMu.Unlock()
+	if venue, found := s.VenueByAddress(normalized); found {
+		if !venue.HasCoordinates() && ValidCoordinates(lat, long) {
+			venue.Latitude, venue.Longitude, venue.GeocodeFailedAt = lat, long, nil
+			s.Database.Model(venue).Updates(map[string]interface{}{"latitude": lat, "longitude": long, "geocode_failed_at": nil})
+		}
+		return venue
+	}
+	if venue, found := s.NearestVenue(lat, long, venueMatchRadiusKm); found {
+		return venue
+	}
+	venue := &Venue{
+		Name:              name,
+		NormalizedAddress: normalized,
+		Latitude:          lat,
+		Longitude:         long,
+	}
+	s.Database.Create(venue)
+	logger.Debug("created venue", "venue", name, "address", normalized)
+	return venue
+}
+
+// VenueGeocodeFailed records that looking up the coordinates of the venue failed, so the crawl stops
+// asking on every event at it
+func (s *Storage) VenueGeocodeFailed(venueID int) error {
+	return s.Database.Model(&Venue{}).Where("id = ?", venueID).Update("geocode_failed_at", time.Now()).Error
+}
+
+// CountVenueEvents sets the event count of the venues to the events held there, leaving out the ones the
+// dedup pass marked as reposts. Counting instead of adding one per store keeps revisits from inflating it
+func (s *Storage) CountVenueEvents(venueIDs ...int) error {
+	return countEvents(s.Database, "venues", "venue_id", venueIDs)
+}
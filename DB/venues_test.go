@@ -0,0 +1,87 @@
+package DB
+
+import "testing"
+
+func TestResolveVenue(t *testing.T) {
+	db, _ := newTestDB(t)
+	storage := &Storage{Database: db}
+	const lat, long = 40.2204, -73.9987
+
+	pony := storage.ResolveVenue("The Stone Pony", "913 Ocean Ave, Asbury Park, NJ 07712, US", lat, long)
+	if pony.ID == 0 {
+		t.Fatal("venue not created")
+	}
+	if venue, found := storage.VenueByAddress("913 ocean ave, asbury park, nj 07712, us"); !found || venue.ID != pony.ID {
+		t.Errorf("address lookup is case sensitive: %v %v", venue, found)
+	}
+	if _, found := storage.VenueByAddress(""); found {
+		t.Error("an empty address matched a venue")
+	}
+
+	// another spelling of the same building, about 20m away
+	if nearby := storage.ResolveVenue("Stone Pony", "913 Ocean Avenue, Asbury Park", lat+0.0002, long); nearby.ID != pony.ID {
+		t.Errorf("a listing 20m away made venue %d next to %d", nearby.ID, pony.ID)
+	}
+	// a block away is somewhere else
+	if down := storage.ResolveVenue("Wonder Bar", "1213 Ocean Ave, Asbury Park", lat+0.002, long); down.ID == pony.ID {
+		t.Error("a venue 200m away was merged into the stone pony")
+	}
+	if _, found := storage.NearestVenue(lat+0.002, long+0.002, venueMatchRadiusKm); found {
+		t.Error("found a venue outside the radius")
+	}
+
+	// placeholders never match by distance, and are replaced once real coordinates turn up
+	if _, found := storage.NearestVenue(-1, -1, venueMatchRadiusKm); found {
+		t.Error("placeholder coordinates matched a venue")
+	}
+	first := storage.ResolveVenue("Convention Hall", "1300 Ocean Ave, Asbury Park", -1, -1)
+	second := storage.ResolveVenue("Convention Hall", "1300 Ocean Ave, Asbury Park", -1, -1)
+	if first.ID == 0 || first.ID != second.ID {
+		t.Fatalf("the same address without coordinates made venues %d and %d", first.ID, second.ID)
+	}
+	if err := storage.VenueGeocodeFailed(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	located := storage.ResolveVenue("Convention Hall", "1300 Ocean Ave, Asbury Park", 40.2264, -73.9981)
+	if located.ID != first.ID || !located.HasCoordinates() || located.GeocodeFailedAt != nil {
+		t.Errorf("venue after geocoding %+v", located)
+	}
+	var stored Venue
+	db.First(&stored, first.ID)
+	if !stored.HasCoordinates() || stored.GeocodeFailedAt != nil {
+		t.Errorf("stored venue %+v", stored)
+	}
+}
+
+func TestCountVenueEvents(t *testing.T) {
+	db, _ := newTestDB(t)
+	storage := &Storage{Database: db}
+	pony := storage.ResolveVenue("The Stone Pony", "913 Ocean Ave, Asbury Park", 40.2204, -73.9987)
+	hall := storage.ResolveVenue("Convention Hall", "1300 Ocean Ave, Asbury Park", 40.2264, -73.9981)
+	count := func(id int) int {
+		var venue Venue
+		db.First(&venue, id)
+		return venue.EventCount
+	}
+
+	jazz := Event{URL: "https://www.eventbrite.com/e/jazz-1", Title: "Jazz Night", VenueID: pony.ID}
+	for i := 0; i < 3; i++ {
+		// revisits of the same page
+		storage.AddEvent(jazz)
+		storage.CountVenueEvents(pony.ID)
+	}
+	// a repost the dedup pass found
+	storage.AddEvent(Event{URL: "https://www.eventbrite.com/e/jazz-2", Title: "Jazz Night", VenueID: pony.ID, DuplicateOf: 1})
+	storage.CountVenueEvents(pony.ID)
+	if got := count(pony.ID); got != 1 {
+		t.Errorf("stone pony counts %d events, want 1", got)
+	}
+
+	// the page now puts the event somewhere else
+	jazz.VenueID = hall.ID
+	storage.AddEvent(jazz)
+	storage.CountVenueEvents(hall.ID)
+	if pony, hall := count(pony.ID), count(hall.ID); pony != 0 || hall != 1 {
+		t.Errorf("after the move the stone pony counts %d and the hall %d", pony, hall)
+	}
+}
@@ -0,0 +1,333 @@
+package scrape
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+/*
+Offline address parser. Eventbrite hands us the whole location block as one string
+("The Stone Pony913 Ocean AvenueAsbury Park, NJ 07712") so we break it back up into
+its components and build one canonical string that we can dedupe and geocode with.
+No network calls in here, unlike CLeaner.ParseAddress
+*/
+
+type ParsedAddress struct {
+	Venue      string `json:"venue"`
+	Street     string `json:"street"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+}
+
+var (
+	streetSuffixes = map[string]string{
+		"street": "St", "st": "St", "str": "St",
+		"avenue": "Ave", "ave": "Ave", "av": "Ave",
+		"road": "Rd", "rd": "Rd",
+		"boulevard": "Blvd", "blvd": "Blvd",
+		"drive": "Dr", "dr": "Dr",
+		"lane": "Ln", "ln": "Ln",
+		"place": "Pl", "pl": "Pl",
+		"court": "Ct", "ct": "Ct",
+		"parkway": "Pkwy", "pkwy": "Pkwy",
+		"highway": "Hwy", "hwy": "Hwy",
+		"terrace": "Ter", "ter": "Ter",
+		"square": "Sq", "sq": "Sq",
+		"plaza": "Plz", "plz": "Plz",
+		"circle": "Cir", "cir": "Cir",
+		"turnpike": "Tpke", "tpke": "Tpke",
+		"route": "Rte", "rte": "Rte",
+		"way":        "Way",
+		"pike":       "Pike",
+		"alley":      "Aly",
+		"expressway": "Expy",
+	}
+	directions = map[string]string{
+		"north": "N", "n": "N",
+		"south": "S", "s": "S",
+		"east": "E", "e": "E",
+		"west": "W", "w": "W",
+		"northeast": "NE", "ne": "NE",
+		"northwest": "NW", "nw": "NW",
+		"southeast": "SE", "se": "SE",
+		"southwest": "SW", "sw": "SW",
+	}
+	unitWords = map[string]string{
+		"suite": "Ste", "ste": "Ste",
+		"apartment": "Apt", "apt": "Apt",
+		"floor": "Fl", "fl": "Fl",
+		"unit": "Unit",
+		"room": "Rm", "rm": "Rm",
+		"#": "#",
+	}
+	usStates = map[string]string{
+		"alabama": "AL", "alaska": "AK", "arizona": "AZ", "arkansas": "AR", "california": "CA",
+		"colorado": "CO", "connecticut": "CT", "delaware": "DE", "florida": "FL", "georgia": "GA",
+		"hawaii": "HI", "idaho": "ID", "illinois": "IL", "indiana": "IN", "iowa": "IA",
+		"kansas": "KS", "kentucky": "KY", "louisiana": "LA", "maine": "ME", "maryland": "MD",
+		"massachusetts": "MA", "michigan": "MI", "minnesota": "MN", "mississippi": "MS", "missouri": "MO",
+		"montana": "MT", "nebraska": "NE", "nevada": "NV", "new hampshire": "NH", "new jersey": "NJ",
+		"new mexico": "NM", "new york": "NY", "north carolina": "NC", "north dakota": "ND", "ohio": "OH",
+		"oklahoma": "OK", "oregon": "OR", "pennsylvania": "PA", "rhode island": "RI", "south carolina": "SC",
+		"south dakota": "SD", "tennessee": "TN", "texas": "TX", "utah": "UT", "vermont": "VT",
+		"virginia": "VA", "washington": "WA", "west virginia": "WV", "wisconsin": "WI", "wyoming": "WY",
+		"district of columbia": "DC", "puerto rico": "PR",
+	}
+	countries = map[string]string{
+		"us": "US", "usa": "US", "u.s.": "US", "u.s.a.": "US", "united states": "US", "united states of america": "US",
+		"canada": "CA", "ca": "CA",
+		"united kingdom": "GB", "uk": "GB", "gb": "GB", "england": "GB",
+		"mexico": "MX", "mx": "MX",
+		"ireland": "IE", "australia": "AU", "germany": "DE", "france": "FR", "spain": "ES", "italy": "IT",
+		"japan": "JP", "india": "IN", "brazil": "BR", "netherlands": "NL",
+	}
+	stateCodes = func() map[string]bool {
+		codes := make(map[string]bool, len(usStates))
+		for _, code := range usStates {
+			codes[code] = true
+		}
+		return codes
+	}()
+
+	gluedNumber  = regexp.MustCompile(`([A-Za-z][a-z]|\))(\d)`)
+	gluedWord    = regexp.MustCompile(`([a-z0-9\.])([A-Z][a-z])`)
+	spaces       = regexp.MustCompile(`\s+`)
+	postalCodeRe = regexp.MustCompile(`^(\d{5})(?:-\d{4})?$|^([A-Za-z]\d[A-Za-z]\s?\d[A-Za-z]\d)$`)
+	houseNumber  = regexp.MustCompile(`(^|\s)(\d+[A-Za-z]?(?:-\d+)?)\s+\S`)
+)
+
+// ParseAddressOffline splits a raw location string into its components.
+// Anything it cant place is left empty, the caller decides what is good enough.
+func ParseAddressOffline(raw string) ParsedAddress {
+	var p ParsedAddress
+	cleaned := cleanAddressText(raw)
+	if cleaned == "" {
+		return p
+	}
+	var parts []string
+	for _, part := range strings.Split(cleaned, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	// walk backwards: country, then "ST 12345", then city
+	if len(parts) > 1 {
+		if code, ok := countries[strings.ToLower(parts[len(parts)-1])]; ok && !stateNotCountry(parts) {
+			p.Country = code
+			parts = parts[:len(parts)-1]
+		}
+	}
+	if len(parts) > 1 {
+		if state, postal, ok := parseStatePostal(parts[len(parts)-1]); ok {
+			p.State, p.PostalCode = state, postal
+			parts = parts[:len(parts)-1]
+		}
+	}
+	// postal code sometimes gets its own comma ("Newark, NJ, 07102")
+	if p.State == "" && p.PostalCode != "" && len(parts) > 1 {
+		if state, postal, ok := parseStatePostal(parts[len(parts)-1]); ok && postal == "" {
+			p.State = state
+			parts = parts[:len(parts)-1]
+		}
+	}
+	if p.State != "" && p.Country == "" && stateCodes[p.State] {
+		p.Country = "US"
+	}
+
+	switch len(parts) {
+	case 0:
+	case 1:
+		p.Venue, p.Street, p.City = splitVenueStreetCity(parts[0], p.State != "")
+	default:
+		p.City = titleCase(parts[len(parts)-1])
+		rest := strings.Join(parts[:len(parts)-1], ", ")
+		p.Venue, p.Street, _ = splitVenueStreetCity(rest, false)
+	}
+	p.Street = normalizeStreet(p.Street)
+	return p
+}
+
+// Canonical is the form we store, compare and send to the geocoder. The venue name is left out on purpose
+// since the same building shows up under many different spellings of its name.
+func (p ParsedAddress) Canonical() string {
+	var pieces []string
+	if p.Street != "" {
+		pieces = append(pieces, p.Street)
+	}
+	if p.City != "" {
+		pieces = append(pieces, p.City)
+	}
+	region := strings.TrimSpace(p.State + " " + p.PostalCode)
+	if region != "" {
+		pieces = append(pieces, region)
+	}
+	if p.Country != "" {
+		pieces = append(pieces, p.Country)
+	}
+	if len(pieces) == 0 {
+		return p.Venue
+	}
+	return strings.Join(pieces, ", ")
+}
+
+// Empty reports whether nothing at all could be parsed
+func (p ParsedAddress) Empty() bool {
+	return p == ParsedAddress{}
+}
+
+func cleanAddressText(raw string) string {
+	s := strings.TrimSpace(raw)
+	// ChildText glues sibling nodes together, so pry words and numbers back apart
+	s = gluedNumber.ReplaceAllString(s, "$1 $2")
+	s = gluedWord.ReplaceAllString(s, "$1 $2")
+	s = spaces.ReplaceAllString(s, " ")
+	return strings.Trim(s, " ,")
+}
+
+// stateNotCountry reports whether the last part is a two letter code that is as much a state as a country
+// ("CA", "IN", "DE") and sits where the state goes, "Los Angeles, CA" is california. Only a state or postal
+// code in front of it makes it the country ("Toronto, ON M5B 2H1, CA")
+func stateNotCountry(parts []string) bool {
+	last := parts[len(parts)-1]
+	if len(last) != 2 || !stateCodes[strings.ToUpper(last)] {
+		return false
+	}
+	if len(parts) < 3 {
+		return true
+	}
+	_, _, region := parseStatePostal(parts[len(parts)-2])
+	return !region
+}
+
+// parseStatePostal handles "NJ 07712", "New Jersey 07712", "NJ" and "07712"
+func parseStatePostal(part string) (state, postal string, ok bool) {
+	fields := strings.Fields(part)
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	last := fields[len(fields)-1]
+	if len(fields) > 1 && postalCodeRe.MatchString(fields[len(fields)-2]+" "+last) && !postalCodeRe.MatchString(last) {
+		// canadian postal codes have a space in the middle
+		postal = strings.ToUpper(fields[len(fields)-2] + " " + last)
+		fields = fields[:len(fields)-2]
+	} else if postalCodeRe.MatchString(last) {
+		postal = strings.ToUpper(last)
+		fields = fields[:len(fields)-1]
+	}
+	if len(fields) == 0 {
+		return "", postal, postal != ""
+	}
+	name := strings.Join(fields, " ")
+	if code, found := usStates[strings.ToLower(name)]; found {
+		return code, postal, true
+	}
+	if len(name) == 2 && stateCodes[strings.ToUpper(name)] {
+		return strings.ToUpper(name), postal, true
+	}
+	if len(name) == 2 && postal != "" {
+		// province codes and the like
+		return strings.ToUpper(name), postal, true
+	}
+	return "", "", false
+}
+
+// splitVenueStreetCity breaks up a chunk that lost its commas. The street starts at the house number,
+// anything in front of it is the venue and, when hasCity is set, whatever follows the street suffix is the city
+func splitVenueStreetCity(chunk string, hasCity bool) (venue, street, city string) {
+	loc := houseNumber.FindStringSubmatchIndex(chunk)
+	if loc == nil {
+		if hasCity {
+			return "", "", titleCase(chunk)
+		}
+		return strings.Trim(chunk, " ,"), "", ""
+	}
+	venue = strings.Trim(chunk[:loc[4]], " ,")
+	street = strings.TrimSpace(chunk[loc[4]:])
+	if hasCity {
+		words := strings.Fields(street)
+		cut := -1
+		for i := 1; i < len(words); i++ {
+			if _, ok := streetSuffixes[strings.ToLower(strings.Trim(words[i], "."))]; ok {
+				cut = i
+			}
+		}
+		if cut > 0 {
+			end := cut + 1
+			// keep trailing directions / unit numbers with the street ("Main St W", "Ste 200")
+			for end < len(words) {
+				w := strings.ToLower(strings.Trim(words[end], "."))
+				if _, ok := directions[w]; ok {
+					end++
+					continue
+				}
+				if _, ok := unitWords[w]; ok && end+1 < len(words) {
+					end += 2
+					continue
+				}
+				if strings.HasPrefix(w, "#") {
+					end++
+					continue
+				}
+				break
+			}
+			if end < len(words) {
+				street = strings.Join(words[:end], " ")
+				city = titleCase(strings.Join(words[end:], " "))
+			}
+		}
+	}
+	return venue, street, city
+}
+
+// normalizeStreet swaps out the long suffixes and directions for the usual abbreviations
+func normalizeStreet(street string) string {
+	words := strings.Fields(street)
+	for i, word := range words {
+		lower := strings.ToLower(strings.TrimRight(word, ".,"))
+		if i == 0 {
+			// house number
+			words[i] = strings.ToUpper(lower)
+			continue
+		}
+		if short, ok := streetSuffixes[lower]; ok && i > 1 {
+			words[i] = short
+			continue
+		}
+		if short, ok := directions[lower]; ok && (i == 1 || i == len(words)-1) {
+			words[i] = short
+			continue
+		}
+		if short, ok := unitWords[lower]; ok {
+			words[i] = short
+			continue
+		}
+		words[i] = titleWord(lower)
+	}
+	return strings.Join(words, " ")
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		words[i] = titleWord(strings.ToLower(w))
+	}
+	return strings.Join(words, " ")
+}
+
+func titleWord(w string) string {
+	if w == "" {
+		return w
+	}
+	// ordinals and the like stay lower case ("5th")
+	if unicode.IsDigit(rune(w[0])) {
+		return w
+	}
+	r := []rune(w)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
@@ -0,0 +1,82 @@
+package scrape
+
+import "testing"
+
+func TestParseAddressOffline(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		want      ParsedAddress
+		canonical string
+	}{
+		{
+			name:      "glued venue street and city",
+			raw:       "The Stone Pony913 Ocean AvenueAsbury Park, NJ 07712",
+			want:      ParsedAddress{Venue: "The Stone Pony", Street: "913 Ocean Ave", City: "Asbury Park", State: "NJ", PostalCode: "07712", Country: "US"},
+			canonical: "913 Ocean Ave, Asbury Park, NJ 07712, US",
+		},
+		{
+			name:      "comma separated with country",
+			raw:       "Prudential Center, 25 Lafayette Street, Newark, New Jersey 07102, United States",
+			want:      ParsedAddress{Venue: "Prudential Center", Street: "25 Lafayette St", City: "Newark", State: "NJ", PostalCode: "07102", Country: "US"},
+			canonical: "25 Lafayette St, Newark, NJ 07102, US",
+		},
+		{
+			name:      "postal code on its own",
+			raw:       "100 north main street, hoboken, nj, 07030",
+			want:      ParsedAddress{Street: "100 N Main St", City: "Hoboken", State: "NJ", PostalCode: "07030", Country: "US"},
+			canonical: "100 N Main St, Hoboken, NJ 07030, US",
+		},
+		{
+			name:      "suite stays with the street",
+			raw:       "1 Market Plaza Suite 200 Princeton, NJ 08540",
+			want:      ParsedAddress{Street: "1 Market Plz Ste 200", City: "Princeton", State: "NJ", PostalCode: "08540", Country: "US"},
+			canonical: "1 Market Plz Ste 200, Princeton, NJ 08540, US",
+		},
+		{
+			name:      "canadian postal code",
+			raw:       "220 Yonge St, Toronto, ON M5B 2H1, Canada",
+			want:      ParsedAddress{Street: "220 Yonge St", City: "Toronto", State: "ON", PostalCode: "M5B 2H1", Country: "CA"},
+			canonical: "220 Yonge St, Toronto, ON M5B 2H1, CA",
+		},
+		{
+			name:      "state code that is also a country code",
+			raw:       "Hollywood Bowl, 2301 N Highland Ave, Los Angeles, CA",
+			want:      ParsedAddress{Venue: "Hollywood Bowl", Street: "2301 N Highland Ave", City: "Los Angeles", State: "CA", Country: "US"},
+			canonical: "2301 N Highland Ave, Los Angeles, CA, US",
+		},
+		{
+			name:      "city and state code only",
+			raw:       "Fort Wayne, IN",
+			want:      ParsedAddress{City: "Fort Wayne", State: "IN", Country: "US"},
+			canonical: "Fort Wayne, IN, US",
+		},
+		{
+			name:      "country code after the province",
+			raw:       "220 Yonge St, Toronto, ON M5B 2H1, CA",
+			want:      ParsedAddress{Street: "220 Yonge St", City: "Toronto", State: "ON", PostalCode: "M5B 2H1", Country: "CA"},
+			canonical: "220 Yonge St, Toronto, ON M5B 2H1, CA",
+		},
+		{
+			name:      "venue only",
+			raw:       "Online event",
+			want:      ParsedAddress{Venue: "Online event"},
+			canonical: "Online event",
+		},
+		{
+			name: "empty",
+			raw:  "   ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseAddressOffline(tt.raw)
+			if got != tt.want {
+				t.Fatalf("ParseAddressOffline(%q)\n got  %+v\n want %+v", tt.raw, got, tt.want)
+			}
+			if c := got.Canonical(); c != tt.canonical {
+				t.Fatalf("Canonical() = %q, want %q", c, tt.canonical)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package scrape
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gocolly/colly"
+
+	"lite/DB"
+)
+
+/*
+Every page the collectors fetch is kept in the html archive so that when the selectors change we can
+re-run the parsers over what we already have instead of crawling the site again. Bodies are gzipped
+and stored under their sha256 (HTMLArchive/ab/abcdef....html.gz), the snapshots table keeps the url,
+status, headers and fetch time of every capture
+*/
+
+const (
+	archiveFolder   = "HTMLArchive"
+	snapshotListing = "listing"
+	snapshotDetail  = "detail"
+)
+
+type Archive struct {
+	dir string
+	db  *DB.Storage
+}
+
+func NewArchive(dir string, db *DB.Storage) (*Archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating archive folder: %w", err)
+	}
+	return &Archive{dir: dir, db: db}, nil
+}
+
+func (a *Archive) blobPath(hash string) string {
+	return filepath.Join(a.dir, hash[:2], hash+".html.gz")
+}
+
+// Save stores the body (once per distinct content) and records the capture
+func (a *Archive) Save(kind, url string, status int, headers http.Header, body []byte, fetchedAt time.Time) (*DB.Snapshot, error) {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	path := a.blobPath(hash)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := writeGzip(path, body); err != nil {
+			return nil, err
+		}
+	}
+	rawHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &DB.Snapshot{
+		URL:       url,
+		Kind:      kind,
+		Status:    status,
+		Headers:   string(rawHeaders),
+		Hash:      hash,
+		Size:      len(body),
+		FetchedAt: fetchedAt,
+	}
+	return snapshot, a.db.AddSnapshot(snapshot)
+}
+
+func writeGzip(path string, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// write to a temp file first so a crash never leaves a half written blob under a valid hash
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".blob-*")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(tmp)
+	if _, err := zw.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Body returns the uncompressed body stored under hash
+func (a *Archive) Body(hash string) ([]byte, error) {
+	if len(hash) < 2 {
+		return nil, fmt.Errorf("invalid snapshot hash %q", hash)
+	}
+	f, err := os.Open(a.blobPath(hash))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// Record hooks the archive into a collector so everything it fetches, errors included, gets stored
+func (a *Archive) Record(c *colly.Collector, kind string, logger *slog.Logger) {
+	save := func(r *colly.Response) {
+		if r == nil || r.Request == nil || r.StatusCode == 0 {
+			return
+		}
+		var headers http.Header
+		if r.Headers != nil {
+			headers = *r.Headers
+		}
+		if _, err := a.Save(kind, r.Request.URL.String(), r.StatusCode, headers, r.Body, time.Now()); err != nil {
+			logger.Error("archiving page failed", "url", r.Request.URL.String(), "err", err)
+		}
+	}
+	c.OnResponse(save)
+	c.OnError(func(r *colly.Response, _ error) { save(r) })
+}
+
+// Transport serves requests out of the archive instead of the network, using the latest capture of
+// each url. Urls that were never captured get a 404
+func (a *Archive) Transport() http.RoundTripper {
+	return replayTransport(func(req *http.Request) (*http.Response, error) {
+		snapshot, found := a.db.LatestSnapshot(req.URL.String())
+		if !found {
+			return notArchived(req), nil
+		}
+		body, err := a.Body(snapshot.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("reading archived %s: %w", req.URL, err)
+		}
+		return replayResponse(req, snapshot.Status, snapshotHeaders(snapshot), body), nil
+	})
+}
+
+func snapshotHeaders(snapshot *DB.Snapshot) http.Header {
+	headers := http.Header{}
+	if snapshot.Headers != "" {
+		json.Unmarshal([]byte(snapshot.Headers), &headers)
+	}
+	return headers
+}
+
+type replayTransport func(*http.Request) (*http.Response, error)
+
+func (t replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t(req)
+}
+
+func replayResponse(req *http.Request, status int, headers http.Header, body []byte) *http.Response {
+	headers = headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	// the stored body is already decoded
+	headers.Del("Content-Encoding")
+	headers.Set("Content-Length", strconv.Itoa(len(body)))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        headers,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func notArchived(req *http.Request) *http.Response {
+	return replayResponse(req, http.StatusNotFound, http.Header{"Content-Type": {"text/plain"}}, []byte("not in archive"))
+}
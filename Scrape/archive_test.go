@@ -0,0 +1,124 @@
+package scrape
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"lite/DB"
+)
+
+func TestArchiveReplay(t *testing.T) {
+	dir := t.TempDir()
+	db, err := gorm.Open(sqlite.Open(dir+"/archive.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&DB.Snapshot{}); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := NewArchive(dir+"/html", &DB.Storage{Database: db})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "https://www.eventbrite.com/e/jazz-night-123"
+	headers := http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}}
+	old := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := archive.Save(snapshotDetail, url, 200, headers, []byte("<html>old</html>"), old); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := archive.Save(snapshotDetail, url, 200, headers, []byte("<html>new</html>"), old.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := archive.Body(latest.Hash)
+	if err != nil || string(body) != "<html>new</html>" {
+		t.Fatalf("Body() = %q, %v", body, err)
+	}
+
+	client := &http.Client{Transport: archive.Transport()}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(replayed) != "<html>new</html>" {
+		t.Errorf("replay = %d %q, want the latest capture", resp.StatusCode, replayed)
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("replayed body is decoded, Content-Encoding should be dropped")
+	}
+
+	resp, err = client.Get("https://www.eventbrite.com/e/never-fetched")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unarchived url status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestReparseKeepsUnarchivedEvents(t *testing.T) {
+	site := newFakeEventbrite(t)
+	s := newFakeSiteScraper(t, site, "Newark")
+	archive, err := NewArchive(t.TempDir(), s.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.archive = archive
+	archive.Record(s.sideScraper, snapshotDetail, discardLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// scraped before there was an archive, there is nothing to rebuild it from
+	older := DB.Event{Title: "Scraped Before The Archive", URL: site.URL + "/e/older-99"}
+	s.db.Database.Create(&older)
+	s.db.Database.Create(&DB.GeoPoint{EventID: older.ID, Address: "1 Old Rd"})
+
+	// not under a crawl
+	s.active = &activeRun{}
+	if _, err := s.Reparse(); !errors.Is(err, ErrRunInProgress) {
+		t.Errorf("reparsed during a crawl: %v", err)
+	}
+	s.active = nil
+
+	sideScraper := s.sideScraper
+	parsed, err := s.Reparse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.sideScraper != sideScraper || s.offline {
+		t.Error("the reparse left its replay collector or the offline flag behind for the next crawl")
+	}
+	if parsed != 3 {
+		t.Errorf("reparsed %d pages, want 3", parsed)
+	}
+	var events []DB.Event
+	s.db.Database.Order("id").Find(&events)
+	byURL := make(map[string]int)
+	for _, event := range events {
+		byURL[strings.TrimPrefix(event.URL, site.URL)]++
+	}
+	if len(events) != 4 || byURL["/e/older-99"] != 1 || byURL["/e/jazz-night-101"] != 1 {
+		t.Errorf("events after the reparse %v", byURL)
+	}
+	var points int64
+	s.db.Database.Model(&DB.GeoPoint{}).Where("event_id = ?", older.ID).Count(&points)
+	if points != 1 {
+		t.Errorf("the unarchived event lost its geo point")
+	}
+	var venue DB.Venue
+	s.db.Database.Where("name = ?", "Blue Note").First(&venue)
+	if venue.EventCount != 1 {
+		t.Errorf("blue note counts %d events, want 1", venue.EventCount)
+	}
+}
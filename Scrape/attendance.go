@@ -0,0 +1,99 @@
+package scrape
+
+import (
+	"regexp"
+	"strings"
+)
+
+// attendance modes stored on DB.Event
+const (
+	AttendanceInPerson = "in_person"
+	AttendanceOnline   = "online"
+	AttendanceHybrid   = "hybrid"
+)
+
+var (
+	onlineLocation = regexp.MustCompile(`(?i)^\s*(online( event)?|virtual( event)?|online only|livestream)\s*$`)
+	hybridText     = regexp.MustCompile(`(?i)\b(hybrid event|in[- ]person (and|or|&|\+) (online|virtual)|(online|virtual) (and|or|&|\+) in[- ]person|attend (online|virtually) or in[- ]person)\b`)
+
+	// checked in order, the first one mentioned wins
+	streamingPlatforms = []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"Zoom", regexp.MustCompile(`(?i)\bzoom(\.us| meeting| webinar| link)?\b`)},
+		{"Google Meet", regexp.MustCompile(`(?i)\b(google meet|meet\.google\.com)\b`)},
+		{"Microsoft Teams", regexp.MustCompile(`(?i)\b(microsoft teams|ms teams|teams meeting)\b`)},
+		{"YouTube", regexp.MustCompile(`(?i)\b(youtube( live)?|youtu\.be)\b`)},
+		{"Twitch", regexp.MustCompile(`(?i)\btwitch(\.tv)?\b`)},
+		{"Facebook Live", regexp.MustCompile(`(?i)\bfacebook live\b`)},
+		{"Instagram Live", regexp.MustCompile(`(?i)\binstagram live\b`)},
+		{"LinkedIn Live", regexp.MustCompile(`(?i)\blinkedin live\b`)},
+		{"Webex", regexp.MustCompile(`(?i)\bwebex\b`)},
+		{"GoToMeeting", regexp.MustCompile(`(?i)\bgoto ?(meeting|webinar)\b`)},
+		{"Discord", regexp.MustCompile(`(?i)\bdiscord\b`)},
+		{"Crowdcast", regexp.MustCompile(`(?i)\bcrowdcast\b`)},
+		{"StreamYard", regexp.MustCompile(`(?i)\bstreamyard\b`)},
+		{"Hopin", regexp.MustCompile(`(?i)\bhopin\b`)},
+		{"Vimeo", regexp.MustCompile(`(?i)\bvimeo\b`)},
+	}
+)
+
+// detectAttendance works out whether an event happens online, in person or both, and for online and
+// hybrid events which platform it streams on. JSON-LD wins when the page has it, otherwise we go off
+// the location block and the description
+func detectAttendance(ld *jsonLDEvent, location, description, extraInfo string) (mode, platform string) {
+	mode = attendanceFromJSONLD(ld)
+	if mode == "" {
+		switch {
+		case hybridText.MatchString(description) || hybridText.MatchString(extraInfo):
+			mode = AttendanceHybrid
+		case onlineLocation.MatchString(location) || strings.Contains(strings.ToLower(extraInfo), "online event"):
+			mode = AttendanceOnline
+		default:
+			mode = AttendanceInPerson
+		}
+	}
+	if mode == AttendanceInPerson {
+		return mode, ""
+	}
+	return mode, detectPlatform(location + "\n" + description + "\n" + extraInfo)
+}
+
+func attendanceFromJSONLD(ld *jsonLDEvent) string {
+	if ld == nil {
+		return ""
+	}
+	switch {
+	case strings.HasSuffix(ld.AttendanceMode, "MixedEventAttendanceMode"):
+		return AttendanceHybrid
+	case strings.HasSuffix(ld.AttendanceMode, "OnlineEventAttendanceMode"):
+		return AttendanceOnline
+	case strings.HasSuffix(ld.AttendanceMode, "OfflineEventAttendanceMode"):
+		return AttendanceInPerson
+	}
+	var virtual, place bool
+	for _, t := range ld.locationTypes() {
+		virtual = virtual || t == "VirtualLocation"
+		place = place || t == "Place"
+	}
+	switch {
+	case virtual && place:
+		return AttendanceHybrid
+	case virtual:
+		return AttendanceOnline
+	}
+	return ""
+}
+
+// detectPlatform returns the first streaming platform mentioned in the text, "" when none are
+func detectPlatform(text string) string {
+	best, bestAt := "", -1
+	for _, p := range streamingPlatforms {
+		loc := p.pattern.FindStringIndex(text)
+		if loc != nil && (bestAt == -1 || loc[0] < bestAt) {
+			best, bestAt = p.name, loc[0]
+		}
+	}
+	return best
+}
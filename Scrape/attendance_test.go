@@ -0,0 +1,47 @@
+package scrape
+
+import "testing"
+
+func TestDetectAttendance(t *testing.T) {
+	tests := []struct {
+		name                         string
+		ld                           *jsonLDEvent
+		location, description, extra string
+		wantMode, wantPlatform       string
+	}{
+		{
+			name:     "json-ld online",
+			ld:       &jsonLDEvent{AttendanceMode: "https://schema.org/OnlineEventAttendanceMode"},
+			location: "913 Ocean Ave", description: "We will send the Zoom link the day before",
+			wantMode: AttendanceOnline, wantPlatform: "Zoom",
+		},
+		{
+			name:     "json-ld virtual and physical location",
+			ld:       &jsonLDEvent{Location: []byte(`[{"@type":"Place","name":"Hall"},{"@type":"VirtualLocation","url":"https://youtu.be/x"}]`)},
+			wantMode: AttendanceHybrid,
+		},
+		{
+			name:     "online event location text",
+			location: "Online event", description: "Streaming on YouTube Live and Twitch",
+			wantMode: AttendanceOnline, wantPlatform: "YouTube",
+		},
+		{
+			name:     "hybrid from description",
+			location: "25 Lafayette St, Newark, NJ", description: "Join us in-person or online via Microsoft Teams",
+			wantMode: AttendanceHybrid, wantPlatform: "Microsoft Teams",
+		},
+		{
+			name:     "in person never gets a platform",
+			location: "Zoom Bar, 1 Main St, Hoboken, NJ", description: "A night out",
+			wantMode: AttendanceInPerson,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode, platform := detectAttendance(tt.ld, tt.location, tt.description, tt.extra)
+			if mode != tt.wantMode || platform != tt.wantPlatform {
+				t.Fatalf("detectAttendance() = %q, %q, want %q, %q", mode, platform, tt.wantMode, tt.wantPlatform)
+			}
+		})
+	}
+}
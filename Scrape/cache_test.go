@@ -5,11 +5,13 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"lite/config"
 )
 
 // Helper function to set up the test cache
 func setupTestCache() *redCache {
-	cache := newCache()
+	cache := newCache(config.Default().Redis)
 
 	// Assert that the returned object is of type *redCache
 	redCacheInstance, ok := cache.(*redCache)
@@ -165,3 +167,29 @@ func TestRedCache(t *testing.T) {
 		}
 	})
 }
+
+func TestMemoryCacheInspect(t *testing.T) {
+	cache := newMemoryCache()
+	cache.Put("https://example.com/e/1", "seen")
+	cache.IncreaseTTL("https://example.com/e/gone", time.Hour)
+	cache.Put("https://example.com/e/old", "seen")
+	cache.SetTTl("https://example.com/e/old", -time.Second)
+
+	entry, err := cache.Inspect("https://example.com/e/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entry.Found || entry.Value != "seen" || entry.TTL <= linkCooldown-time.Minute || entry.TTL > linkCooldown {
+		t.Errorf("entry = %+v", entry)
+	}
+	if entry, _ := cache.Inspect("https://example.com/e/old"); entry.Found {
+		t.Errorf("expired key found: %+v", entry)
+	}
+	stats, err := cache.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Backend != "memory" || stats.Keys != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
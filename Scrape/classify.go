@@ -0,0 +1,153 @@
+package scrape
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"lite/DB"
+)
+
+/*
+Rule based category classifier. Every rule in the rules file is a keyword that adds weight to one
+category when it shows up in the title, description, tags or extra info of an event. Where the keyword
+shows up matters, a hit in the title counts for more than one buried in the description.
+The rules file is versioned by its hash so events classified with old rules can be found and re-run
+*/
+
+const (
+	categoryRulesFile = "category_rules.csv"
+	uncategorized     = "other"
+	// a keyword repeated all over a description shouldnt drown out everything else
+	maxHitsPerField = 3
+)
+
+var Categories = []string{"music", "tech", "food", "sports", "family", "nightlife", "business", "arts", "online"}
+
+var fieldWeights = map[string]float64{
+	"title":       3,
+	"tags":        2,
+	"description": 1,
+	"extra_info":  1,
+}
+
+type categoryRule struct {
+	category string
+	field    string // one of fieldWeights or "any"
+	pattern  *regexp.Regexp
+	weight   float64
+}
+
+type Classifier struct {
+	rules   []categoryRule
+	Version string // hash of the rules file, stored on every event we classify
+}
+
+// LoadClassifier reads a rules csv with the columns category,field,keyword,weight
+func LoadClassifier(path string) (*Classifier, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading category rules: %w", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(string(raw))).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("parsing category rules %s: %w", path, err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("category rules %s has no rules", path)
+	}
+	known := make(map[string]bool, len(Categories))
+	for _, c := range Categories {
+		known[c] = true
+	}
+	var rules []categoryRule
+	// first row is the header
+	for i, record := range records[1:] {
+		line := i + 2
+		if len(record) != 4 {
+			return nil, fmt.Errorf("%s line %d: expected 4 columns, got %d", path, line, len(record))
+		}
+		category, field, keyword := strings.TrimSpace(record[0]), strings.TrimSpace(record[1]), strings.TrimSpace(record[2])
+		if !known[category] {
+			return nil, fmt.Errorf("%s line %d: unknown category %q", path, line, category)
+		}
+		if _, ok := fieldWeights[field]; !ok && field != "any" {
+			return nil, fmt.Errorf("%s line %d: unknown field %q", path, line, field)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(record[3]), 64)
+		if err != nil || weight <= 0 {
+			return nil, fmt.Errorf("%s line %d: invalid weight %q", path, line, record[3])
+		}
+		if keyword == "" {
+			return nil, fmt.Errorf("%s line %d: empty keyword", path, line)
+		}
+		rules = append(rules, categoryRule{
+			category: category,
+			field:    field,
+			pattern:  regexp.MustCompile(`(?i)(?:^|[^\pL\pN])` + regexp.QuoteMeta(keyword) + `(?:$|[^\pL\pN])`),
+			weight:   weight,
+		})
+	}
+	sum := sha256.Sum256(raw)
+	return &Classifier{rules: rules, Version: hex.EncodeToString(sum[:6])}, nil
+}
+
+// Classify scores the event against every rule and returns the winning category together with a
+// confidence between 0 and 1. Events nothing matched come back as "other" with 0 confidence
+func (c *Classifier) Classify(event DB.Event) (string, float64) {
+	fields := map[string]string{
+		"title":       event.Title,
+		"tags":        event.Tags,
+		"description": event.Description,
+		"extra_info":  event.ExtraInfo,
+	}
+	scores := make(map[string]float64)
+	var total float64
+	for _, rule := range c.rules {
+		for name, text := range fields {
+			if rule.field != "any" && rule.field != name {
+				continue
+			}
+			hits := len(rule.pattern.FindAllStringIndex(text, maxHitsPerField))
+			if hits == 0 {
+				continue
+			}
+			score := float64(hits) * rule.weight * fieldWeights[name]
+			scores[rule.category] += score
+			total += score
+		}
+	}
+	best, bestScore := uncategorized, 0.0
+	// walk Categories rather than the map so ties always go the same way
+	for _, category := range Categories {
+		if scores[category] > bestScore {
+			best, bestScore = category, scores[category]
+		}
+	}
+	if bestScore == 0 {
+		return uncategorized, 0
+	}
+	// share of the total score, damped when the evidence is thin (a single weak hit shouldnt be 100% sure)
+	confidence := (bestScore / total) * (1 - math.Exp(-bestScore/6))
+	return best, math.Round(confidence*100) / 100
+}
+
+// Apply classifies the event in place
+func (c *Classifier) Apply(event *DB.Event) {
+	event.Category, event.CategoryConfidence = c.Classify(*event)
+	event.CategoryRules = c.Version
+}
+
+// Reclassify re-runs the classifier over every event that was classified with a different version of
+// the rules (or never classified at all). Returns how many events were updated
+func Reclassify(db *DB.Storage, c *Classifier) (int, error) {
+	return db.UpdateStaleCategories(c.Version, func(event *DB.Event) {
+		c.Apply(event)
+	})
+}
@@ -0,0 +1,37 @@
+package scrape
+
+import (
+	"testing"
+
+	"lite/DB"
+)
+
+func TestClassify(t *testing.T) {
+	c, err := LoadClassifier("../static_CSV/" + categoryRulesFile)
+	if err != nil {
+		t.Fatalf("LoadClassifier: %v", err)
+	}
+	tests := []struct {
+		name  string
+		event DB.Event
+		want  string
+	}{
+		{"jazz night", DB.Event{Title: "Friday Night Jazz at the Pony", Tags: "#Music, #Jazz"}, "music"},
+		{"hackathon", DB.Event{Title: "Newark Hackathon 2025", Description: "Bring your laptop, developers and designers welcome"}, "tech"},
+		{"webinar", DB.Event{Title: "Intro to Investing", ExtraInfo: "Online event", Description: "Join us on Zoom"}, "online"},
+		{"kids", DB.Event{Title: "Toddler Storytime", Tags: "#Family, #Kids"}, "family"},
+		{"art is not party", DB.Event{Title: "Rooftop Party", Tags: "#Nightlife"}, "nightlife"},
+		{"nothing", DB.Event{Title: "Monthly meeting"}, uncategorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, confidence := c.Classify(tt.event)
+			if got != tt.want {
+				t.Fatalf("Classify() = %s (%.2f), want %s", got, confidence, tt.want)
+			}
+			if confidence < 0 || confidence > 1 {
+				t.Fatalf("confidence %.2f out of range", confidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"lite/DB"
+)
+
+/*
+A crawl can be started, paused, resumed and cancelled while the process keeps running, which is what
+the admin api is built on. Only one crawl runs at a time, whoever starts it (the scheduler, the admin
+api or the command line). Pausing holds every worker before its next page, pages already being fetched
+finish; the crawl's timeout stops counting while it is paused. Cancelling ends the crawl's context,
+the workers stop and the run is stored as cancelled with what it got done
+*/
+
+var (
+	ErrRunInProgress = errors.New("a scrape run is already in progress")
+	ErrNoRun         = errors.New("no scrape run in progress")
+)
+
+// CrawlOptions limits what a crawl visits, the zero value crawls every enabled seed list
+type CrawlOptions struct {
+	// only these seed lists
+	Lists []string `json:"lists,omitempty"`
+	// only these seed urls, they have to be seeds of the (chosen) lists
+	Seeds []string `json:"seeds,omitempty"`
+	// only this one event page, no listing and no revisits
+	URL string `json:"url,omitempty"`
+	// only the event pages due for a revisit
+	Recheck bool `json:"recheck,omitempty"`
+}
+
+func (o CrawlOptions) kind() string {
+	switch {
+	case o.URL != "":
+		return "url"
+	case o.Recheck:
+		return "recheck"
+	case len(o.Seeds) > 0:
+		return "seeds"
+	case len(o.Lists) > 0:
+		return "lists"
+	}
+	return "full"
+}
+
+func (o CrawlOptions) validate() error {
+	if o.URL != "" && (o.Recheck || len(o.Lists) > 0 || len(o.Seeds) > 0) {
+		return fmt.Errorf("a single url crawl cant be limited to lists or seeds")
+	}
+	if o.Recheck && (len(o.Lists) > 0 || len(o.Seeds) > 0) {
+		return fmt.Errorf("a recheck doesnt visit any seeds")
+	}
+	return nil
+}
+
+// activeRun is the state of the crawl in progress
+type activeRun struct {
+	opts   CrawlOptions
+	seeds  []Seed
+	ctx    context.Context
+	cancel context.CancelFunc
+	gate   pauseGate
+	stats  *runStats
+	// set once the workers are up
+	listings    chan string
+	details     chan string
+	listingBusy atomic.Int32
+	detailBusy  atomic.Int32
+	cancelled   atomic.Bool
+}
+
+// pauseGate holds workers while a run is paused
+type pauseGate struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	// closed by pause, so the deadline knows to stop counting
+	pausing chan struct{}
+}
+
+func (g *pauseGate) pause() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused {
+		return false
+	}
+	g.paused = true
+	g.resumed = make(chan struct{})
+	if g.pausing != nil {
+		close(g.pausing)
+		g.pausing = nil
+	}
+	return true
+}
+
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	close(g.resumed)
+	return true
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait returns right away unless the run is paused, then once it is resumed or ctx ends
+func (g *pauseGate) wait(ctx context.Context) error {
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+	resumed := g.resumed
+	g.mu.Unlock()
+	select {
+	case <-resumed:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deadline is a context that ends once the run has been running for timeout, the time it spends paused
+// doesnt count. Its cause is then context.DeadlineExceeded
+func (g *pauseGate) deadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		left := timeout
+		for {
+			g.mu.Lock()
+			if g.paused {
+				resumed := g.resumed
+				g.mu.Unlock()
+				select {
+				case <-resumed:
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+			if g.pausing == nil {
+				g.pausing = make(chan struct{})
+			}
+			pausing := g.pausing
+			g.mu.Unlock()
+
+			started := time.Now()
+			timer := time.NewTimer(left)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				cancel(context.DeadlineExceeded)
+				return
+			case <-pausing:
+				timer.Stop()
+				left -= time.Since(started)
+			}
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// StartRun begins a crawl in the background and returns the id of its scrape run. How it ends is
+// recorded on the run
+func (s *scrape) StartRun(opts CrawlOptions) (int, error) {
+	run, err := s.begin(context.Background(), opts)
+	if err != nil {
+		return 0, err
+	}
+	id := run.stats.run.ID
+	go s.execute(run)
+	return id, nil
+}
+
+func (s *scrape) Pause() error {
+	return s.withRun(func(run *activeRun) error {
+		if !run.gate.pause() {
+			return fmt.Errorf("run is already paused")
+		}
+		s.log.Info("crawl paused")
+		return nil
+	})
+}
+
+func (s *scrape) Resume() error {
+	return s.withRun(func(run *activeRun) error {
+		if !run.gate.resume() {
+			return fmt.Errorf("run isnt paused")
+		}
+		s.log.Info("crawl resumed")
+		return nil
+	})
+}
+
+func (s *scrape) Cancel() error {
+	return s.withRun(func(run *activeRun) error {
+		run.cancelled.Store(true)
+		run.cancel()
+		s.log.Warn("crawl cancelled")
+		return nil
+	})
+}
+
+func (s *scrape) withRun(fn func(*activeRun) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return ErrNoRun
+	}
+	return fn(s.active)
+}
+
+// Progress is a live view of the crawl in progress
+type Progress struct {
+	Running bool   `json:"running"`
+	RunID   int    `json:"run_id,omitempty"`
+	Kind    string `json:"kind,omitempty"`
+	// running, paused or cancelling
+	State     string     `json:"state,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// links waiting in the listing and the detail queue
+	ListingQueue       int       `json:"listing_queue"`
+	DetailQueue        int       `json:"detail_queue"`
+	ListingWorkersBusy int       `json:"listing_workers_busy"`
+	DetailWorkersBusy  int       `json:"detail_workers_busy"`
+	ListingPages       int       `json:"listing_pages"`
+	DetailPages        int       `json:"detail_pages"`
+	PagesPerSecond     float64   `json:"pages_per_second"`
+	Errors             DB.Counts `json:"errors,omitempty"`
+}
+
+func (s *scrape) Progress() Progress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.active
+	if run == nil {
+		return Progress{}
+	}
+	counts := run.stats.snapshot()
+	progress := Progress{
+		Running:            true,
+		RunID:              counts.ID,
+		Kind:               counts.Kind,
+		State:              "running",
+		StartedAt:          &counts.StartedAt,
+		ListingWorkersBusy: int(run.listingBusy.Load()),
+		DetailWorkersBusy:  int(run.detailBusy.Load()),
+		ListingPages:       counts.ListingPages,
+		DetailPages:        counts.DetailPages,
+		Errors:             counts.Errors,
+	}
+	if run.listings != nil {
+		progress.ListingQueue, progress.DetailQueue = len(run.listings), len(run.details)
+	}
+	if elapsed := time.Since(counts.StartedAt).Seconds(); elapsed > 0 {
+		progress.PagesPerSecond = float64(counts.ListingPages+counts.DetailPages) / elapsed
+	}
+	switch {
+	case run.cancelled.Load():
+		progress.State = "cancelling"
+	case run.gate.isPaused():
+		progress.State = "paused"
+	}
+	return progress
+}
@@ -0,0 +1,148 @@
+package scrape
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly"
+
+	"lite/DB"
+	"lite/config"
+)
+
+// waitIdle waits for the crawl in progress to end
+func waitIdle(t *testing.T, s *scrape) {
+	t.Helper()
+	deadline := time.Now().Add(30 * time.Second)
+	for s.Progress().Running {
+		if time.Now().After(deadline) {
+			t.Fatal("crawl didnt end")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPauseAndCancel(t *testing.T) {
+	site := newFakeEventbrite(t)
+	s := newFakeSiteScraper(t, site, "Newark", "Hoboken")
+	s.newCollectors = func() (*colly.Collector, *colly.Collector) {
+		mainPage, sidePage := colly.NewCollector(), colly.NewCollector()
+		configColly(mainPage, s.log, "Main Page Scraper", s.cache, nil)
+		configColly(sidePage, s.log, "Side Page Scraper", s.cache, nil)
+		return mainPage, sidePage
+	}
+
+	// paused before a single worker gets going
+	run, err := s.begin(context.Background(), CrawlOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.gate.pause()
+	done := make(chan error)
+	go func() { done <- s.execute(run) }()
+
+	if _, err := s.StartRun(CrawlOptions{}); !errors.Is(err, ErrRunInProgress) {
+		t.Errorf("second run started: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if progress := s.Progress(); !progress.Running || progress.State != "paused" || progress.Kind != "full" {
+		t.Errorf("progress while paused = %+v", progress)
+	}
+	if hits := site.Hits("/d/nj--newark/all-events/"); hits != 0 {
+		t.Errorf("paused crawl fetched %d listing pages", hits)
+	}
+	if err := s.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Resume(); err == nil {
+		t.Error("resumed a running crawl")
+	}
+	if err := s.Cancel(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cancel(); !errors.Is(err, ErrNoRun) {
+		t.Errorf("cancelling without a crawl: %v", err)
+	}
+	var first DB.ScrapeRun
+	if err := s.db.Database.First(&first, run.stats.run.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if first.Status != DB.RunCancelled || first.FinishedAt == nil {
+		t.Errorf("cancelled run stored as %s, finished %v", first.Status, first.FinishedAt)
+	}
+
+	// a single page, nothing else
+	id, err := s.StartRun(CrawlOptions{URL: site.URL + "/e/jazz-night-101"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitIdle(t, s)
+	var single DB.ScrapeRun
+	if err := s.db.Database.First(&single, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if single.Kind != "url" || single.Status != DB.RunSucceeded || single.DetailPages != 1 || single.ListingPages != 0 || single.EventsInserted != 1 {
+		t.Errorf("single page run %s %s: %d detail and %d listing pages, %d events",
+			single.Kind, single.Status, single.DetailPages, single.ListingPages, single.EventsInserted)
+	}
+}
+
+func TestCrawlOptionsValidation(t *testing.T) {
+	site := newFakeEventbrite(t)
+	s := newFakeSiteScraper(t, site, "Newark")
+	for _, opts := range []CrawlOptions{
+		{URL: site.URL + "/e/jazz-night-101", Lists: []string{"nj"}},
+		{Recheck: true, Seeds: []string{site.URL + "/d/nj--newark/all-events/"}},
+		{Seeds: []string{site.URL + "/d/nj--trenton/all-events/"}},
+		{Lists: []string{"nowhere"}},
+	} {
+		if _, err := s.StartRun(opts); err == nil {
+			t.Errorf("started a crawl with %+v", opts)
+			waitIdle(t, s)
+		}
+	}
+	if s.Progress().Running {
+		t.Error("a rejected crawl left the scraper busy")
+	}
+}
+
+func TestDeadlineStopsWhilePaused(t *testing.T) {
+	var gate pauseGate
+	ctx, cancel := gate.deadline(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	gate.pause()
+	time.Sleep(200 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("the deadline ran out while paused: %v", err)
+	}
+	gate.resume()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the deadline never ran out after the resume")
+	}
+	if cause := context.Cause(ctx); !errors.Is(cause, context.DeadlineExceeded) {
+		t.Errorf("cause %v, want the deadline", cause)
+	}
+}
+
+func TestRunEndsWithFullQueues(t *testing.T) {
+	site := newFakeEventbrite(t)
+	s := newFakeSiteScraper(t, site, "Newark", "Hoboken", "Trenton", "Camden")
+	// the crawl times out before a worker takes a link, and the queues hold one each
+	s.settings.ListingWorkers, s.settings.DetailWorkers, s.settings.QueueSize = 1, 1, 1
+	s.settings.Timeout = config.Duration(time.Nanosecond)
+
+	done := make(chan error)
+	go func() { done <- s.Start() }()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the crawl never finished with its workers gone")
+	}
+}
@@ -0,0 +1,158 @@
+package scrape
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Turns the dates we scrape into real timestamps. The JSON-LD dates are ISO 8601 and easy, the text in
+span.date-info__full-datetime ("Saturday, December 14 · 7 - 10pm EST") is what we fall back on and it
+usually leaves out the year
+*/
+
+var (
+	monthDay  = regexp.MustCompile(`(?i)\b(jan|feb|mar|apr|may|jun|jul|aug|sep|sept|oct|nov|dec)[a-z]*\.?\s+(\d{1,2})(?:st|nd|rd|th)?(?:,?\s+(\d{4}))?`)
+	clockTime = regexp.MustCompile(`(?i)\b(\d{1,2})(?::(\d{2}))?\s*(am|pm)?\b`)
+	zoneAbbr  = regexp.MustCompile(`\b([ECMP][SD]T|UTC|GMT)\b`)
+
+	zoneOffsets = map[string]int{
+		"EST": -5, "EDT": -4,
+		"CST": -6, "CDT": -5,
+		"MST": -7, "MDT": -6,
+		"PST": -8, "PDT": -7,
+		"UTC": 0, "GMT": 0,
+	}
+	months = map[string]time.Month{
+		"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+		"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+		"sep": time.September, "sept": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+	}
+)
+
+// most of what we scrape is on the east coast
+var defaultEventZone = func() *time.Location {
+	if loc, err := time.LoadLocation("America/New_York"); err == nil {
+		return loc
+	}
+	return time.FixedZone("EST", -5*60*60)
+}()
+
+// parseISODate handles the handful of layouts that show up in startDate/endDate
+func parseISODate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	layouts := []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, value, defaultEventZone); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseEventDate reads the start and end out of the listing's date text. now is used to pick the year
+// when the page leaves it out: the first one that doesnt put the event more than a month in the past
+func parseEventDate(text string, now time.Time) (start, end time.Time, ok bool) {
+	text = strings.ReplaceAll(text, "·", " ")
+	dayMatch := monthDay.FindStringSubmatchIndex(text)
+	if dayMatch == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	month := months[strings.ToLower(text[dayMatch[2]:dayMatch[3]])]
+	day, _ := strconv.Atoi(text[dayMatch[4]:dayMatch[5]])
+	year := 0
+	if dayMatch[6] != -1 {
+		year, _ = strconv.Atoi(text[dayMatch[6]:dayMatch[7]])
+	}
+
+	loc := defaultEventZone
+	if zone := zoneAbbr.FindString(text); zone != "" {
+		loc = time.FixedZone(zone, zoneOffsets[zone]*60*60)
+	}
+	if year == 0 {
+		year = now.Year()
+		if time.Date(year, month, day, 0, 0, 0, 0, loc).Before(now.AddDate(0, -1, 0)) {
+			year++
+		}
+	}
+
+	// times come after the date, skip the day of month so it isnt read as an hour
+	rest := text[dayMatch[1]:]
+	endMonth, endDay := month, day
+	var times [][]string
+	if second := monthDay.FindStringSubmatchIndex(rest); second != nil {
+		// multi day: "December 14 · 7pm - December 15 · 2am EST"
+		endMonth = months[strings.ToLower(rest[second[2]:second[3]])]
+		endDay, _ = strconv.Atoi(rest[second[4]:second[5]])
+		times = append(clockTime.FindAllStringSubmatch(rest[:second[0]], 1), clockTime.FindAllStringSubmatch(rest[second[1]:], 1)...)
+	} else {
+		times = clockTime.FindAllStringSubmatch(rest, 2)
+	}
+	startHour, startMin, startMeridiem := 0, 0, ""
+	endHour, endMin, endMeridiem := -1, 0, ""
+	if len(times) > 0 {
+		startHour, startMin, startMeridiem = clockParts(times[0])
+	}
+	if len(times) > 1 {
+		endHour, endMin, endMeridiem = clockParts(times[1])
+	}
+	// "7 - 10pm": the start borrows the end's am/pm
+	if startMeridiem == "" {
+		startMeridiem = endMeridiem
+	}
+	start = time.Date(year, month, day, to24(startHour, startMeridiem), startMin, 0, 0, loc)
+	if endHour >= 0 {
+		endYear := year
+		if endMonth < month {
+			endYear++
+		}
+		end = time.Date(endYear, endMonth, endDay, to24(endHour, endMeridiem), endMin, 0, 0, loc)
+		if end.Before(start) {
+			// runs past midnight
+			end = end.AddDate(0, 0, 1)
+		}
+	}
+	return start, end, true
+}
+
+func clockParts(match []string) (hour, minute int, meridiem string) {
+	hour, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	return hour, minute, strings.ToLower(match[3])
+}
+
+func to24(hour int, meridiem string) int {
+	switch {
+	case meridiem == "pm" && hour < 12:
+		return hour + 12
+	case meridiem == "am" && hour == 12:
+		return 0
+	}
+	return hour
+}
+
+// eventTimes picks the best start/end we have for a page: JSON-LD first, then the date text
+func eventTimes(ld *jsonLDEvent, dateText string, now time.Time) (start, end *time.Time) {
+	if ld != nil {
+		if s, ok := parseISODate(ld.StartDate); ok {
+			start = &s
+			if e, ok := parseISODate(ld.EndDate); ok {
+				end = &e
+			}
+			return start, end
+		}
+	}
+	s, e, ok := parseEventDate(dateText, now)
+	if !ok {
+		return nil, nil
+	}
+	start = &s
+	if !e.IsZero() {
+		end = &e
+	}
+	return start, end
+}
@@ -0,0 +1,48 @@
+package scrape
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseEventDate(t *testing.T) {
+	now := time.Date(2024, time.November, 20, 12, 0, 0, 0, time.UTC)
+	est := time.FixedZone("EST", -5*60*60)
+	tests := []struct {
+		text       string
+		start, end time.Time
+	}{
+		{"Saturday, December 14 · 7 - 10pm EST", time.Date(2024, 12, 14, 19, 0, 0, 0, est), time.Date(2024, 12, 14, 22, 0, 0, 0, est)},
+		{"Friday, January 3 · 9pm - 2am EST", time.Date(2025, 1, 3, 21, 0, 0, 0, est), time.Date(2025, 1, 4, 2, 0, 0, 0, est)},
+		{"December 31 · 8pm - January 1 · 1am EST", time.Date(2024, 12, 31, 20, 0, 0, 0, est), time.Date(2025, 1, 1, 1, 0, 0, 0, est)},
+		{"Sat, Mar 8, 2025 10:30 AM EST", time.Date(2025, 3, 8, 10, 30, 0, 0, est), time.Time{}},
+	}
+	for _, tt := range tests {
+		start, end, ok := parseEventDate(tt.text, now)
+		if !ok {
+			t.Errorf("parseEventDate(%q) failed", tt.text)
+			continue
+		}
+		if !start.Equal(tt.start) || !end.Equal(tt.end) {
+			t.Errorf("parseEventDate(%q) = %v - %v, want %v - %v", tt.text, start, end, tt.start, tt.end)
+		}
+	}
+	if _, _, ok := parseEventDate("Multiple dates", now); ok {
+		t.Errorf("expected no date out of %q", "Multiple dates")
+	}
+}
+
+func TestParseJSONLD(t *testing.T) {
+	blocks := []string{
+		`{"@context":"https://schema.org","@type":"Organization","name":"Org"}`,
+		`[{"@type":["Thing"]},{"@type":"MusicEvent","name":"Jazz","startDate":"2024-12-14T19:00:00-05:00","endDate":"2024-12-14T22:00:00-05:00"}]`,
+	}
+	event, ok := parseJSONLD(blocks)
+	if !ok || event.Name != "Jazz" {
+		t.Fatalf("parseJSONLD() = %+v, %v", event, ok)
+	}
+	start, end := eventTimes(event, "", time.Now())
+	if start == nil || end == nil || start.Hour() != 19 || end.Sub(*start) != 3*time.Hour {
+		t.Fatalf("eventTimes() = %v, %v", start, end)
+	}
+}
@@ -0,0 +1,156 @@
+package scrape
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+
+	"lite/DB"
+)
+
+/*
+Everything we take off an event detail page. parseDetail only reads the html, it doesnt classify,
+geocode or touch the database, so the same page always gives the same DetailPage. That is what the golden
+tests in testdata/detail pin down, change a selector and the diff shows exactly which fields moved
+*/
+
+// DetailPage is one parsed detail page, ready to be stored
+type DetailPage struct {
+	Event       DB.Event        `json:"event"`
+	Info        DB.EventInfo    `json:"info"`
+	Location    DetailLocation  `json:"location"`
+	Organizer   DetailOrganizer `json:"organizer"`
+	Tags        []string        `json:"tags"`
+	Occurrences []DB.Occurrence `json:"occurrences,omitempty"`
+}
+
+type DetailLocation struct {
+	// the exact address when the page has one, otherwise the short location line
+	Text   string        `json:"text"`
+	Exact  bool          `json:"exact"`
+	Parsed ParsedAddress `json:"parsed"`
+}
+
+type DetailOrganizer struct {
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Bio       string `json:"bio"`
+	Followers int    `json:"followers"`
+}
+
+const noRefunds = "No Refunds"
+
+// parseDetail extracts a detail page with the given selectors. now is only used to place dates that leave
+// out the year and to pick the upcoming date of a series
+func parseDetail(h *colly.HTMLElement, sel *SelectorSet, now time.Time) *DetailPage {
+	var addressFound bool
+	var validRefunds bool
+	host := sel.Text(h, fieldHost)
+	date := sel.Text(h, fieldDate)
+	location := sel.Text(h, fieldLocation)
+	exactAddress := sel.Text(h, fieldExactAddress)
+	bio := sel.Text(h, fieldBio)
+	// organizer profiles all live under /o/
+	organizerURL := sel.Text(h, fieldOrganizerURL)
+	followers := parseFollowerCount(sel.Text(h, fieldFollowers))
+	title := sel.Text(h, fieldTitle)
+	imageURL := sel.Text(h, fieldImage)
+	const prefix = "Refund Policy"
+	refundPolicy := sel.Text(h, fieldRefundPolicy)
+	// checks if html has certain structre by checking len of parsed string. if long enough removes prefix and check if the refund policy is listed as no refunds. If it isnt then refund flag is Set to true as this means you must contact host for explicit refunds rules.
+	if len(refundPolicy) >= len(prefix) {
+		policy := refundPolicy[len(prefix):]
+		if policy != noRefunds {
+			validRefunds = true
+		}
+	}
+	descriptionParts := sel.Values(h, fieldDescription)
+	tags := sel.Values(h, fieldTags)
+	var extraInfo [][]string
+	for _, item := range sel.Values(h, fieldExtraInfo) {
+		extraInfo = append(extraInfo, []string{item})
+	}
+
+	// if exact address is present, no need to do geoFinding
+	if exactAddress != "" {
+		location = exactAddress
+		addressFound = true
+	}
+
+	ld, _ := findJSONLDEvent(h)
+	startsAt, endsAt := eventTimes(ld, date, now)
+
+	event := DB.Event{
+		URL:            h.Request.URL.String(),
+		ImageUrl:       imageURL,
+		Host:           host,
+		Title:          title,
+		Date:           date,
+		Location:       location,
+		Description:    strings.Join(descriptionParts, "\n"),
+		Tags:           strings.Join(tags, ", "),
+		ExactAddress:   addressFound,
+		ExtraInfo:      flattenAndJoin(extraInfo), // Store the extracted extra info
+		AcceptsRefunds: validRefunds,
+		StartsAt:       utc(startsAt),
+		EndsAt:         utc(endsAt),
+	}
+	event.AttendanceMode, event.Platform = detectAttendance(ld, location, event.Description, event.ExtraInfo)
+	occurrences := seriesOccurrences(ld, date, sel.Values(h, fieldDatetimes))
+	if len(occurrences) > 0 {
+		next := nextOccurrence(occurrences, now)
+		event.IsSeries = true
+		event.StartsAt, event.EndsAt = &next.StartsAt, next.EndsAt
+	}
+
+	info := DB.EventInfo{
+		HostName: host,
+		Tags:     event.Tags,
+	}
+	if ld != nil && ld.MaximumCapacity > 0 {
+		info.MaxCapacity = int(ld.MaximumCapacity)
+		info.CurrentCapacity = int(ld.MaximumCapacity - ld.RemainingCapacity)
+	}
+
+	return &DetailPage{
+		Event: event,
+		Info:  info,
+		Location: DetailLocation{
+			Text:   location,
+			Exact:  addressFound,
+			Parsed: ParseAddressOffline(location),
+		},
+		Organizer: DetailOrganizer{
+			Name:      host,
+			URL:       organizerURL,
+			Bio:       bio,
+			Followers: followers,
+		},
+		Tags:        tags,
+		Occurrences: occurrences,
+	}
+}
+
+// ParseDetailHTML runs parseDetail over a saved page, as if the side collector had just fetched it from pageURL
+func ParseDetailHTML(pageURL string, body []byte, sel *SelectorSet, now time.Time) (*DetailPage, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	selection := doc.Find("body")
+	if selection.Length() == 0 {
+		return nil, fmt.Errorf("%s has no <body>", pageURL)
+	}
+	resp := &colly.Response{StatusCode: 200, Body: body, Request: &colly.Request{URL: u}}
+	h := colly.NewHTMLElementFromSelectionNode(resp, selection.First(), selection.Nodes[0], 0)
+	return parseDetail(h, sel, now), nil
+}
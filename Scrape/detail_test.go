@@ -0,0 +1,89 @@
+package scrape
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/detail from the current parser")
+
+// TestDetailGolden parses every saved page in testdata/detail and compares the result with the .golden
+// file next to it. After an intended change to the extraction run
+//
+//	go test ./Scrape -run TestDetailGolden -update
+//
+// and review the diff of the golden files
+func TestDetailGolden(t *testing.T) {
+	pages, err := filepath.Glob("testdata/detail/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("no pages in testdata/detail")
+	}
+	selectors, err := LoadSelectors(filepath.Join("..", selectorFolder, eventbriteSelectors))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fixed so dates without a year and the next date of a series dont drift
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, path := range pages {
+		name := strings.TrimSuffix(filepath.Base(path), ".html")
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := ParseDetailHTML("https://www.eventbrite.com/e/"+name, body, selectors, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(page, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			golden := strings.TrimSuffix(path, ".html") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs from %s (run with -update if the change is intended)\n%s", name, golden, firstDifference(want, got))
+			}
+		})
+	}
+}
+
+// firstDifference points at the first line where got and want part ways
+func firstDifference(want, got []byte) string {
+	wantLines := strings.Split(string(want), "\n")
+	gotLines := strings.Split(string(got), "\n")
+	for i := 0; i < len(wantLines) || i < len(gotLines); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,350 @@
+package scrape
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly"
+
+	"lite/DB"
+	"lite/logging"
+)
+
+/*
+A fake eventbrite for running the whole pipeline (seed -> listing -> detail -> DB) inside go test. The
+listing and detail pages are rendered from testdata/fakesite and use the same markup and ld+json the
+real site does, along with the failure modes the crawler has to live with: 404s and 429s on both kinds
+of page. It also answers the geocoding api so nothing leaves the machine
+*/
+
+type fakeEvent struct {
+	Slug          string
+	Type          string
+	Title         string
+	Host          string
+	OrganizerSlug string
+	Followers     string
+	Summary       string
+	DateText      string
+	Start         string
+	End           string
+	Online        bool
+	Venue         string
+	Address       string
+	Extra         []string
+	Description   []string
+	Tags          []string
+	Refunds       string
+}
+
+var fakeEvents = []fakeEvent{
+	{
+		Slug: "jazz-night-101", Type: "MusicEvent", Title: "Jazz Night at the Blue Note",
+		Host: "Newark Jazz Society", OrganizerSlug: "newark-jazz-society-1", Followers: "1.2k",
+		Summary: "An evening of live jazz", DateText: "Saturday, June 1 · 8 - 11pm EDT",
+		Start: "2030-06-01T20:00:00-04:00", End: "2030-06-01T23:00:00-04:00",
+		Venue: "Blue Note", Address: "123 Main St, Newark, NJ 07102",
+		Extra:       []string{"3 hours", "Mobile eTicket"},
+		Description: []string{"Three sets of live jazz.", "Drinks available at the bar."},
+		Tags:        []string{"Jazz", "Live Music"}, Refunds: "Refunds up to 7 days before event",
+	},
+	{
+		Slug: "online-workshop-102", Type: "EducationEvent", Title: "Intro to Watercolor Online",
+		Host: "Paint Along", OrganizerSlug: "paint-along-2", Followers: "340",
+		Summary: "Learn the basics from home", DateText: "Sunday, June 2 · 1 - 3pm EDT",
+		Start: "2030-06-02T13:00:00-04:00", End: "2030-06-02T15:00:00-04:00",
+		Online:      true,
+		Extra:       []string{"2 hours", "Online event"},
+		Description: []string{"Bring your own brushes, we meet on Zoom."},
+		Tags:        []string{"Art", "Workshop"}, Refunds: "No Refunds",
+	},
+	{
+		Slug: "comedy-night-105", Type: "ComedyEvent", Title: "Friday Comedy Showcase",
+		Host: "Laugh Track", OrganizerSlug: "laugh-track-3", Followers: "87",
+		Summary: "Stand up from local comics", DateText: "Friday, June 7 · 9 - 11pm EDT",
+		Start: "2030-06-07T21:00:00-04:00", End: "2030-06-07T23:00:00-04:00",
+		Venue: "The Cellar", Address: "45 Broad St, Newark, NJ 07102",
+		Description: []string{"Five comics, one mic."},
+		Tags:        []string{"Comedy"}, Refunds: "No Refunds",
+	},
+}
+
+// results pages per city, page numbers past the end render an empty list and page 4 is missing
+var fakeListings = map[string][][]string{
+	"nj--newark": {
+		{"jazz-night-101", "online-workshop-102", "gone-103", "busy-104"},
+		{"comedy-night-105", "jazz-night-101"},
+	},
+}
+
+const (
+	fakeLatitude  = 40.7357
+	fakeLongitude = -74.1724
+)
+
+type fakeEventbrite struct {
+	*httptest.Server
+	templates *template.Template
+	mu        sync.Mutex
+	hits      map[string]int
+}
+
+func newFakeEventbrite(t *testing.T) *fakeEventbrite {
+	t.Helper()
+	templates, err := template.ParseGlob("testdata/fakesite/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeEventbrite{templates: templates, hits: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeEventbrite) Hits(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hits[path]
+}
+
+func (f *fakeEventbrite) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.hits[r.URL.Path]++
+	f.mu.Unlock()
+
+	switch path := r.URL.Path; {
+	case path == "/api/geo/geocode":
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `[{"address": %q, "latitude": "%v", "longitude": "%v"}]`, r.URL.Query().Get("address"), fakeLatitude, fakeLongitude)
+	case strings.HasPrefix(path, "/d/"):
+		f.serveListing(w, r)
+	case strings.HasPrefix(path, "/e/"):
+		f.serveDetail(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEventbrite) serveListing(w http.ResponseWriter, r *http.Request) {
+	city := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/d/"), "/all-events/")
+	pages, ok := fakeListings[city]
+	if !ok {
+		// every city we dont know about is rate limited
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+	var page int
+	fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+	if page == 4 {
+		http.NotFound(w, r)
+		return
+	}
+	var events []string
+	if page >= 1 && page <= len(pages) {
+		events = pages[page-1]
+	}
+	f.render(w, "listing.html", map[string]interface{}{"Base": f.URL, "City": city, "Page": page, "Events": events})
+}
+
+func (f *fakeEventbrite) serveDetail(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimPrefix(r.URL.Path, "/e/")
+	if strings.HasPrefix(slug, "busy-") {
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+		return
+	}
+	for _, event := range fakeEvents {
+		if event.Slug == slug {
+			f.render(w, "detail.html", struct {
+				fakeEvent
+				Base string
+			}{event, f.URL})
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+func (f *fakeEventbrite) render(w http.ResponseWriter, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := f.templates.ExecuteTemplate(w, name, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func discardLogger() *slog.Logger {
+	return logging.Discard()
+}
+
+// newFakeSiteScraper wires a scraper the way initScrape does, but against the fake site, a throw away
+// database, an in memory cache and a seed list of only the given cities
+func newFakeSiteScraper(t *testing.T, site *fakeEventbrite, cities ...string) *scrape {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := DB.NewStorage(filepath.Join(dir, "fake.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := "name\n" + strings.Join(cities, "\n") + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "nj.csv"), []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry := `{"source": "eventbrite", "lists": [{"name": "nj", "enabled": true, "file": "nj.csv",
+		"columns": {"city": "name"}, "values": {"state": "nj"}, "url": "{base}/d/{state}--{city}/all-events/"}]}`
+	if err := os.WriteFile(filepath.Join(dir, seedsFile), []byte(registry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	seeds, err := LoadSeeds(filepath.Join(dir, seedsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	classifier, err := LoadClassifier("../static_CSV/" + categoryRulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selectors, err := NewSelectorStore(filepath.Join("..", selectorFolder, eventbriteSelectors))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := discardLogger()
+	cache := newMemoryCache()
+	mainPage, sidePage := colly.NewCollector(), colly.NewCollector()
+	configColly(mainPage, logger, "Main Page Scraper", cache, nil)
+	configColly(sidePage, logger, "Side Page Scraper", cache, nil)
+	cleaner := newAddressCleaner(logger, "fake-key")
+	cleaner.baseURL = site.URL + "/api/geo/geocode"
+
+	s := NewScraper(mainPage, sidePage, logger, cleaner)
+	s.classifier = classifier
+	s.selectors = selectors
+	s.db = db
+	s.cache = cache
+	s.baseURL = site.URL
+	s.seeds = seeds
+	s.frontier = NewFrontier(db)
+	s.reportFolder = dir
+	return s
+}
+
+func TestStartAgainstFakeSite(t *testing.T) {
+	site := newFakeEventbrite(t)
+	s := newFakeSiteScraper(t, site, "Newark", "Hoboken")
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []DB.Event
+	if err := s.db.Database.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	byURL := make(map[string]DB.Event)
+	for _, event := range events {
+		byURL[strings.TrimPrefix(event.URL, site.URL)] = event
+	}
+	if len(events) != 3 || len(byURL) != 3 {
+		t.Fatalf("stored %d events (%v), want the 3 that load", len(events), byURL)
+	}
+
+	jazz, ok := byURL["/e/jazz-night-101"]
+	if !ok {
+		t.Fatalf("jazz night missing, have %v", byURL)
+	}
+	if jazz.Title != "Jazz Night at the Blue Note" || jazz.Host != "Newark Jazz Society" {
+		t.Errorf("jazz title/host = %q / %q", jazz.Title, jazz.Host)
+	}
+	wantStart := time.Date(2030, 6, 2, 0, 0, 0, 0, time.UTC)
+	if jazz.StartsAt == nil || !jazz.StartsAt.Equal(wantStart) {
+		t.Errorf("jazz starts at %v, want %v", jazz.StartsAt, wantStart)
+	}
+	if jazz.Tags != "Jazz, Live Music" || jazz.Category != "music" || !jazz.AcceptsRefunds || !jazz.ExactAddress {
+		t.Errorf("jazz tags %q category %q refunds %v exact address %v", jazz.Tags, jazz.Category, jazz.AcceptsRefunds, jazz.ExactAddress)
+	}
+	if jazz.AttendanceMode != AttendanceInPerson || jazz.VenueID == 0 || jazz.OrganizerID == 0 {
+		t.Errorf("jazz mode %q venue %d organizer %d", jazz.AttendanceMode, jazz.VenueID, jazz.OrganizerID)
+	}
+	var geo DB.GeoPoint
+	if err := s.db.Database.Where("event_id = ?", jazz.ID).First(&geo).Error; err != nil {
+		t.Fatalf("jazz has no geo point: %v", err)
+	}
+	if geo.Latitude != fakeLatitude || geo.Longitude != fakeLongitude || geo.City != "Newark" {
+		t.Errorf("jazz geo point = %+v", geo)
+	}
+
+	online := byURL["/e/online-workshop-102"]
+	if online.AttendanceMode != AttendanceOnline || online.Platform != "Zoom" || online.AcceptsRefunds {
+		t.Errorf("online workshop mode %q platform %q refunds %v", online.AttendanceMode, online.Platform, online.AcceptsRefunds)
+	}
+	var points int64
+	s.db.Database.Model(&DB.GeoPoint{}).Where("event_id = ?", online.ID).Count(&points)
+	if points != 0 {
+		t.Errorf("online event got %d geo points", points)
+	}
+	if comedy := byURL["/e/comedy-night-105"]; comedy.Category != "arts" || comedy.AcceptsRefunds {
+		t.Errorf("comedy category %q refunds %v", comedy.Category, comedy.AcceptsRefunds)
+	}
+
+	// newark turned up 5 event pages, hoboken none. The gone page is dropped, the rate limited one retried tomorrow
+	targets, err := s.db.CrawlTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := make(map[string]DB.CrawlTarget)
+	for _, target := range targets {
+		schedule[strings.TrimPrefix(target.URL, site.URL)] = target
+	}
+	if newark := schedule["/d/nj--newark/all-events/"]; newark.Visits != 1 || newark.Yield != 5 {
+		t.Errorf("newark seed visits %d yield %.1f", newark.Visits, newark.Yield)
+	}
+	if hoboken := schedule["/d/nj--hoboken/all-events/"]; hoboken.EmptyVisits != 1 {
+		t.Errorf("hoboken seed empty visits %d", hoboken.EmptyVisits)
+	}
+	if gone, busy := schedule["/e/gone-103"], schedule["/e/busy-104"]; !gone.NextVisit.After(busy.NextVisit) || busy.NextVisit.Before(time.Now()) {
+		t.Errorf("gone next visit %v, rate limited next visit %v", gone.NextVisit, busy.NextVisit)
+	}
+	if jazz := schedule["/e/jazz-night-101"]; jazz.Visits != 1 || jazz.EventStartsAt == nil {
+		t.Errorf("jazz detail page visits %d starts %v", jazz.Visits, jazz.EventStartsAt)
+	}
+
+	var runs []DB.ScrapeRun
+	if err := s.db.Database.Find(&runs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("recorded %d scrape runs", len(runs))
+	}
+	run := runs[0]
+	if run.Kind != "full" || run.Status != DB.RunSucceeded || run.FinishedAt == nil || run.Seeds != 2 {
+		t.Errorf("run %s %s finished %v seeds %d", run.Kind, run.Status, run.FinishedAt, run.Seeds)
+	}
+	if run.DetailPages != 3 || run.EventsInserted != 3 || run.EventsUpdated != 0 || run.GeocodeCalls == 0 || run.Bytes == 0 {
+		t.Errorf("run counted %d detail pages, %d new and %d updated events, %d geocode calls, %d bytes",
+			run.DetailPages, run.EventsInserted, run.EventsUpdated, run.GeocodeCalls, run.Bytes)
+	}
+	if run.Errors["not_found"] == 0 || run.Errors["rate_limited"] == 0 {
+		t.Errorf("run errors = %v", run.Errors)
+	}
+
+	// every page is fetched once, failures included, and nothing is retried
+	for path, want := range map[string]int{
+		"/d/nj--newark/all-events/":  4,
+		"/d/nj--hoboken/all-events/": 4,
+		"/e/jazz-night-101":          1,
+		"/e/gone-103":                1,
+		"/e/busy-104":                1,
+	} {
+		if got := site.Hits(path); got != want {
+			t.Errorf("%s fetched %d times, want %d", path, got, want)
+		}
+	}
+}
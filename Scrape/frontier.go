@@ -0,0 +1,295 @@
+package scrape
+
+import (
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"lite/DB"
+)
+
+/*
+The frontier decides what a run fetches and in which order, instead of every seed every 24 hours.
+Seeds are worked through by priority: how many new events a visit to them has turned up lately plus a
+bit for the size of the city. A seed keeps finding new events and it comes back every few hours, one
+that keeps coming back empty is pushed out further each time, up to two weeks.
+Detail pages are scheduled by the date of their event: a page found for the first time is always
+fetched, after that the closer the event the more often we look again (times, capacity and
+cancellations change most in the last days) and once it is over we stop
+*/
+
+const (
+	// weight of the latest visit in the moving average of a seed's yield
+	yieldSmoothing = 0.5
+	// what an unvisited seed is assumed to find, so big cities go first on the first run
+	unknownYield = 1.0
+)
+
+// revisit intervals of seeds by yield, the first one the yield reaches applies
+var listingRevisits = []struct {
+	yield float64
+	every time.Duration
+}{
+	{10, 6 * time.Hour},
+	{3, 12 * time.Hour},
+	{1, 24 * time.Hour},
+}
+
+const (
+	// a seed finding less than one new event per visit starts here and doubles per empty visit
+	lowYieldRevisit = 48 * time.Hour
+	maxRevisit      = 14 * 24 * time.Hour
+)
+
+// revisit intervals of detail pages by how far off the event is, the first one that fits applies
+var detailRevisits = []struct {
+	within time.Duration
+	every  time.Duration
+}{
+	{24 * time.Hour, 3 * time.Hour},
+	{7 * 24 * time.Hour, 12 * time.Hour},
+	{30 * 24 * time.Hour, 48 * time.Hour},
+}
+
+const (
+	// events further out than the table, and pages we couldnt read a date from
+	farDetailRevisit = 7 * 24 * time.Hour
+	// past events are left alone, this only keeps them from ever coming due
+	pastDetailRevisit = 365 * 24 * time.Hour
+	// rate limits and server errors, try again with the next day's runs
+	failedDetailRetry = 24 * time.Hour
+)
+
+type Frontier struct {
+	db  *DB.Storage
+	now func() time.Time
+	mu  sync.Mutex
+	// by url
+	targets map[string]*DB.CrawlTarget
+	dirty   map[string]bool
+	// new detail pages each listing has turned up during this run
+	found map[string]int
+	// seeds of the current registry, listings dropped from it stay in the table but never come due
+	seeds map[string]bool
+}
+
+func NewFrontier(db *DB.Storage) *Frontier {
+	return &Frontier{db: db, now: time.Now}
+}
+
+// Load reads the schedule from the database and adds the seeds that arent in it yet
+func (f *Frontier) Load(seeds []Seed) error {
+	targets, err := f.db.CrawlTargets()
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.targets = make(map[string]*DB.CrawlTarget, len(targets)+len(seeds))
+	f.dirty = make(map[string]bool)
+	f.found = make(map[string]int)
+	f.seeds = make(map[string]bool, len(seeds))
+	for i := range targets {
+		f.targets[targets[i].URL] = &targets[i]
+	}
+	for _, seed := range seeds {
+		f.seeds[seed.URL] = true
+		target, ok := f.targets[seed.URL]
+		if !ok {
+			target = &DB.CrawlTarget{URL: seed.URL, Kind: snapshotListing, NextVisit: f.now()}
+			f.targets[seed.URL] = target
+		}
+		// the csv may have a newer count
+		if !ok || target.Population != seed.Population {
+			target.Population = seed.Population
+			f.dirty[seed.URL] = true
+		}
+	}
+	return nil
+}
+
+// DueListings are the seeds that are due, most promising first
+func (f *Frontier) DueListings() []string {
+	return f.due(snapshotListing, func(a, b *DB.CrawlTarget) bool {
+		if pa, pb := listingPriority(a), listingPriority(b); pa != pb {
+			return pa > pb
+		}
+		return a.URL < b.URL
+	})
+}
+
+// DueDetails are the known detail pages that are due for another look, soonest event first
+func (f *Frontier) DueDetails() []string {
+	return f.due(snapshotDetail, func(a, b *DB.CrawlTarget) bool {
+		if a.EventStartsAt != nil && b.EventStartsAt != nil && !a.EventStartsAt.Equal(*b.EventStartsAt) {
+			return a.EventStartsAt.Before(*b.EventStartsAt)
+		}
+		if (a.EventStartsAt != nil) != (b.EventStartsAt != nil) {
+			return a.EventStartsAt != nil
+		}
+		return a.URL < b.URL
+	})
+}
+
+func (f *Frontier) due(kind string, less func(a, b *DB.CrawlTarget) bool) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	var due []*DB.CrawlTarget
+	for _, target := range f.targets {
+		if kind == snapshotListing && !f.seeds[target.URL] {
+			continue
+		}
+		if target.Kind == kind && !target.NextVisit.After(now) {
+			due = append(due, target)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return less(due[i], due[j]) })
+	urls := make([]string, len(due))
+	for i, target := range due {
+		urls[i] = target.URL
+	}
+	return urls
+}
+
+func listingPriority(t *DB.CrawlTarget) float64 {
+	yield := t.Yield
+	if t.Visits == 0 {
+		yield = unknownYield
+	}
+	return yield + math.Log10(float64(t.Population)+1)/2
+}
+
+// Found is called for every event link on a listing page. It counts the link towards the listing's
+// yield when it is new and tells whether the detail page should be fetched now
+func (f *Frontier) Found(listing, detail string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, ok := f.targets[detail]
+	if !ok {
+		f.targets[detail] = &DB.CrawlTarget{URL: detail, Kind: snapshotDetail, NextVisit: f.now()}
+		f.dirty[detail] = true
+		f.found[listingKey(listing)]++
+		return true
+	}
+	return !target.NextVisit.After(f.now())
+}
+
+// ListingVisited reschedules a seed from how many new events this visit turned up
+func (f *Frontier) ListingVisited(listing string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, ok := f.targets[listing]
+	if !ok {
+		return
+	}
+	found := float64(f.found[listing])
+	delete(f.found, listing)
+	if target.Visits == 0 {
+		target.Yield = found
+	} else {
+		target.Yield = yieldSmoothing*found + (1-yieldSmoothing)*target.Yield
+	}
+	if found == 0 {
+		target.EmptyVisits++
+	} else {
+		target.EmptyVisits = 0
+	}
+	now := f.now()
+	target.Visits++
+	target.LastVisit = &now
+	target.NextVisit = now.Add(listingRevisit(target.Yield, target.EmptyVisits))
+	f.dirty[listing] = true
+}
+
+func listingRevisit(yield float64, emptyVisits int) time.Duration {
+	for _, step := range listingRevisits {
+		if yield >= step.yield {
+			return step.every
+		}
+	}
+	every := lowYieldRevisit
+	for i := 1; i < emptyVisits && every < maxRevisit; i++ {
+		every *= 2
+	}
+	return min(every, maxRevisit)
+}
+
+// DetailVisited reschedules a detail page by the date of its event
+func (f *Frontier) DetailVisited(detail string, startsAt *time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, ok := f.targets[detail]
+	if !ok {
+		// reached some other way than a listing, a due page or a redirect
+		target = &DB.CrawlTarget{URL: detail, Kind: snapshotDetail}
+		f.targets[detail] = target
+	}
+	now := f.now()
+	target.Visits++
+	target.LastVisit = &now
+	target.EventStartsAt = startsAt
+	target.NextVisit = now.Add(detailRevisit(startsAt, now))
+	f.dirty[detail] = true
+}
+
+// DetailFailed reschedules a detail page that couldnt be fetched, one that is gone is never tried again
+func (f *Frontier) DetailFailed(detail string, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target, ok := f.targets[detail]
+	if !ok {
+		return
+	}
+	every := failedDetailRetry
+	if status == http.StatusNotFound || status == http.StatusGone {
+		every = pastDetailRevisit
+	}
+	target.NextVisit = f.now().Add(every)
+	f.dirty[detail] = true
+}
+
+func detailRevisit(startsAt *time.Time, now time.Time) time.Duration {
+	if startsAt == nil {
+		return farDetailRevisit
+	}
+	until := startsAt.Sub(now)
+	if until < 0 {
+		return pastDetailRevisit
+	}
+	for _, step := range detailRevisits {
+		if until <= step.within {
+			return step.every
+		}
+	}
+	return farDetailRevisit
+}
+
+// Save writes what changed during the run back to the database
+func (f *Frontier) Save() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changed := make([]*DB.CrawlTarget, 0, len(f.dirty))
+	for u := range f.dirty {
+		changed = append(changed, f.targets[u])
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].URL < changed[j].URL })
+	if err := f.db.SaveCrawlTargets(changed); err != nil {
+		return err
+	}
+	f.dirty = make(map[string]bool)
+	return nil
+}
+
+// listingKey maps a results page (?page=2) back to the seed it belongs to
+func listingKey(page string) string {
+	u, err := url.Parse(page)
+	if err != nil {
+		return page
+	}
+	u.RawQuery = ""
+	return u.String()
+}
@@ -0,0 +1,104 @@
+package scrape
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"lite/DB"
+)
+
+func TestFrontierSchedule(t *testing.T) {
+	db, err := DB.NewStorage(filepath.Join(t.TempDir(), "frontier.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2030, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	seeds := []Seed{
+		{URL: "http://fake/d/nj--hoboken/", Population: 50000},
+		{URL: "http://fake/d/nj--newark/", Population: 277140},
+		{URL: "http://fake/d/nj--dead/", Population: 900},
+	}
+	frontier := NewFrontier(db)
+	frontier.now = clock
+	if err := frontier.Load(seeds); err != nil {
+		t.Fatal(err)
+	}
+	// nothing known yet, the biggest city goes first
+	if got := frontier.DueListings(); !reflect.DeepEqual(got, []string{seeds[1].URL, seeds[0].URL, seeds[2].URL}) {
+		t.Fatalf("first run order = %v", got)
+	}
+
+	soon := now.Add(5 * time.Hour)
+	for i := 0; i < 12; i++ {
+		detail := "http://fake/e/hoboken-" + string(rune('a'+i))
+		if !frontier.Found(seeds[0].URL+"?page=1", detail) {
+			t.Fatalf("new detail page %s not fetched", detail)
+		}
+	}
+	frontier.Found(seeds[1].URL+"?page=2", "http://fake/e/newark-a")
+	frontier.DetailVisited("http://fake/e/newark-a", &soon)
+	frontier.DetailVisited("http://fake/e/hoboken-a", nil)
+	frontier.DetailFailed("http://fake/e/hoboken-b", 404)
+	frontier.DetailFailed("http://fake/e/hoboken-c", 429)
+	// seen on another listing the same run, it is known now
+	if frontier.Found(seeds[1].URL+"?page=1", "http://fake/e/hoboken-a") {
+		t.Error("a page visited this run is fetched again")
+	}
+	for _, seed := range seeds {
+		frontier.ListingVisited(seed.URL)
+	}
+	if err := frontier.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next run reads the schedule back, with newark dropped from the seed list
+	later := NewFrontier(db)
+	later.now = clock
+	if err := later.Load([]Seed{seeds[0], seeds[2]}); err != nil {
+		t.Fatal(err)
+	}
+	targets := later.targets
+	checks := map[string]time.Duration{
+		seeds[0].URL:              6 * time.Hour, // 12 new events
+		seeds[1].URL:              24 * time.Hour,
+		seeds[2].URL:              lowYieldRevisit,
+		"http://fake/e/newark-a":  3 * time.Hour,
+		"http://fake/e/hoboken-a": farDetailRevisit,
+		"http://fake/e/hoboken-b": pastDetailRevisit,
+		"http://fake/e/hoboken-c": failedDetailRetry,
+		"http://fake/e/hoboken-d": 0, // found but never fetched, still due
+	}
+	for url, want := range checks {
+		target, ok := targets[url]
+		if !ok {
+			t.Errorf("%s not saved", url)
+			continue
+		}
+		if got := target.NextVisit.Sub(now); got != want {
+			t.Errorf("%s next visit in %v, want %v", url, got, want)
+		}
+	}
+
+	now = now.Add(7 * time.Hour)
+	if got := later.DueListings(); !reflect.DeepEqual(got, []string{seeds[0].URL}) {
+		t.Errorf("due seeds after 7 hours = %v, want only hoboken", got)
+	}
+	if got := later.DueDetails(); len(got) != 10 || got[0] != "http://fake/e/newark-a" {
+		t.Errorf("due detail pages = %v, want newark-a first and the 9 never fetched", got)
+	}
+}
+
+func TestListingBackoff(t *testing.T) {
+	want := []time.Duration{lowYieldRevisit, lowYieldRevisit, 4 * 24 * time.Hour, 8 * 24 * time.Hour, maxRevisit, maxRevisit}
+	for empty, every := range want {
+		if got := listingRevisit(0, empty); got != every {
+			t.Errorf("%d empty visits: revisit in %v, want %v", empty, got, every)
+		}
+	}
+	if got := listingRevisit(3.5, 4); got != 12*time.Hour {
+		t.Errorf("yield 3.5 revisits in %v", got)
+	}
+}
@@ -2,15 +2,16 @@ package scrape
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
+
+	"lite/DB"
+	"lite/secrets"
 )
 
 /*
@@ -19,12 +20,7 @@ This will be handled using batch jobs. Every couple of seconds or minutes we ite
 Very simple
 Keep everything general and only accpet interfaces as we will be changing out our datastores as we continue to tesr
 */
-var (
-	once     sync.Once
-	instance *Geocoder
-	apikey   = "6740b9d3ea16b460848865roa6225f6" //
-	baseUrl  = "https://geocode.maps.co/search"  //
-)
+var baseUrl = "https://geocode.maps.co/search"
 
 type GeoAPIResponse []struct {
 	PlaceID     int      `json:"place_id"`
@@ -67,23 +63,19 @@ func (g *Geocoder) streetToCordinates(address string) (float64, float64, error)
 	requestURL := fmt.Sprintf("%s?q=%s&api_key=%s", g.baseUrl, address, g.apiKey)
 	response, err := http.Get(requestURL)
 	if err != nil {
-		fmt.Println(err)
+		return -1, -1, secrets.RedactError(err)
 	}
 	defer response.Body.Close()
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		fmt.Println(err)
+		return -1, -1, err
 	}
 	if response.StatusCode != 200 {
 		var geoAPIError GeoAPI
-		err = json.Unmarshal(body, &geoAPIError)
-		if err != nil {
-			fmt.Println(err)
+		if err := json.Unmarshal(body, &geoAPIError); err != nil {
+			return -1, -1, fmt.Errorf("geocoding api returned %s", response.Status)
 		}
-		response := fmt.Sprintf("Api Response %s , api Code %d", geoAPIError.Message, geoAPIError.Code)
-		fmt.Println(response)
-		fmt.Printf("Error: %s\n", geoAPIError.Message)
-		return -1, -1, errors.New(geoAPIError.Message)
+		return -1, -1, fmt.Errorf("geocoding api returned %s, code %d: %s", response.Status, geoAPIError.Code, geoAPIError.Message)
 	}
 	if len(body) < 10 {
 		return -1, -1, fmt.Errorf("api service doesnt have geocoding for this street")
@@ -95,12 +87,10 @@ func (g *Geocoder) streetToCordinates(address string) (float64, float64, error)
 	}
 	Latitude, err := strconv.ParseFloat(geoAPIResponse[0].Lat, 64)
 	if err != nil {
-		fmt.Println("Error converting string to float64:", err)
 		return -1, -1, fmt.Errorf("error converting string latidude to float64: %v", err)
 	}
 	longitude, err := strconv.ParseFloat(geoAPIResponse[0].Lon, 64)
 	if err != nil {
-		fmt.Println("Error converting string to float64:", err)
 		return -1, -1, fmt.Errorf("error converting string longitude to float64: %v", err)
 	}
 	return Latitude, longitude, nil
@@ -113,16 +103,7 @@ func (g *Geocoder) removePunctuation(input string) string {
 	return re.ReplaceAllString(input, "")
 }
 
-func geoCoderInstance() *Geocoder {
-	once.Do(func() {
-		instance = newGeoCoder(apikey, baseUrl)
-	})
-	return instance
-}
-
-var (
-	gelokyApiKey string = "xZhll25Ktga6TpfHAd1uZMjZqrF06oWq"
-)
+var gelokyURL = "https://geloky.com/api/geo/geocode"
 
 type geoResponse struct {
 	Address   string      `json:"address"`
@@ -155,70 +136,130 @@ func (s *StringOrInt) UnmarshalJSON(data []byte) error {
 }
 
 type addressCleaner struct {
-	logger *log.Logger
+	logger *slog.Logger
+	// geocoding endpoint, tests point it at a local server
+	baseURL string
+	// without a key there is no geocoding, the placeholders are stored and the backfill fills them in later
+	apiKey string
 }
 
-func newAddressCleaner(l *log.Logger) *addressCleaner {
+func newAddressCleaner(l *slog.Logger, apiKey string) *addressCleaner {
 	return &addressCleaner{
-		logger: l,
+		logger:  l,
+		baseURL: gelokyURL,
+		apiKey:  apiKey,
 	}
 }
 
 // The caller of this function must handle checking for empty values
 func (a *addressCleaner) ReverseGeoCode(streetName string) EventLocation {
-	if streetName == "" {
+	if streetName == "" || a.apiKey == "" {
 		return EventLocation{
 			Address:   "",
 			Latitude:  -1,
 			Longitude: -1,
 		}
 	}
-	apiResponse := streetToCord(streetName, a.logger)
+	apiResponse := streetToCord(a.baseURL, a.apiKey, streetName, a.logger)
 	return geoReponseParse(apiResponse, a.logger)
 }
 
-func streetToCord(streetName string, logger *log.Logger) geoResponse {
+func streetToCord(baseURL, apiKey, streetName string, logger *slog.Logger) geoResponse {
 	defualtResponse := geoResponse{Address: "", Latitude: "1", Longitude: "1"}
 	escapedStreet := strings.ReplaceAll(streetName, " ", "%20")
-	url := fmt.Sprintf("https://geloky.com/api/geo/geocode?address=%s&key=%s&format=geloky", escapedStreet, gelokyApiKey)
-	fmt.Println("GeoCode api endpoint : ", url)
+	url := fmt.Sprintf("%s?address=%s&key=%s&format=geloky", baseURL, escapedStreet, apiKey)
+	// the key is in the url, it never goes into a log
+	logged := secrets.RedactURL(url)
 	resp, err := http.Get(url)
 	if err != nil {
-		fmt.Printf("HTTP Get error %e \n", err)
+		logger.Error("geocoding request failed", "address", streetName, "err", secrets.RedactError(err))
 		return defualtResponse
 	}
 	defer resp.Body.Close()
-	fmt.Println(resp.StatusCode)
+	logger.Debug("geocoded", "url", logged, "status", resp.StatusCode)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Println("io read error ", err)
+		logger.Error("reading the geocoding response failed", "url", logged, "err", err)
 		return defualtResponse
 	}
 	var location []geoResponse
 	err = json.Unmarshal(body, &location)
 	if err != nil {
-		fmt.Printf("error unmarshaling response %e , current geoReponse %v \n", err, location)
+		logger.Error("geocoding response isnt json", "url", logged, "err", err)
 		return defualtResponse
 	}
 
 	if len(location) < 1 {
-		logger.Printf("Invalid Response url: %s  response json %v\n", url, location)
+		logger.Warn("geocoding found nothing", "url", logged)
+		return defualtResponse
 	}
 	instance := location[0]
 	return instance
 }
 
-func geoReponseParse(g geoResponse, logger *log.Logger) EventLocation {
+func geoReponseParse(g geoResponse, logger *slog.Logger) EventLocation {
 	// In case where geoResponse passed to this isn't valid, use default values
 	lat, err := strconv.ParseFloat(string(g.Latitude), 64)
 	if err != nil {
 		lat = -1
-		logger.Println("Error parsing lat value", err)
+		logger.Debug("geocoding response has no latitude", "err", err)
 	}
 	long, err := strconv.ParseFloat(string(g.Longitude), 64)
 	if err != nil {
 		long = -1
-		logger.Println("Error parsing long value", err)
+		logger.Debug("geocoding response has no longitude", "err", err)
 	}
 	return EventLocation{Address: g.Address, Latitude: lat, Longitude: long}
 }
+
+// BackfillGeocodes looks up the coordinates of up to limit venues and addresses that were stored without
+// any (the geocoder failed, or the run was offline), venues first. Returns how many it filled in
+func (s *scrape) BackfillGeocodes(limit int) (int, error) {
+	venues, err := s.db.UngeocodedVenues(limit)
+	if err != nil {
+		return 0, err
+	}
+	filled := 0
+	for _, venue := range venues {
+		location := s.addressCleaner.ReverseGeoCode(venue.NormalizedAddress)
+		if !DB.ValidCoordinates(location.Latitude, location.Longitude) {
+			s.log.Info("still no coordinates for venue", "venue_id", venue.ID, "address", venue.NormalizedAddress)
+			if err := s.db.VenueGeocodeFailed(venue.ID); err != nil {
+				return filled, err
+			}
+			continue
+		}
+		if err := s.db.SetVenueCoordinates(venue.ID, location.Latitude, location.Longitude); err != nil {
+			return filled, err
+		}
+		filled++
+	}
+	if limit -= len(venues); limit <= 0 {
+		return filled, nil
+	}
+	points, err := s.db.UngeocodedGeoPoints(limit)
+	if err != nil {
+		return filled, err
+	}
+	// many events share the same city line, ask once per address
+	looked := make(map[string]EventLocation)
+	for _, point := range points {
+		address := point.Canonical
+		if address == "" {
+			address = point.Address
+		}
+		location, ok := looked[address]
+		if !ok {
+			location = s.addressCleaner.ReverseGeoCode(address)
+			looked[address] = location
+		}
+		if !DB.ValidCoordinates(location.Latitude, location.Longitude) {
+			continue
+		}
+		if err := s.db.SetGeoPointCoordinates(point.ID, location.Latitude, location.Longitude); err != nil {
+			return filled, err
+		}
+		filled++
+	}
+	return filled, nil
+}
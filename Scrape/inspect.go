@@ -0,0 +1,141 @@
+package scrape
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gocolly/colly"
+
+	"lite/DB"
+)
+
+/*
+When an event shows up parsed wrong we want to see what the scraper makes of that one page right now.
+ScrapeURL fetches a single detail page with a collector set up the way the crawl's side collector is
+(same transport, request logging, archive) and runs it through the same parser, then reports the
+result along with the selector every field came from, so a broken selector or a fallback kicking in is
+plain to see. It only writes the event when asked to, and never touches the crawl frontier
+*/
+
+var ErrNotSitePage = errors.New("not a page of the scraped site")
+
+// Inspection is one detail page as the scraper sees it
+type Inspection struct {
+	URL             string       `json:"url"`
+	Status          int          `json:"status"`
+	SelectorVersion string       `json:"selector_version"`
+	Event           DB.Event     `json:"event"`
+	Info            DB.EventInfo `json:"info"`
+	// nil for online events. Unless stored, the coordinates are only filled in for venues we already know
+	GeoPoint *DB.GeoPoint `json:"geo_point"`
+	// the selector each detail field was taken from
+	Fields map[string]FieldMatch `json:"fields"`
+	// the page has schema.org event data, which the dates, attendance mode and capacity prefer over the selectors
+	JSONLD bool `json:"json_ld"`
+	Stored bool `json:"stored"`
+}
+
+// ScrapeURL fetches and parses one detail page of the site, storing the event when store is set
+func (s *scrape) ScrapeURL(pageURL string, store bool) (*Inspection, error) {
+	if err := s.checkSiteURL(pageURL); err != nil {
+		return nil, err
+	}
+	c := s.inspectCollector()
+	sel := s.selectors.Current()
+	var inspection *Inspection
+	var page *DetailPage
+	c.OnHTML("body", func(h *colly.HTMLElement) {
+		page = parseDetail(h, sel, time.Now())
+		_, jsonLD := findJSONLDEvent(h)
+		inspection = &Inspection{
+			URL:             h.Request.URL.String(),
+			Status:          h.Response.StatusCode,
+			SelectorVersion: sel.Version,
+			Fields:          make(map[string]FieldMatch, len(detailFields)),
+			JSONLD:          jsonLD,
+		}
+		for _, field := range detailFields {
+			inspection.Fields[field] = sel.Match(h, field)
+		}
+	})
+	var status int
+	c.OnResponse(func(r *colly.Response) { status = r.StatusCode })
+	var fetchErr error
+	c.OnError(func(r *colly.Response, err error) { status, fetchErr = r.StatusCode, err })
+	if err := c.Visit(pageURL); err != nil && fetchErr == nil {
+		fetchErr = err
+	}
+	if fetchErr != nil {
+		return nil, fmt.Errorf("fetching %s (status %d): %w", pageURL, status, fetchErr)
+	}
+	if inspection == nil {
+		return nil, fmt.Errorf("%s (status %d) has no <body>", pageURL, status)
+	}
+
+	if store {
+		// an inspection isnt part of any crawl, the counters of the last one are left alone
+		inspection.Event, inspection.GeoPoint = s.storeDetail(s.db, nil, page)
+		inspection.Stored = true
+	} else {
+		inspection.Event, inspection.GeoPoint = s.previewDetail(page)
+	}
+	inspection.Info = page.Info
+	inspection.Info.EventID = inspection.Event.ID
+	return inspection, nil
+}
+
+// checkSiteURL only lets through absolute urls of the site we scrape
+func (s *scrape) checkSiteURL(pageURL string) error {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotSitePage, err)
+	}
+	site, err := url.Parse(s.baseURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || siteHost(u.Host) != siteHost(site.Host) {
+		return fmt.Errorf("%s: %w %s", pageURL, ErrNotSitePage, s.baseURL)
+	}
+	return nil
+}
+
+// siteHost is the host with the www. in front dropped, eventbrite.com and www.eventbrite.com are one site
+func siteHost(host string) string {
+	return strings.TrimPrefix(strings.ToLower(host), "www.")
+}
+
+// inspectCollector is a side collector of its own, the crawl's one has its callbacks and remembers what it visited
+func (s *scrape) inspectCollector() *colly.Collector {
+	if s.newCollectors != nil {
+		_, side := s.newCollectors()
+		return side
+	}
+	c := colly.NewCollector()
+	configColly(c, s.log, "Side Page Scraper", s.cache, nil)
+	return c
+}
+
+// previewDetail is what storeDetail would store, without writing anything or calling the geocoder
+func (s *scrape) previewDetail(page *DetailPage) (DB.Event, *DB.GeoPoint) {
+	event := page.Event
+	s.classifier.Apply(&event)
+	if event.AttendanceMode == AttendanceOnline {
+		return event, nil
+	}
+	parsed := page.Location.Parsed
+	lat, long, address := -1.1, -1.1, page.Location.Text
+	if page.Location.Exact && page.Location.Text != "" {
+		if canonical := parsed.Canonical(); canonical != "" {
+			address = canonical
+		}
+		if venue, found := s.db.VenueByAddress(address); found && venue.HasCoordinates() {
+			event.VenueID = venue.ID
+			lat, long = venue.Latitude, venue.Longitude
+		}
+	}
+	return event, withAddressParts(DB.NewGeoPoint(lat, long, address), parsed)
+}
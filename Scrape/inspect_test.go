@@ -0,0 +1,100 @@
+package scrape
+
+import (
+	"errors"
+	"testing"
+
+	"lite/DB"
+)
+
+func TestScrapeURL(t *testing.T) {
+	site := newFakeEventbrite(t)
+	s := newFakeSiteScraper(t, site)
+	jazzURL := site.URL + "/e/jazz-night-101"
+
+	preview, err := s.ScrapeURL(jazzURL, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored int64
+	s.db.Database.Model(&DB.Event{}).Count(&stored)
+	if preview.Stored || stored != 0 {
+		t.Errorf("preview stored %d events", stored)
+	}
+	if preview.Status != 200 || preview.Event.Title != "Jazz Night at the Blue Note" || preview.Event.Category != "music" {
+		t.Errorf("preview status %d title %q category %q", preview.Status, preview.Event.Title, preview.Event.Category)
+	}
+	if title := preview.Fields[fieldTitle]; title.CSS == "" || title.Fallback != 0 || title.Value != preview.Event.Title {
+		t.Errorf("title match = %+v", title)
+	}
+	if tags := preview.Fields[fieldTags]; tags.Count != 2 {
+		t.Errorf("tags match = %+v", tags)
+	}
+	if preview.GeoPoint == nil || preview.GeoPoint.Latitude == fakeLatitude {
+		t.Errorf("preview geo point %+v, want one that isnt geocoded", preview.GeoPoint)
+	}
+
+	// the counters of the last crawl stay with that crawl
+	s.stats = newRunStats("full", nil, "")
+	saved, err := s.ScrapeURL(jazzURL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := s.stats.snapshot(); run.EventsInserted != 0 || run.EventsUpdated != 0 || run.GeocodeCalls != 0 {
+		t.Errorf("storing an inspection counted towards the last crawl: %+v", run)
+	}
+	s.db.Database.Model(&DB.Event{}).Count(&stored)
+	if !saved.Stored || stored != 1 || saved.Event.ID == 0 || saved.Info.EventID != saved.Event.ID {
+		t.Errorf("stored %d events, event id %d info event id %d", stored, saved.Event.ID, saved.Info.EventID)
+	}
+	if saved.GeoPoint == nil || saved.GeoPoint.Latitude != fakeLatitude || saved.Event.VenueID == 0 {
+		t.Errorf("stored geo point %+v venue %d", saved.GeoPoint, saved.Event.VenueID)
+	}
+	// storing the page again updates the event in place instead of adding another one next to it
+	again, err := s.ScrapeURL(jazzURL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Event.ID != saved.Event.ID {
+		t.Errorf("stored again as event %d, want %d", again.Event.ID, saved.Event.ID)
+	}
+	for _, model := range []interface{}{&DB.Event{}, &DB.EventInfo{}, &DB.GeoPoint{}} {
+		s.db.Database.Model(model).Count(&stored)
+		if stored != 1 {
+			t.Errorf("%T: %d rows after storing the page twice", model, stored)
+		}
+	}
+	// nothing but the three fetches of the page
+	if hits := site.Hits("/e/jazz-night-101"); hits != 3 {
+		t.Errorf("page fetched %d times", hits)
+	}
+
+	if _, err := s.ScrapeURL(site.URL+"/e/gone-103", false); err == nil {
+		t.Error("scraped a page that is gone")
+	}
+	if _, err := s.ScrapeURL("https://example.com/e/jazz-night-101", false); !errors.Is(err, ErrNotSitePage) {
+		t.Errorf("scraping another site: %v", err)
+	}
+}
+
+func TestCheckSiteURL(t *testing.T) {
+	s := NewScraper(nil, nil, discardLogger(), nil)
+	tests := []struct {
+		base, page string
+		ok         bool
+	}{
+		{"https://www.eventbrite.com", "https://www.eventbrite.com/e/jazz-night-101", true},
+		{"https://www.eventbrite.com", "https://eventbrite.com/e/jazz-night-101", true},
+		{"https://eventbrite.com", "https://www.eventbrite.com/e/jazz-night-101", true},
+		{"https://www.eventbrite.com", "https://WWW.Eventbrite.com/e/jazz-night-101", true},
+		{"https://www.eventbrite.com", "https://eventbrite.com.evil.example/e/jazz-night-101", false},
+		{"https://www.eventbrite.com", "ftp://www.eventbrite.com/e/jazz-night-101", false},
+		{"http://127.0.0.1:8080", "http://127.0.0.1:9090/e/jazz-night-101", false},
+	}
+	for _, tt := range tests {
+		s.baseURL = tt.base
+		if err := s.checkSiteURL(tt.page); (err == nil) != tt.ok {
+			t.Errorf("base %s page %s: %v", tt.base, tt.page, err)
+		}
+	}
+}
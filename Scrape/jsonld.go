@@ -0,0 +1,152 @@
+package scrape
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+)
+
+/*
+Detail pages carry a schema.org Event in a <script type="application/ld+json"> block. It is a lot more
+stable than the css classes and has machine readable dates, so anything we can take from it we do
+*/
+
+const jsonLDSelector = "script[type='application/ld+json']"
+
+type jsonLDEvent struct {
+	Type      jsonLDType `json:"@type"`
+	Name      string     `json:"name"`
+	StartDate string     `json:"startDate"`
+	EndDate   string     `json:"endDate"`
+	// https://schema.org/OnlineEventAttendanceMode and friends
+	AttendanceMode string          `json:"eventAttendanceMode"`
+	Location       json.RawMessage `json:"location"`
+	URL            string          `json:"url"`
+	// a series lists its dates as sub events, each with its own capacity
+	SubEvent          json.RawMessage `json:"subEvent"`
+	MaximumCapacity   jsonLDInt       `json:"maximumAttendeeCapacity"`
+	RemainingCapacity jsonLDInt       `json:"remainingAttendeeCapacity"`
+}
+
+// subEvents returns the occurrences of a series, nil for a one off event
+func (e *jsonLDEvent) subEvents() []jsonLDEvent {
+	if len(e.SubEvent) == 0 {
+		return nil
+	}
+	var events []jsonLDEvent
+	for _, raw := range jsonLDNodes(e.SubEvent) {
+		var sub jsonLDEvent
+		if err := json.Unmarshal(raw, &sub); err == nil && sub.StartDate != "" {
+			events = append(events, sub)
+		}
+	}
+	return events
+}
+
+// numbers show up both as 12 and "12"
+type jsonLDInt int
+
+func (n *jsonLDInt) UnmarshalJSON(data []byte) error {
+	var value json.Number
+	if err := json.Unmarshal(data, &value); err != nil {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		value = json.Number(text)
+	}
+	parsed, err := value.Int64()
+	if err != nil {
+		*n = 0
+		return nil
+	}
+	*n = jsonLDInt(parsed)
+	return nil
+}
+
+// locationTypes returns the @type of every location on the event, a hybrid event has a Place and a VirtualLocation
+func (e *jsonLDEvent) locationTypes() []string {
+	var types []string
+	for _, raw := range jsonLDNodes(e.Location) {
+		var node struct {
+			Type jsonLDType `json:"@type"`
+		}
+		if err := json.Unmarshal(raw, &node); err == nil {
+			types = append(types, node.Type...)
+		}
+	}
+	return types
+}
+
+// @type is either a string or a list of strings
+type jsonLDType []string
+
+func (t *jsonLDType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = jsonLDType{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// isEvent matches Event and all its subtypes (MusicEvent, SocialEvent, ...)
+func (t jsonLDType) isEvent() bool {
+	for _, name := range t {
+		if strings.HasSuffix(name, "Event") {
+			return true
+		}
+	}
+	return false
+}
+
+// findJSONLDEvent returns the first schema.org event in the page's ld+json blocks. The blocks usually sit
+// in <head>, so the whole document is searched and not just the element the callback got
+func findJSONLDEvent(h *colly.HTMLElement) (*jsonLDEvent, bool) {
+	root := h.DOM.Closest("html")
+	if root.Length() == 0 {
+		root = h.DOM
+	}
+	var blocks []string
+	root.Find(jsonLDSelector).Each(func(_ int, el *goquery.Selection) {
+		blocks = append(blocks, el.Text())
+	})
+	return parseJSONLD(blocks)
+}
+
+func parseJSONLD(blocks []string) (*jsonLDEvent, bool) {
+	for _, block := range blocks {
+		for _, raw := range jsonLDNodes([]byte(strings.TrimSpace(block))) {
+			var event jsonLDEvent
+			if err := json.Unmarshal(raw, &event); err != nil {
+				continue
+			}
+			if event.Type.isEvent() {
+				return &event, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// jsonLDNodes flattens the three shapes a block comes in: one object, a list of objects or an @graph
+func jsonLDNodes(block []byte) []json.RawMessage {
+	var list []json.RawMessage
+	if err := json.Unmarshal(block, &list); err == nil {
+		return list
+	}
+	var graph struct {
+		Graph []json.RawMessage `json:"@graph"`
+	}
+	if err := json.Unmarshal(block, &graph); err == nil && len(graph.Graph) > 0 {
+		return graph.Graph
+	}
+	return []json.RawMessage{block}
+}
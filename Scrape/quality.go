@@ -0,0 +1,232 @@
+package scrape
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"lite/DB"
+	"lite/metrics"
+	"lite/pkg"
+)
+
+/*
+When the site changes its markup the selectors stop matching and we happily store events with no title
+or date. Every run counts how often each field actually came back, per source, and compares that with
+the average of the last runs. A field that falls under its floor, or well below its baseline, raises an
+alert (error log, notifier and a metric) and the run report lists a few of the pages that came back
+without it so there is something to open in a browser
+*/
+
+const (
+	baselineRuns = 7
+	// fewer pages than this and the rates are too noisy to alert on
+	minPagesForAlert = 10
+	// an alert for any field that drops this far below its baseline
+	maxBaselineDrop  = 0.2
+	maxFailedSamples = 5
+	fieldStartsAt    = "starts_at"
+)
+
+// fill rates under these are always an alert, whatever the history says
+var fillRateFloors = map[string]float64{
+	fieldTitle:    0.95,
+	fieldDate:     0.9,
+	fieldLocation: 0.8,
+}
+
+type qualityCheck struct {
+	field string
+	// some fields dont apply to every page, online events have no location
+	applies func(*DetailPage) bool
+	filled  func(*DetailPage) bool
+}
+
+var qualityChecks = []qualityCheck{
+	{fieldTitle, nil, func(p *DetailPage) bool { return p.Event.Title != "" }},
+	{fieldDate, nil, func(p *DetailPage) bool { return p.Event.Date != "" }},
+	{fieldStartsAt, nil, func(p *DetailPage) bool { return p.Event.StartsAt != nil }},
+	{fieldLocation, func(p *DetailPage) bool { return p.Event.AttendanceMode != AttendanceOnline },
+		func(p *DetailPage) bool { return p.Location.Text != "" }},
+	{fieldHost, nil, func(p *DetailPage) bool { return p.Event.Host != "" }},
+	{fieldDescription, nil, func(p *DetailPage) bool { return p.Event.Description != "" }},
+	{fieldTags, nil, func(p *DetailPage) bool { return len(p.Tags) > 0 }},
+	{fieldImage, nil, func(p *DetailPage) bool { return p.Event.ImageUrl != "" }},
+}
+
+type FieldQuality struct {
+	Filled int     `json:"filled"`
+	Total  int     `json:"total"`
+	Rate   float64 `json:"rate"`
+	// average of the previous runs, missing until there are some
+	Baseline   *float64 `json:"baseline,omitempty"`
+	FailedURLs []string `json:"failed_urls,omitempty"`
+}
+
+type QualityAlert struct {
+	Field    string   `json:"field"`
+	Rate     float64  `json:"rate"`
+	Baseline *float64 `json:"baseline,omitempty"`
+	Reason   string   `json:"reason"`
+}
+
+type QualityReport struct {
+	Source          string                   `json:"source"`
+	SelectorVersion string                   `json:"selector_version"`
+	StartedAt       time.Time                `json:"started_at"`
+	FinishedAt      time.Time                `json:"finished_at"`
+	Pages           int                      `json:"pages"`
+	Fields          map[string]*FieldQuality `json:"fields"`
+	Alerts          []QualityAlert           `json:"alerts"`
+}
+
+// QualityTracker counts field fill rates over one run. Safe for the side scraper's workers
+type QualityTracker struct {
+	source          string
+	selectorVersion string
+	started         time.Time
+	mu              sync.Mutex
+	pages           int
+	fields          map[string]*FieldQuality
+}
+
+func NewQualityTracker(source, selectorVersion string) *QualityTracker {
+	fields := make(map[string]*FieldQuality, len(qualityChecks))
+	for _, check := range qualityChecks {
+		fields[check.field] = &FieldQuality{}
+	}
+	return &QualityTracker{source: source, selectorVersion: selectorVersion, started: time.Now(), fields: fields}
+}
+
+// Record counts one parsed detail page
+func (q *QualityTracker) Record(page *DetailPage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pages++
+	for _, check := range qualityChecks {
+		if check.applies != nil && !check.applies(page) {
+			continue
+		}
+		field := q.fields[check.field]
+		field.Total++
+		if check.filled(page) {
+			field.Filled++
+		} else if len(field.FailedURLs) < maxFailedSamples {
+			field.FailedURLs = append(field.FailedURLs, page.Event.URL)
+		}
+	}
+}
+
+// Report works out the rates of the run and checks them against the baseline of the previous runs in db
+func (q *QualityTracker) Report(db *DB.Storage) *QualityReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	report := &QualityReport{
+		Source:          q.source,
+		SelectorVersion: q.selectorVersion,
+		StartedAt:       q.started,
+		FinishedAt:      time.Now(),
+		Pages:           q.pages,
+		Fields:          make(map[string]*FieldQuality, len(q.fields)),
+		Alerts:          []QualityAlert{},
+	}
+	for _, check := range qualityChecks {
+		field := *q.fields[check.field]
+		if field.Total == 0 {
+			report.Fields[check.field] = &field
+			continue
+		}
+		field.Rate = float64(field.Filled) / float64(field.Total)
+		if baseline, found := db.FillRateBaseline(q.source, check.field, baselineRuns); found {
+			field.Baseline = &baseline
+		}
+		report.Fields[check.field] = &field
+		if q.pages < minPagesForAlert {
+			continue
+		}
+		if floor, ok := fillRateFloors[check.field]; ok && field.Rate < floor {
+			report.Alerts = append(report.Alerts, QualityAlert{check.field, field.Rate, field.Baseline,
+				fmt.Sprintf("fill rate %.0f%% is under the %.0f%% floor", field.Rate*100, floor*100)})
+			continue
+		}
+		if field.Baseline != nil && field.Rate < *field.Baseline-maxBaselineDrop {
+			report.Alerts = append(report.Alerts, QualityAlert{check.field, field.Rate, field.Baseline,
+				fmt.Sprintf("fill rate %.0f%% dropped from a baseline of %.0f%%", field.Rate*100, *field.Baseline*100)})
+		}
+	}
+	return report
+}
+
+// FillRates are the rows stored for this run, they become part of the baseline of the next ones. A run
+// too small to alert on (a single url, a recheck of a few pages) is too noisy for the baseline too
+func (r *QualityReport) FillRates() []DB.FillRate {
+	if r.Pages < minPagesForAlert {
+		return nil
+	}
+	var rates []DB.FillRate
+	for _, name := range r.fieldNames() {
+		field := r.Fields[name]
+		if field.Total == 0 {
+			continue
+		}
+		rates = append(rates, DB.FillRate{
+			RunAt: r.FinishedAt, Source: r.Source, Field: name,
+			Filled: field.Filled, Total: field.Total, Rate: field.Rate,
+		})
+	}
+	return rates
+}
+
+// Raise publishes the fill rates as metrics and sends every alert to the error log and the notifier
+func (r *QualityReport) Raise(logger *slog.Logger, notifier pkg.Notifier) {
+	for _, name := range r.fieldNames() {
+		if field := r.Fields[name]; field.Total > 0 {
+			metrics.SetGauge(fmt.Sprintf("scrape_fill_rate{source=%q,field=%q}", r.Source, name), field.Rate)
+		}
+	}
+	if len(r.Alerts) == 0 {
+		return
+	}
+	var lines []string
+	for _, alert := range r.Alerts {
+		metrics.IncCounter(fmt.Sprintf("scrape_selector_alerts{source=%q,field=%q}", r.Source, alert.Field))
+		failed := r.Fields[alert.Field].FailedURLs
+		logger.Error("selector alert", "source", r.Source, "selector_version", r.SelectorVersion, "field", alert.Field, "reason", alert.Reason, "examples", strings.Join(failed, " "))
+		lines = append(lines, fmt.Sprintf("%s: %s (e.g. %s)", alert.Field, alert.Reason, strings.Join(failed, " ")))
+	}
+	if notifier == nil {
+		return
+	}
+	subject := fmt.Sprintf("%s selectors look broken (%d pages, selectors %s)", r.Source, r.Pages, r.SelectorVersion)
+	if err := notifier.Notify(subject, strings.Join(lines, "\n")); err != nil {
+		logger.Error("sending selector alert failed", "err", err)
+	}
+}
+
+// Save writes the report as json into folder and returns the file it wrote
+func (r *QualityReport) Save(folder string) (string, error) {
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return "", err
+	}
+	raw, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(folder, fmt.Sprintf("quality_%s_%s.json", r.Source, r.FinishedAt.UTC().Format("20060102T150405")))
+	return path, os.WriteFile(path, raw, 0644)
+}
+
+func (r *QualityReport) fieldNames() []string {
+	names := make([]string, 0, len(r.Fields))
+	for name := range r.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
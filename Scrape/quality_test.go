@@ -0,0 +1,110 @@
+package scrape
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lite/DB"
+)
+
+type recordingNotifier struct {
+	subjects []string
+	messages []string
+}
+
+func (r *recordingNotifier) Notify(subject, message string) error {
+	r.subjects = append(r.subjects, subject)
+	r.messages = append(r.messages, message)
+	return nil
+}
+
+func TestQualityAlerts(t *testing.T) {
+	db, err := DB.NewStorage(filepath.Join(t.TempDir(), "quality.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// descriptions used to come back on nearly every page
+	for i := 0; i < 3; i++ {
+		db.AddFillRates([]DB.FillRate{{RunAt: time.Now().Add(-time.Duration(i+1) * time.Hour), Source: "eventbrite", Field: fieldDescription, Filled: 95, Total: 100, Rate: 0.95}})
+	}
+
+	tracker := NewQualityTracker("eventbrite", "test")
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		page := &DetailPage{Event: DB.Event{
+			URL:      fmt.Sprintf("https://www.eventbrite.com/e/event-%d", i),
+			Title:    "Jazz Night",
+			Date:     "Saturday, June 1",
+			StartsAt: &start,
+			Host:     "Newark Jazz Society",
+		}, Location: DetailLocation{Text: "Newark"}, Tags: []string{"jazz"}}
+		if i%2 == 0 {
+			// a redesign took out half the titles and the descriptions
+			page.Event.Title = ""
+		} else {
+			page.Event.Description = "Three sets"
+		}
+		if i < 5 {
+			page.Event.AttendanceMode = AttendanceOnline
+			page.Location.Text = ""
+		}
+		tracker.Record(page)
+	}
+
+	report := tracker.Report(db)
+	if location := report.Fields[fieldLocation]; location.Total != 15 || location.Rate != 1 {
+		t.Errorf("location counted %d pages at %.2f, online events should be left out", location.Total, location.Rate)
+	}
+	alerts := make(map[string]QualityAlert)
+	for _, alert := range report.Alerts {
+		alerts[alert.Field] = alert
+	}
+	if len(alerts) != 2 {
+		t.Fatalf("alerts = %+v, want title and description", report.Alerts)
+	}
+	if !strings.Contains(alerts[fieldTitle].Reason, "floor") {
+		t.Errorf("title alert = %q, want the floor", alerts[fieldTitle].Reason)
+	}
+	if alert := alerts[fieldDescription]; alert.Baseline == nil || math.Abs(*alert.Baseline-0.95) > 1e-9 || !strings.Contains(alert.Reason, "baseline") {
+		t.Errorf("description alert = %+v, want a drop from the 95%% baseline", alert.Reason)
+	}
+	if failed := report.Fields[fieldTitle].FailedURLs; len(failed) != maxFailedSamples || failed[0] != "https://www.eventbrite.com/e/event-0" {
+		t.Errorf("failed title samples = %v", failed)
+	}
+
+	notifier := &recordingNotifier{}
+	report.Raise(discardLogger(), notifier)
+	if len(notifier.subjects) != 1 || !strings.Contains(notifier.messages[0], "event-0") {
+		t.Errorf("notifications = %v %v, want one listing the failed pages", notifier.subjects, notifier.messages)
+	}
+
+	// this run becomes part of the baseline of the next one
+	if err := db.AddFillRates(report.FillRates()); err != nil {
+		t.Fatal(err)
+	}
+	if baseline, _ := db.FillRateBaseline("eventbrite", fieldDescription, baselineRuns); baseline >= 0.95 {
+		t.Errorf("baseline after the bad run = %.2f, want it pulled down", baseline)
+	}
+}
+
+func TestQualityNeedsEnoughPages(t *testing.T) {
+	db, err := DB.NewStorage(filepath.Join(t.TempDir(), "quality.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := NewQualityTracker("eventbrite", "test")
+	for i := 0; i < minPagesForAlert-1; i++ {
+		tracker.Record(&DetailPage{Event: DB.Event{URL: "https://www.eventbrite.com/e/empty"}})
+	}
+	report := tracker.Report(db)
+	if len(report.Alerts) != 0 {
+		t.Errorf("alerted on %d pages: %+v", report.Pages, report.Alerts)
+	}
+	if rates := report.FillRates(); len(rates) != 0 {
+		t.Errorf("a run of %d pages went into the baseline: %+v", report.Pages, rates)
+	}
+}
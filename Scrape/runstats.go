@@ -0,0 +1,117 @@
+package scrape
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+
+	"lite/DB"
+)
+
+// how often a running crawl writes its counters to scrape_runs, so the admin api can follow along
+const runProgressEvery = 15 * time.Second
+
+// runStats counts what a crawl does into its scrape_runs row
+type runStats struct {
+	mu  sync.Mutex
+	run DB.ScrapeRun
+}
+
+func newRunStats(kind string, lists []string, selectorVersion string) *runStats {
+	return &runStats{run: DB.ScrapeRun{
+		Kind:            kind,
+		Lists:           strings.Join(lists, ","),
+		StartedAt:       time.Now(),
+		SelectorVersion: selectorVersion,
+		Errors:          DB.Counts{},
+	}}
+}
+
+// watch counts the pages and failures of both collectors
+func (r *runStats) watch(listings, details *colly.Collector) {
+	listings.OnResponse(func(resp *colly.Response) { r.page(snapshotListing, len(resp.Body)) })
+	details.OnResponse(func(resp *colly.Response) { r.page(snapshotDetail, len(resp.Body)) })
+	failed := func(resp *colly.Response, err error) { r.failed(resp.StatusCode, err) }
+	listings.OnError(failed)
+	details.OnError(failed)
+}
+
+func (r *runStats) page(kind string, size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if kind == snapshotListing {
+		r.run.ListingPages++
+	} else {
+		r.run.DetailPages++
+	}
+	r.run.Bytes += int64(size)
+}
+
+func (r *runStats) failed(status int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.Errors[failureKind(status, err)]++
+}
+
+func failureKind(status int, err error) string {
+	var netErr net.Error
+	switch {
+	case status == 404 || status == 410:
+		return "not_found"
+	case status == 429:
+		return "rate_limited"
+	case status >= 500:
+		return "server_error"
+	case status >= 400:
+		return "client_error"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case status == 0:
+		return "network"
+	}
+	return "other"
+}
+
+func (r *runStats) stored(updated bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if updated {
+		r.run.EventsUpdated++
+	} else {
+		r.run.EventsInserted++
+	}
+}
+
+func (r *runStats) geocoded() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.run.GeocodeCalls++
+}
+
+func (r *runStats) update(fn func(run *DB.ScrapeRun)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(&r.run)
+}
+
+// save writes the counters so far
+func (r *runStats) save(db *DB.Storage) error {
+	run := r.snapshot()
+	return db.SaveScrapeRun(&run)
+}
+
+// snapshot copies the counters, so the workers can keep counting while it is stored or shown
+func (r *runStats) snapshot() DB.ScrapeRun {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run := r.run
+	run.Errors = make(DB.Counts, len(r.run.Errors))
+	for kind, n := range r.run.Errors {
+		run.Errors[kind] = n
+	}
+	return run
+}
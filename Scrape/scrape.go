@@ -2,11 +2,12 @@ package scrape
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,87 +15,192 @@ import (
 	"github.com/gocolly/colly"
 
 	"lite/DB"
+	"lite/config"
+	"lite/logging"
 	"lite/pkg"
+	"lite/secrets"
 )
 
-var colorOutput = pkg.NewTextStyler()
-
-// will write all errors to the console as well as to an error file
-type Logger struct {
-	ErrorLogger   *log.Logger // Logs errors
-	InfoLogger    *log.Logger // Logs general information
-	DebugLogger   *log.Logger // Logs debugging information
-	RequestLogger *log.Logger // Logs HTTP requests (separate file)
-}
 type scrape struct {
 	mainScraper    *colly.Collector
 	sideScraper    *colly.Collector
 	addressCleaner *addressCleaner
-	logger         *Logger
-	mu             sync.Mutex
+	geocoder       *Geocoder // nil without a geocode.maps.co key
+	classifier     *Classifier
+	selectors      *SelectorStore
+	archive        *Archive
+	warc           *WARCWriter // nil unless scrape.warc_output is set
+	quality        *QualityTracker
+	notifier       pkg.Notifier
+	log            *slog.Logger
+	// puts the id of the crawl in progress on everything log writes
+	runTag   *logging.RunTag
+	db       *DB.Storage
+	cache    Cache
+	seeds    *SeedRegistry
+	frontier *Frontier
+	// counters of the crawl in progress
+	stats *runStats
+	// the crawl in progress, nil between crawls, guarded by mu
+	active *activeRun
+	// builds the collectors for every run after the first, nil in tests that only run once
+	newCollectors func() (*colly.Collector, *colly.Collector)
+	runs          int
+	// worker counts, queue sizes and the crawl timeout
+	settings config.ScrapeConfig
+	// where the seed links point, tests swap it for a fake site
+	baseURL      string
+	reportFolder string
+	mu           sync.Mutex
+	// set (under mu) while rebuilding from the archive, nothing may touch the network and no crawl may start
+	offline bool
+	// closed by Close, stops what runs in the background for as long as the scraper lives
+	stop      chan struct{}
+	closeOnce sync.Once
 }
 
-func NewLogger(prefix string) (*Logger, error) {
-	// Open the general log file
-	const folderName = "ScapeLogs"
-	err := os.MkdirAll(folderName, 0755) // Creates the folder if it doesn't exist
-	if err != nil {
-		log.Fatalf("error creating folder: %v\n", err)
-		return nil, err
-	}
-	debug_file := pkg.CreateLogFile(folderName + "/" + prefix + "general")
-	info_file := pkg.CreateLogFile(folderName + "/" + prefix + "info")
-	request_file := pkg.CreateLogFile(folderName + "/" + prefix + "request")
-	error_file := pkg.CreateLogFile(folderName + "/" + prefix + "error")
-	//multiWriter := io.MultiWriter(info_file, os.Stdout)
-	// Create loggers for each purpose
-	errorLogger := log.New(error_file, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-	infoLogger := log.New(info_file, "INFO: ", log.Ldate|log.Ltime)
-	debugLogger := log.New(debug_file, "DEBUG: ", log.Ldate|log.Ltime|log.Lshortfile)
-	requestLogger := log.New(request_file, "REQUEST: ", log.Ldate|log.Ltime)
-
-	return &Logger{
-		ErrorLogger:   errorLogger,
-		InfoLogger:    infoLogger,
-		DebugLogger:   debugLogger,
-		RequestLogger: requestLogger,
-	}, nil
-}
-
-func NewScraper(c *colly.Collector, s *colly.Collector, l *Logger, a *addressCleaner) *scrape {
+const staticFolder = "static_CSV"
+
+func NewScraper(c *colly.Collector, s *colly.Collector, l *slog.Logger, a *addressCleaner) *scrape {
 	return &scrape{
 		mainScraper:    c,
 		sideScraper:    s,
 		addressCleaner: a,
-		logger:         l,
+		log:            l,
+		runTag:         &logging.RunTag{},
+		settings:       config.Default().Scrape,
+		baseURL:        config.Default().Scrape.BaseURL,
+		reportFolder:   "ScapeLogs",
+		stop:           make(chan struct{}),
 	}
 }
-func initScrape() (*scrape, error) {
-	mainPage := colly.NewCollector()
-	sidePage := colly.NewCollector()
-	log, err := NewLogger("__")
-	cache := newCache()
+func initScrape(cfg *config.Config, db *DB.Storage, keys *secrets.Secrets) (*scrape, error) {
+	runTag := &logging.RunTag{}
+	log := runTag.Logger(logging.For(logging.Scrape))
+	cache := newCache(cfg.Redis)
+
+	var replay http.RoundTripper
+	var err error
+	if path := cfg.Scrape.WARCReplay; path != "" {
+		if replay, err = NewWARCTransport(path); err != nil {
+			return nil, err
+		}
+	}
+	gelokyKey, err := keys.Optional(secrets.GelokyKey)
+	if err != nil {
+		return nil, err
+	}
+	mapsKey, err := keys.Optional(secrets.MapsCoKey)
+	if err != nil {
+		return nil, err
+	}
+	slackWebhook, err := keys.Optional(secrets.SlackWebhook)
+	if err != nil {
+		return nil, err
+	}
+	if gelokyKey == "" {
+		log.Warn("no geocoding key, events are stored without coordinates", "secret", secrets.GelokyKey)
+	}
+	Cleaner := newAddressCleaner(log, gelokyKey)
+	classifier, err := LoadClassifier(filepath.Join(staticFolder, categoryRulesFile))
 	if err != nil {
 		return nil, err
 	}
 
-	configColly(mainPage, log, "Main Page Scraper", cache)
-	configColly(sidePage, log, "Side Page Scraper", cache)
-	Cleaner := newAddressCleaner(log.DebugLogger)
+	// a seed list pointing at a csv that isnt there is caught now and not by a worker mid crawl
+	seeds, err := LoadSeeds(filepath.Join(staticFolder, seedsFile))
+	if err != nil {
+		return nil, err
+	}
 
-	return NewScraper(mainPage, sidePage, log, Cleaner), nil
+	// a selector file that doesnt hold up against its sample pages stops us here, not halfway into a crawl
+	selectors, err := NewSelectorStore(filepath.Join(selectorFolder, eventbriteSelectors))
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := NewArchive(archiveFolder, db)
+	if err != nil {
+		return nil, err
+	}
+	var warc *WARCWriter
+	if path := cfg.Scrape.WARCOutput; path != "" && replay == nil {
+		if warc, err = NewWARCWriter(path); err != nil {
+			return nil, err
+		}
+	}
+	// colly remembers every url it visited, so each run gets collectors of its own
+	newCollectors := func() (*colly.Collector, *colly.Collector) {
+		mainPage := colly.NewCollector()
+		sidePage := colly.NewCollector()
+		configColly(mainPage, log, "Main Page Scraper", cache, replay)
+		configColly(sidePage, log, "Side Page Scraper", cache, replay)
+		// a replayed crawl is already captured, archiving it again would only add copies
+		if replay == nil {
+			archive.Record(mainPage, snapshotListing, log)
+			archive.Record(sidePage, snapshotDetail, log)
+		}
+		if warc != nil {
+			warc.Record(mainPage, snapshotListing, log)
+			warc.Record(sidePage, snapshotDetail, log)
+		}
+		return mainPage, sidePage
+	}
+
+	mainPage, sidePage := newCollectors()
+	scraper := NewScraper(mainPage, sidePage, log, Cleaner)
+	scraper.newCollectors = newCollectors
+	scraper.runTag = runTag
+	scraper.classifier = classifier
+	scraper.selectors = selectors
+	go selectors.Watch(selectorPollEvery, log, scraper.stop)
+	scraper.seeds = seeds
+	scraper.frontier = NewFrontier(db)
+	scraper.archive = archive
+	scraper.warc = warc
+	scraper.notifier = pkg.NewNotifier(slackWebhook)
+	if mapsKey != "" {
+		scraper.geocoder = newGeoCoder(mapsKey, baseUrl)
+	}
+	scraper.db = db
+	scraper.cache = cache
+	scraper.settings = cfg.Scrape
+	// where the crawl goes, a mirror or a local fake of the site works too
+	scraper.baseURL = strings.TrimRight(cfg.Scrape.BaseURL, "/")
+	return scraper, nil
 }
-func Config() *scrape {
-	c, err := initScrape()
+
+// Config builds the scraper from cfg, storing what it finds in db, with the api keys it finds in keys
+func Config(cfg *config.Config, db *DB.Storage, keys *secrets.Secrets) *scrape {
+	c, err := initScrape(cfg, db, keys)
 	if err != nil {
-		log.Fatalf("Couldnt start Scraping server %v", err)
+		logging.Fatal(logging.For(logging.Scrape), "couldnt set up the scraper", "err", err)
 	}
-	colorOutput.Red("Colly output files set up complete")
-	colorOutput.UnderlineGreen("Colly Set up complete")
+	c.log.Info("scraper set up", "base_url", c.baseURL, "listing_workers", c.settings.ListingWorkers, "detail_workers", c.settings.DetailWorkers)
 
 	return c
 }
-func configColly(c *colly.Collector, log *Logger, name string, cache Cache) error {
+
+// Close stops the selector watcher and closes the warc file. The scraper isnt meant to crawl after that
+func (s *scrape) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		if s.warc != nil {
+			err = s.warc.Close()
+		}
+	})
+	return err
+}
+
+// configColly sets up logging and the transport of a collector. A nil replay means fetch from the live site,
+// otherwise every request is answered by replay (a warc file or the html archive)
+func configColly(c *colly.Collector, log *slog.Logger, name string, cache Cache, replay http.RoundTripper) error {
+	if replay != nil {
+		log.Info("replaying captured responses, nothing is fetched", "collector", name)
+		c.WithTransport(replay)
+		return configCallbacks(c, log, name, cache)
+	}
 	httpClient := &http.Client{
 		Transport: &http.Transport{
 			Proxy:               http.ProxyFromEnvironment,
@@ -105,182 +211,382 @@ func configColly(c *colly.Collector, log *Logger, name string, cache Cache) erro
 	}
 
 	// Wrap the HTTP client to respect context
-	str := fmt.Sprintf("colly configured with max Idle Connections: %d , idle Connection Timeout: %d seconds, TLS Handshake %d seconds", 10, 30, 30)
-	colorOutput.Yellow(str)
+	log.Debug("colly configured", "collector", name, "max_idle_conns", 10, "idle_conn_timeout", 30*time.Second, "tls_handshake_timeout", 10*time.Second)
 	c.WithTransport(httpClient.Transport)
+	return configCallbacks(c, log, name, cache)
+}
 
+func configCallbacks(c *colly.Collector, log *slog.Logger, name string, cache Cache) error {
 	c.OnRequest(func(r *colly.Request) {
 		// can add more stuff later but this is just the grounds work right now
 		// set random user-agent to not get bot detected
 		//r.Headers.Set("User-agent", RandomString())
 		r.Headers.Set("Accept-Language", "en-US")
-		str := fmt.Sprintf("%s: Requesting %s [Method: %s, Headers: %v, Timestamp: %s]",
-			name,
-			r.URL,
-			r.Method,
-			r.Headers,
-			time.Now().Format(time.RFC3339))
-		log.RequestLogger.Println(str)
+		log.Debug("requesting", "collector", name, "url", r.URL.String(), "method", r.Method)
 	})
 	c.OnResponse(func(r *colly.Response) {
-		str := fmt.Sprintf("%s: Finished processing site %s [Status: %d, Length: %d bytes, Timestamp: %s]", name,
-			r.Request.URL,
-			r.StatusCode,
-			len(r.Body),
-			time.Now().Format(time.RFC3339))
-		log.RequestLogger.Println(str)
+		log.Debug("fetched", "collector", name, "url", r.Request.URL.String(), "status", r.StatusCode, "bytes", len(r.Body))
 		if r.StatusCode == 404 { // if URL doesnt Exist never visit it again
 			cache.IncreaseTTL(r.Request.URL.String(), time.Hour*24*30*12) // 1 year
 		}
 
 	})
 	c.OnError(func(r *colly.Response, err error) {
-		str := fmt.Sprintf("%s: Error: %v [URL: %s, Status: %d, Timestamp: %s]", name,
-			err,
-			r.Request.URL,
-			r.StatusCode,
-			time.Now().Format(time.RFC3339))
 		if r.StatusCode == 404 || err == colly.ErrAlreadyVisited { // if URL doesnt Exist never visit it again
 			cache.IncreaseTTL(r.Request.URL.String(), time.Hour*24*30*12) // 1 year
-			log.InfoLogger.Printf("%s does not exist, blacklisting URL\n", r.Request.URL.String())
+			log.Info("url does not exist, blacklisting it", "collector", name, "url", r.Request.URL.String())
 			return
 		}
-		log.ErrorLogger.Println(str)
+		attrs := []any{"collector", name, "url", r.Request.URL.String(), "status", r.StatusCode, "err", err}
 		if len(r.Body) > 0 {
-			log.ErrorLogger.Printf("first 100 bytes of Response Body: %s\n", string(r.Body)[:100])
+			attrs = append(attrs, "body", string(r.Body[:min(len(r.Body), 100)]))
 		}
+		log.Error("request failed", attrs...)
 	})
 	return nil
 }
 
-func csvReader(filename string) [][]string {
-	const foldername = "static_CSV"
-	filename = fmt.Sprintf("%s/%s", foldername, filename)
-	file, err := os.Open(filename)
-	if err != nil {
-		fmt.Println(err)
-		log.Fatal(err)
-	}
-	defer file.Close()
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
-	if err != nil {
-		log.Fatalf("Failed to read CSV: %v", err)
+// Start crawls every enabled seed list and revisits the event pages that are due
+func (s *scrape) Start() error {
+	return s.Crawl(context.Background(), CrawlOptions{})
+}
+
+// CrawlLists only crawls the named seed lists, along with the event pages that are due
+func (s *scrape) CrawlLists(lists ...string) error {
+	if len(lists) == 0 {
+		return fmt.Errorf("no seed lists to crawl")
 	}
-	// first row of these record as just defining the columns
-	return records[1:]
+	return s.Crawl(context.Background(), CrawlOptions{Lists: lists})
+}
 
+// Recheck only revisits the event pages the frontier has due, no listing is fetched
+func (s *scrape) Recheck() error {
+	return s.Crawl(context.Background(), CrawlOptions{Recheck: true})
 }
-func (s *scrape) constructUSlinks(links chan string, wg *sync.WaitGroup) {
-	defer colorOutput.Red("Done Constructing US Links")
-	defer wg.Done()
-	records := csvReader("us_cities.csv")
-	for _, record := range records {
-		cityName := strings.ToLower(record[0])
-		state_name := strings.ToLower(record[3])
-		ValidUrl := fmt.Sprintf("https://www.eventbrite.com/d/%s--%s/all-events/", state_name, cityName)
-		links <- ValidUrl
 
+// Crawl runs one crawl and returns once it is done, ErrRunInProgress if another one is going
+func (s *scrape) Crawl(ctx context.Context, opts CrawlOptions) error {
+	run, err := s.begin(ctx, opts)
+	if err != nil {
+		return err
 	}
+	return s.execute(run)
 }
-func (s *scrape) constructnjlinks(links chan string, wg *sync.WaitGroup) {
-	defer colorOutput.Red("Done Constructing NJ links")
-	defer wg.Done()
-	const state = "nj"
-	records := csvReader("nj.csv")
-	for _, record := range records {
-		cityName := strings.ToLower(record[0])
-		cityName = strings.Replace(cityName, " ", "-", -1)
-		ValidUrl := fmt.Sprintf("https://www.eventbrite.com/d/%s--%s/all-events/", state, cityName)
-		links <- ValidUrl
 
+// begin claims the scraper for a crawl and records its run, the crawl itself is left to execute
+func (s *scrape) begin(ctx context.Context, opts CrawlOptions) (*activeRun, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// offline means a reparse is rebuilding the events
+	if s.active != nil || s.offline {
+		return nil, ErrRunInProgress
+	}
+	seeds, err := s.crawlSeeds(opts)
+	if err != nil {
+		return nil, err
+	}
+	if s.runs > 0 && s.newCollectors != nil {
+		s.mainScraper, s.sideScraper = s.newCollectors()
 	}
+	s.runs++
+
+	selectors := s.selectors.Current()
+	s.quality = NewQualityTracker(selectors.Source, selectors.Version)
+	s.stats = newRunStats(opts.kind(), opts.Lists, selectors.Version)
+	if err := s.db.StartScrapeRun(&s.stats.run); err != nil {
+		return nil, fmt.Errorf("recording the scrape run: %w", err)
+	}
+	s.stats.watch(s.mainScraper, s.sideScraper)
+	s.runTag.Set(s.stats.run.ID)
+	run := &activeRun{opts: opts, seeds: seeds, stats: s.stats}
+	run.ctx, run.cancel = context.WithCancel(ctx)
+	s.active = run
+	return run, nil
 }
-func (s *scrape) constructInternationalLinks(links chan string, wg *sync.WaitGroup) {
-	defer colorOutput.Red("Done Proccessing International Links")
-	defer wg.Done()
-	records := csvReader("non_us_cities.csv")
-	for _, record := range records {
-		city := strings.ToLower(record[0])
-		country := strings.ToLower(record[4])
-		url := fmt.Sprintf("https://www.eventbrite.com/d/%s--%s/events/", country, city)
-		links <- url
+
+// crawlSeeds are the seeds a crawl loads into the frontier
+func (s *scrape) crawlSeeds(opts CrawlOptions) ([]Seed, error) {
+	if opts.URL != "" || opts.Recheck {
+		// without seeds no listing comes due
+		return nil, nil
 	}
+	seeds, err := s.seeds.ListSeeds(s.baseURL, opts.Lists...)
+	if err != nil || len(opts.Seeds) == 0 {
+		return seeds, err
+	}
+	known := make(map[string]Seed, len(seeds))
+	for _, seed := range seeds {
+		known[seed.URL] = seed
+	}
+	chosen := make([]Seed, 0, len(opts.Seeds))
+	for _, url := range opts.Seeds {
+		seed, ok := known[url]
+		if !ok {
+			return nil, fmt.Errorf("%s is not a seed of an enabled seed list", url)
+		}
+		chosen = append(chosen, seed)
+	}
+	return chosen, nil
 }
 
-func (s *scrape) Start() error {
-	colorOutput.Green("Starting web scrapper .....")
-	// Context handling -> for later
-	mainCtx, cancle := context.WithTimeout(context.Background(), time.Second*120)
-	defer cancle()
-	sideCtx, cancle := context.WithTimeout(context.Background(), time.Second*120)
-	defer cancle()
+// execute crawls what run was begun with and releases the scraper at the end
+func (s *scrape) execute(run *activeRun) error {
+	defer func() {
+		run.cancel()
+		// whatever the crawl captured is on disk before the next one starts or the process goes away
+		if s.warc != nil {
+			if err := s.warc.Sync(); err != nil {
+				s.log.Error("flushing the warc file failed", "err", err)
+			}
+		}
+		s.runTag.Clear()
+		s.mu.Lock()
+		s.active = nil
+		s.mu.Unlock()
+	}()
+	s.log.Info("crawl started", "kind", run.opts.kind(), "seeds", len(run.seeds))
+	// the timeout only counts the time the crawl is running, a paused crawl doesnt run out of it
+	crawlCtx, cancel := run.gate.deadline(run.ctx, s.settings.Timeout.Std())
+	defer cancel()
+
+	// rules may have changed since the last run, bring the old events up to date first
+	if updated, err := Reclassify(s.db, s.classifier); err != nil {
+		s.log.Error("re-classifying events failed", "err", err)
+	} else if updated > 0 {
+		s.log.Info("re-classified events", "events", updated, "rules", s.classifier.Version)
+	}
+
+	if err := s.frontier.Load(run.seeds); err != nil {
+		err = fmt.Errorf("loading the crawl frontier: %w", err)
+		s.finishRun(run, err)
+		return err
+	}
+	progressDone := make(chan struct{})
+	defer close(progressDone)
+	go s.reportProgress(progressDone)
 
 	var consumerWG sync.WaitGroup
-	cache := newCache()
+	cache := s.cache
 	cache.Save()
-	producerChannel := make(chan string, 33000) // Buffered channel for producers
-	SideProducer := make(chan string, 33000)    // Buffered channel for producers
+	producerChannel := make(chan string, s.settings.QueueSize) // Buffered channel for producers
+	SideProducer := make(chan string, s.settings.QueueSize)    // Buffered channel for producers
 	done := make(chan bool)
+	s.mu.Lock()
+	run.listings, run.details = producerChannel, SideProducer
+	s.mu.Unlock()
 
 	// set call back functions for colly
-	s.BeginScrape(SideProducer)
-	s.BeginSideScrape(mainCtx, SideProducer)
+	s.BeginScrape(crawlCtx, SideProducer)
+	s.BeginSideScrape(crawlCtx, SideProducer)
 	// Start Workers that will construct the URL's for main page as well as the side page workers that will proccess the links on the main page
-	go s.startSites(producerChannel, done)
-	go s.ScrapeSidePages(sideCtx, SideProducer)
+	go s.startSites(crawlCtx, run, producerChannel, SideProducer, done)
+	sideDone := make(chan struct{})
+	go func() {
+		s.scrapeSidePages(crawlCtx, run, SideProducer)
+		close(sideDone)
+	}()
 	//
-	workers := 50
+	workers := s.settings.ListingWorkers
 	consumerWG.Add(workers)
 	for i := 0; i < workers; i++ {
 		go func() {
 			defer consumerWG.Done()
 			for link := range producerChannel {
-				select {
-				case <-mainCtx.Done():
-					msg := "(Main Page Scraper): Context canelled, stopping wokrer"
-					colorOutput.BoldRed(msg)
-					s.logger.ErrorLogger.Println(msg)
+				if err := run.gate.wait(crawlCtx); err != nil {
+					s.log.Warn("crawl ended, stopping listing worker", "err", err)
 					return
-				default:
-					s.processLink(mainCtx, link, cache)
 				}
+				run.listingBusy.Add(1)
+				s.processLink(crawlCtx, link)
+				run.listingBusy.Add(-1)
 			}
 		}()
 	}
 	consumerWG.Wait()
 	<-done
 	close(SideProducer)
-	colorOutput.BoldRed("Done with Init of Web scraper")
+	// the side workers are still draining what the listings queued up
+	<-sideDone
+	if report, err := s.db.Deduplicate(); err != nil {
+		s.log.Error("dedup pass failed", "err", err)
+	} else {
+		s.log.Info("dedup pass done", "duplicates", report.Duplicates, "clusters", report.Clusters)
+		s.stats.update(func(run *DB.ScrapeRun) { run.Duplicates = report.Duplicates })
+	}
+	if err := s.frontier.Save(); err != nil {
+		s.log.Error("saving the crawl frontier failed", "err", err)
+	}
+	quality := s.finishQuality()
+	s.stats.update(func(run *DB.ScrapeRun) { run.QualityAlerts = len(quality.Alerts) })
+	s.finishRun(run, nil)
+	s.log.Info("crawl done")
 	return nil
 }
 
-func (s *scrape) startSites(mainsites chan string, done chan bool) {
-	colorOutput.Red("Starting to generate links")
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go s.constructnjlinks(mainsites, &wg)
-	//go s.constructUSlinks(mainsites, &wg)
-	//go s.constructInternationalLinks(mainsites, &wg)
-	colorOutput.UnderlineGreen("Waiting for go routines to finish")
-	wg.Wait()
-	close(mainsites)
-	done <- true
-
+// reportProgress writes the counters of the running crawl every so often until done is closed
+func (s *scrape) reportProgress(done <-chan struct{}) {
+	ticker := time.NewTicker(runProgressEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := s.stats.save(s.db); err != nil {
+				s.log.Error("saving scrape run progress failed", "err", err)
+			}
+		}
+	}
 }
 
-func (s *scrape) processLink(ctx context.Context, link string, cache Cache) {
-	// This function processes a single link concurrently
-	if cache.Exist(link) {
-		s.logger.DebugLogger.Printf("Skipping cached link: %s\n", link)
+// finishRun stores the final counters of the crawl, failed when err isnt nil
+func (s *scrape) finishRun(active *activeRun, err error) {
+	s.stats.update(func(run *DB.ScrapeRun) {
+		finished := time.Now()
+		run.FinishedAt = &finished
+		run.Status = DB.RunSucceeded
+		switch {
+		case err != nil:
+			run.Status, run.Error = DB.RunFailed, err.Error()
+		case active.cancelled.Load():
+			run.Status = DB.RunCancelled
+		}
+	})
+	if err := s.stats.save(s.db); err != nil {
+		s.log.Error("saving scrape run failed", "err", err)
 		return
 	}
-	cache.Put(link, "nil")
-	cache.IncreaseTTL(link, time.Hour*24)
-	s.logger.InfoLogger.Printf("Added new link to cache: %s with TTL of 24 hours\n", link)
+	run := s.stats.snapshot()
+	s.log.Info("scrape run finished", "status", run.Status, "listing_pages", run.ListingPages, "detail_pages", run.DetailPages,
+		"events_new", run.EventsInserted, "events_updated", run.EventsUpdated, "errors", run.Errors)
+}
+
+// finishQuality checks the run's field fill rates against the baseline, raises any alerts, stores the
+// rates for the next runs and writes the run report
+func (s *scrape) finishQuality() *QualityReport {
+	report := s.quality.Report(s.db)
+	report.Raise(s.log, s.notifier)
+	if err := s.db.AddFillRates(report.FillRates()); err != nil {
+		s.log.Error("storing fill rates failed", "err", err)
+	}
+	path, err := report.Save(s.reportFolder)
+	if err != nil {
+		s.log.Error("writing run report failed", "err", err)
+	} else {
+		s.log.Info("run report written", "pages", report.Pages, "selector_alerts", len(report.Alerts), "path", path)
+	}
+	return report
+}
+
+// Archive is the html archive the collectors write to
+func (s *scrape) Archive() *Archive {
+	return s.archive
+}
+
+// Reparse rebuilds the events of the detail pages in the html archive without any network access. The
+// events of those pages are dropped first, so they come out exactly as the current parsers make of the
+// archive, events with no page in the archive are kept as they are. It all happens in one transaction,
+// a page that fails to rebuild leaves the database as it was
+func (s *scrape) Reparse() (int, error) {
+	db := s.db
+	snapshots, err := db.LatestSnapshots(snapshotDetail)
+	if err != nil {
+		return 0, err
+	}
+	var urls []string
+	for _, snapshot := range snapshots {
+		if snapshot.Status == http.StatusOK {
+			urls = append(urls, snapshot.URL)
+		}
+	}
+	if len(urls) == 0 {
+		return 0, fmt.Errorf("the html archive has no detail pages to reparse")
+	}
+	// no crawl while the events are rebuilt, and none may start until it is done
+	s.mu.Lock()
+	if s.active != nil || s.offline {
+		s.mu.Unlock()
+		return 0, ErrRunInProgress
+	}
+	s.offline = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.offline = false
+		s.mu.Unlock()
+	}()
+	err = db.Transaction(func(tx *DB.Storage) error {
+		if err := tx.ResetEvents(urls); err != nil {
+			return fmt.Errorf("dropping the archived events: %w", err)
+		}
+		// a collector of its own: no redis cache, no archiving of what we replay, and every request served
+		// from disk. The crawl collectors are left as they are
+		replay := colly.NewCollector()
+		replay.WithTransport(s.archive.Transport())
+		s.storeDetailPages(replay, tx, nil)
+		for _, url := range urls {
+			if err := replay.Visit(url); err != nil {
+				return fmt.Errorf("reparsing %s: %w", url, err)
+			}
+			if !tx.EventExists(url) {
+				return fmt.Errorf("reparsing %s stored no event", url)
+			}
+		}
+		if _, err := tx.Deduplicate(); err != nil {
+			return fmt.Errorf("dedup pass: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(urls), nil
+}
+
+// startSites queues what the run visits: the seeds that are due, best first, and the detail pages due
+// for a revisit, or just what the run was limited to
+func (s *scrape) startSites(ctx context.Context, run *activeRun, mainsites chan string, details chan string, done chan bool) {
+	defer func() { done <- true }()
+	defer close(mainsites)
+	var listings, revisits []string
+	switch {
+	case run.opts.URL != "":
+		revisits = []string{run.opts.URL}
+	case len(run.opts.Seeds) > 0:
+		// asked for by name, due or not
+		for _, seed := range run.seeds {
+			listings = append(listings, seed.URL)
+		}
+	default:
+		listings = s.frontier.DueListings()
+		revisits = s.frontier.DueDetails()
+	}
+	s.stats.update(func(run *DB.ScrapeRun) { run.Seeds, run.DetailRevisits = len(listings), len(revisits) })
+	s.log.Info("queueing links", "seeds", len(listings), "revisits", len(revisits))
+	for _, link := range revisits {
+		select {
+		case details <- link:
+		case <-ctx.Done():
+			return
+		}
+	}
+	for _, link := range listings {
+		select {
+		case mainsites <- link:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *scrape) processLink(ctx context.Context, link string) {
+	// This function processes a single link concurrently
 	select {
 	case <-ctx.Done():
-		s.logger.ErrorLogger.Printf("(Main Scraper): Context canceled, skipping link: %s\n", link)
+		s.log.Warn("crawl ended, skipping link", "url", link)
 		return
 	default:
 		for i := 1; i < 5; i++ {
@@ -289,180 +595,232 @@ func (s *scrape) processLink(ctx context.Context, link string, cache Cache) {
 			s.mainScraper.Visit(completeUrl)
 			// Error handling is handled in the colly conifg
 		}
+		s.frontier.ListingVisited(link)
 	}
 }
 
-// Grab the  main links
-func (s *scrape) BeginScrape(links chan string) {
-	colorOutput.Green("Creating callback Function on main page")
-	s.mainScraper.OnHTML("section", func(e *colly.HTMLElement) {
-		e.ForEach("ul.SearchResultPanelContentEventCardList-module__eventList___2wk-D", func(_ int, el *colly.HTMLElement) {
-			//fmt.Println("Found <li> tag:", el.Text)
-			el.ForEach("li", func(_ int, el *colly.HTMLElement) {
-				event_link := el.ChildAttr("a", "href")
-				links <- event_link
-
-			})
+// Grab the  main links. Once ctx is done the workers stop taking links, so the rest are dropped instead of
+// waiting on a full queue
+func (s *scrape) BeginScrape(ctx context.Context, links chan string) {
+	s.mainScraper.OnHTML("html", func(e *colly.HTMLElement) {
+		sel := s.selectors.Current()
+		sel.Each(e, fieldEventCard, func(_ int, card *colly.HTMLElement) {
+			// links we already know only go out again when the frontier has them due
+			if event_link := sel.Text(card, fieldEventLink); event_link != "" && s.frontier.Found(e.Request.URL.String(), event_link) {
+				select {
+				case links <- event_link:
+				case <-ctx.Done():
+				}
+			}
 		})
-
 	})
 }
 
-func (s *scrape) ScrapeSidePages(ctx context.Context, source chan string) {
+func (s *scrape) scrapeSidePages(ctx context.Context, run *activeRun, source chan string) {
 	var wg sync.WaitGroup
-	workerPool := 50
-	str := fmt.Sprintf("Starting Side Scraper with %d go-routines", workerPool)
-	colorOutput.UnderlineGreen(str)
+	workerPool := s.settings.DetailWorkers
+	s.log.Debug("starting detail workers", "workers", workerPool)
 
 	wg.Add(workerPool)
 	for i := 0; i < workerPool; i++ {
 		go func() {
 			defer wg.Done()
 			for link := range source {
-				select {
-				case <-ctx.Done():
-					msg := "(Side Page Scraper): Context cancelled, stopping side page worker"
-					colorOutput.BoldRed(msg)
-					s.logger.ErrorLogger.Println(msg)
+				if err := run.gate.wait(ctx); err != nil {
+					s.log.Warn("crawl ended, stopping detail worker", "err", err)
 					return
-				default:
-					// Process the link
-					err := s.sideScraper.Visit(link)
-					if err != nil && err != colly.ErrAlreadyVisited {
-						s.logger.ErrorLogger.Printf("%s failed with following error %v", link, err)
-					}
+				}
+				// Process the link
+				run.detailBusy.Add(1)
+				err := s.sideScraper.Visit(link)
+				run.detailBusy.Add(-1)
+				if err != nil && err != colly.ErrAlreadyVisited {
+					s.log.Error("visiting event page failed", "url", link, "err", err)
 				}
 			}
 		}()
 	}
 	wg.Wait()
-	colorOutput.UnderlineGreen("Done proccessing side Pages.")
+	s.log.Debug("detail workers done")
 
 }
 
 func (s *scrape) BeginSideScrape(ctx context.Context, source chan string) {
-	colorOutput.UnderlineGreen("Creating Call back function on side pages")
-	const noRefunds = "No Refunds"
-	c := s.sideScraper
-	db := DB.GetStorage()
+	s.storeDetailPages(s.sideScraper, s.db, s.stats)
+}
 
+// storeDetailPages stores every detail page c fetches into db, counted in stats
+func (s *scrape) storeDetailPages(c *colly.Collector, db *DB.Storage, stats *runStats) {
 	c.OnHTML("body", func(h *colly.HTMLElement) {
-		// Extract data using CSS selectors
-		var addressFound bool
-		var validRefunds bool
-		host := h.ChildText("strong.organizer-listing-info-variant-b__name-link")
-		date := h.ChildText("span.date-info__full-datetime")
-		location := h.ChildText("p.location-info__address-text")
-		exactAddress := h.ChildText("div.location-info__address")
-		bio := h.ChildText("p.summary")
-		title := h.ChildText("h1.event-title.css-0")
-		imageURL := h.ChildAttr("img", "src")
-		const prefix = "Refund Policy"
-		refundPolicy := h.ChildText("section[aria-labelledby='refund-policy-heading'] div")
-		// checks if html has certain structre by checking len of parsed string. if long enough removes prefix and check if the refund policy is listed as no refunds. If it isnt then refund flag is Set to true as this means you must contact host for explicit refunds rules.
-
-		if len(refundPolicy) >= len(prefix) {
-
-			policy := refundPolicy[len(prefix):]
-			if policy != noRefunds {
-				validRefunds = true
-			}
-
+		page := parseDetail(h, s.selectors.Current(), time.Now())
+		if s.quality != nil {
+			s.quality.Record(page)
 		}
-		// Description (all paragraphs within a specific div)
-		var descriptionParts []string
-		h.ForEach("div.has-user-generated-content.event-description__content p", func(_ int, el *colly.HTMLElement) {
-			descriptionParts = append(descriptionParts, el.Text)
-		})
-
-		// Tags (list items with tag class)
-		var tags []string
-		h.ForEach("li.tags-item", func(_ int, el *colly.HTMLElement) {
-			tags = append(tags, el.Text)
-		})
-
-		// Extract additional information from li tags in ul.css-1i6cdnn
-		var extraInfo [][]string
-		h.ForEach("ul.css-1i6cdnn", func(i int, el *colly.HTMLElement) {
-			// Collect the text from each <li> in the <ul> and store it in listItems
-			el.ForEach("li", func(_ int, li *colly.HTMLElement) {
-				text := []string{li.Text}
-				extraInfo = append(extraInfo, text)
-			})
-
-		})
-
-		// Print the extracted extra info (this is for debugging)
-
-		// if exact address is present, no need to do geoFinding
-		if exactAddress != "" {
-			location = exactAddress
-			addressFound = true
+		if s.frontier != nil && !s.offline {
+			s.frontier.DetailVisited(page.Event.URL, page.Event.StartsAt)
 		}
-
-		// Create an Event struct to store the data
-		event := DB.Event{
-			ImageUrl:       imageURL,
-			Host:           host,
-			Title:          title,
-			Date:           date,
-			Location:       location,
-			Description:    strings.Join(descriptionParts, "\n"),
-			Tags:           strings.Join(tags, ", "),
-			Bio:            bio,
-			ExactAddress:   addressFound,
-			ExtraInfo:      flattenAndJoin(extraInfo), // Store the extracted extra info
-			AcceptsRefunds: validRefunds,
-		}
-
-		if !event.ExactAddress {
-			location = "NUllAddress"
-		}
-		id := db.AddEvent(event)
-		if event.ExactAddress && event.Location != "" {
-			eventLoInfo := s.addressCleaner.ReverseGeoCode(event.Location)
-			db.AddGeoPoint(title, id, DB.NewGeoPoint(eventLoInfo.Latitude, eventLoInfo.Longitude, eventLoInfo.Address))
-			return
+		s.storeDetail(db, stats, page)
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if s.frontier != nil && !s.offline {
+			s.frontier.DetailFailed(r.Request.URL.String(), r.StatusCode)
 		}
-		lat, long := -1.1, -1.1 //s.addressToCordnites(location)
-		db.AddGeoPoint(title, id, DB.NewGeoPoint(lat, long, location))
 	})
 
 }
+
+// storeDetail classifies a parsed detail page, resolves its organizer and venue and writes it all out.
+// What it does is counted in stats, nil when the page isnt part of a crawl.
+// Returns the event as stored and its geo point, nil for online events
+func (s *scrape) storeDetail(db *DB.Storage, stats *runStats, page *DetailPage) (DB.Event, *DB.GeoPoint) {
+	event := page.Event
+	s.classifier.Apply(&event)
+	organizer := page.Organizer
+	if resolved := db.ResolveOrganizer(organizer.Name, organizer.URL, organizer.Bio, organizer.Followers); resolved != nil {
+		event.OrganizerID = resolved.ID
+	}
+
+	if event.AttendanceMode == AttendanceOnline {
+		// nothing to geocode, and no placeholder GeoPoint either
+		event.ID = s.storeEvent(db, stats, event, page)
+		return event, nil
+	}
+	parsed := page.Location.Parsed
+	if page.Location.Exact && page.Location.Text != "" {
+		venue, address := s.resolveVenue(db, stats, parsed, page.Location.Text)
+		event.VenueID = venue.ID
+		event.ID = s.storeEvent(db, stats, event, page)
+		if err := db.CountVenueEvents(venue.ID); err != nil {
+			s.log.Error("counting venue events failed", "venue_id", venue.ID, "err", err)
+		}
+		geo := withAddressParts(DB.NewGeoPoint(venue.Latitude, venue.Longitude, address), parsed)
+		db.AddGeoPoint(event.Title, event.ID, geo)
+		return event, geo
+	}
+	event.ID = s.storeEvent(db, stats, event, page)
+	// no exact address, the geo point keeps the location text (it used to be "NUllAddress") so the
+	// geocode backfill has something to look up
+	lat, long := -1.1, -1.1 //s.addressToCordnites(location)
+	geo := withAddressParts(DB.NewGeoPoint(lat, long, page.Location.Text), parsed)
+	db.AddGeoPoint(event.Title, event.ID, geo)
+	return event, geo
+}
+
 func (s *scrape) parseAddress(address string) string {
 	var c CLeaner
 	address, err := c.ParseAddress(address)
 	if err != nil {
-		s.logger.ErrorLogger.Println("parsing addrress ", err)
+		s.log.Error("parsing address failed", "err", err)
 		return ""
 	}
 	return address
 	// do a googlesearch  and then do span.LrzXr colly scapre to parse out the address adn return that
 }
 
+// resolveVenue maps an address onto a venue. Venues we have already geocoded are reused as is, so the
+// geocoding api only gets called once per venue instead of once per event
+func (s *scrape) resolveVenue(db *DB.Storage, stats *runStats, parsed ParsedAddress, raw string) (*DB.Venue, string) {
+	// geocoders do a lot better with the cleaned up form than the raw page text
+	canonical := parsed.Canonical()
+	if canonical == "" {
+		canonical = raw
+	}
+	// a venue the geocoder already failed on is left to the backfill job, not looked up for every event
+	if venue, found := db.VenueByAddress(canonical); found && (venue.HasCoordinates() || venue.GeocodeFailedAt != nil || s.offline) {
+		s.log.Debug("reusing venue", "venue_id", venue.ID, "address", canonical)
+		return venue, canonical
+	}
+	if s.offline {
+		// no geocoding without the network, the venue gets its coordinates the next time it is crawled
+		return db.ResolveVenue(parsed.Venue, canonical, -1, -1), canonical
+	}
+	if stats != nil {
+		stats.geocoded()
+	}
+	eventLoInfo := s.addressCleaner.ReverseGeoCode(canonical)
+	address := eventLoInfo.Address
+	if address == "" {
+		address = canonical
+	}
+	venue := db.ResolveVenue(parsed.Venue, canonical, eventLoInfo.Latitude, eventLoInfo.Longitude)
+	if !venue.HasCoordinates() {
+		if err := db.VenueGeocodeFailed(venue.ID); err != nil {
+			s.log.Error("recording the geocode failure failed", "venue_id", venue.ID, "err", err)
+		}
+	}
+	return venue, address
+}
+
+// storeEvent writes the event along with everything hanging off it (info, tags, series dates, organizer
+// count) and returns its id
+func (s *scrape) storeEvent(db *DB.Storage, stats *runStats, event DB.Event, page *DetailPage) int {
+	id, updated := db.AddEvent(event)
+	if stats != nil && !s.offline {
+		stats.stored(updated)
+	}
+	if err := db.CountOrganizerEvents(event.OrganizerID); err != nil {
+		s.log.Error("counting organizer events failed", "organizer_id", event.OrganizerID, "err", err)
+	}
+	db.AddEventInfo(event.Title, id, page.Info)
+	if err := db.TagEvent(id, page.Tags); err != nil {
+		s.log.Error("tagging event failed", "event_id", id, "err", err)
+	}
+	db.AddOccurrences(event.Title, id, page.Occurrences)
+	return id
+}
+
+// utc normalizes times before they are stored, the date filters compare them as text
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// withAddressParts copies the parsed address components onto a GeoPoint before it is stored
+func withAddressParts(g *DB.GeoPoint, p ParsedAddress) *DB.GeoPoint {
+	g.Venue = p.Venue
+	g.Street = p.Street
+	g.City = p.City
+	g.State = p.State
+	g.PostalCode = p.PostalCode
+	g.Country = p.Country
+	g.Canonical = p.Canonical()
+	return g
+}
+
 func (s *scrape) addressToCordnites(address string) (float64, float64) {
-	var geoCoder = geoCoderInstance()
-	lat, long, err := geoCoder.streetToCordinates(address)
+	if s.geocoder == nil {
+		return -1, -1
+	}
+	lat, long, err := s.geocoder.streetToCordinates(address)
 	if err != nil {
-		s.logger.ErrorLogger.Println(err)
+		s.log.Error("geocoding failed", "address", address, "err", err)
 		return -1, -1 // if for what ever reason theres an error just log it and have -1 be the placeholders
 	}
 	return lat, long
 }
 
-func printEvent(event DB.Event) {
-	fmt.Println("Host:", event.Host)
-	fmt.Println("Title:", event.Title)
-	fmt.Println("Date:", event.Date)
-	fmt.Println("Location:", event.Location)
-	fmt.Println("Description:", event.Description)
-	fmt.Println("Tags:", event.Tags)
-	fmt.Println("Bio:", event.Bio)
-	fmt.Println("ExactAddress Found:", event.ExactAddress)
-	fmt.Println("Extra Info:", event.ExtraInfo)
-	fmt.Println("image Url:", event.ImageUrl)
-	fmt.Println("accepts refunds:", event.AcceptsRefunds)
+var followerCount = regexp.MustCompile(`(?i)([\d.,]+)\s*([km]?)\s+followers`)
 
+// parseFollowerCount turns "12.3k followers" into 12300. Returns 0 when there is no count on the page
+func parseFollowerCount(text string) int {
+	match := followerCount.FindStringSubmatch(text)
+	if match == nil {
+		return 0
+	}
+	n, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", ""), 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(match[2]) {
+	case "k":
+		n *= 1000
+	case "m":
+		n *= 1000000
+	}
+	return int(n)
 }
 
 func flattenAndJoin(input [][]string) string {
@@ -0,0 +1,71 @@
+package scrape
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"lite/DB"
+)
+
+func TestParseFollowerCount(t *testing.T) {
+	tests := map[string]int{
+		"Jersey Jams 12.3k followers Follow": 12300,
+		"1,204 followers":                    1204,
+		"2M followers":                       2000000,
+		"Contact the organizer":              0,
+		"":                                   0,
+	}
+	for text, want := range tests {
+		if got := parseFollowerCount(text); got != want {
+			t.Errorf("parseFollowerCount(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
+
+func TestFailedGeocodeIsLeftToTheBackfill(t *testing.T) {
+	var lookups atomic.Int32
+	geocoder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		w.Write([]byte("[]"))
+	}))
+	defer geocoder.Close()
+	db, err := DB.NewStorage(filepath.Join(t.TempDir(), "geocode.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleaner := newAddressCleaner(discardLogger(), "fake-key")
+	cleaner.baseURL = geocoder.URL
+	s := NewScraper(nil, nil, discardLogger(), cleaner)
+
+	parsed := ParseAddressOffline("Convention Hall, 1300 Ocean Ave, Asbury Park, NJ 07712")
+	first, _ := s.resolveVenue(db, nil, parsed, "")
+	second, _ := s.resolveVenue(db, nil, parsed, "")
+	if first.ID != second.ID || lookups.Load() != 1 {
+		t.Fatalf("venues %d and %d after %d lookups, want one venue looked up once", first.ID, second.ID, lookups.Load())
+	}
+	if second.GeocodeFailedAt == nil {
+		t.Error("the failed lookup isnt recorded on the venue")
+	}
+	if venues, err := db.UngeocodedVenues(10); err != nil || len(venues) != 1 {
+		t.Errorf("the backfill doesnt see the venue: %v %v", venues, err)
+	}
+}
+
+func TestRevisitCountsAsUpdate(t *testing.T) {
+	db, err := DB.NewStorage(filepath.Join(t.TempDir(), "revisit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScraper(nil, nil, discardLogger(), nil)
+	stats := newRunStats("full", nil, "")
+	event := DB.Event{URL: "https://www.eventbrite.com/e/jazz-night-101", Title: "Jazz Night"}
+	first := s.storeEvent(db, stats, event, &DetailPage{})
+	second := s.storeEvent(db, stats, event, &DetailPage{})
+	run := stats.snapshot()
+	if first != second || run.EventsInserted != 1 || run.EventsUpdated != 1 {
+		t.Errorf("events %d and %d, inserted %d updated %d", first, second, run.EventsInserted, run.EventsUpdated)
+	}
+}
@@ -0,0 +1,271 @@
+package scrape
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/*
+The listing pages a crawl starts from are generated from city csvs. Which csvs, which of their columns
+hold the city, region and population, the url every row turns into and which rows are worth a visit all
+live in static_CSV/seeds.json. Every enabled list is read and checked when the scraper starts, a missing
+file or column is an error there and not a log.Fatal halfway through a crawl.
+A url template has {base} for the site and one {name} per entry in columns or values, every value is
+lowercased with spaces turned into dashes the way eventbrite spells places
+*/
+
+const seedsFile = "seeds.json"
+
+var templateVar = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// SeedList turns the rows of one csv into seed urls
+type SeedList struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"` // relative to the seeds file
+	// template variable -> csv column it is read from
+	Columns map[string]string `json:"columns"`
+	// template variables that are the same for every row
+	Values map[string]string `json:"values,omitempty"`
+	URL    string            `json:"url"`
+	// rows with a population below this are skipped, needs a population column
+	MinPopulation int `json:"min_population,omitempty"`
+	// only rows whose region is one of these, needs a region column or value
+	Regions []string `json:"regions,omitempty"`
+
+	rows []map[string]string
+}
+
+// Seed is one listing page to start crawling from
+type Seed struct {
+	List       string
+	URL        string
+	Population int // 0 when the list has no population column
+}
+
+type SeedRegistry struct {
+	Source string     `json:"source"`
+	Lists  []SeedList `json:"lists"`
+}
+
+// LoadSeeds reads and validates a seed registry. The csvs of every enabled list are read right away
+func LoadSeeds(path string) (*SeedRegistry, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading seeds: %w", err)
+	}
+	registry, err := parseSeeds(raw, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return registry, nil
+}
+
+// parseSeeds validates a registry whose csvs are relative to dir
+func parseSeeds(raw []byte, dir string) (*SeedRegistry, error) {
+	var registry SeedRegistry
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&registry); err != nil {
+		return nil, fmt.Errorf("parsing seeds: %w", err)
+	}
+	if len(registry.Lists) == 0 {
+		return nil, fmt.Errorf("no seed lists")
+	}
+	names := make(map[string]bool)
+	enabled := 0
+	for i := range registry.Lists {
+		list := &registry.Lists[i]
+		if list.Name == "" || names[list.Name] {
+			return nil, fmt.Errorf("list %d needs a unique name", i+1)
+		}
+		names[list.Name] = true
+		if !list.Enabled {
+			continue
+		}
+		enabled++
+		if err := list.load(dir); err != nil {
+			return nil, fmt.Errorf("list %s: %w", list.Name, err)
+		}
+	}
+	if enabled == 0 {
+		return nil, fmt.Errorf("every seed list is disabled")
+	}
+	return &registry, nil
+}
+
+func (l *SeedList) load(dir string) error {
+	if l.URL == "" || l.File == "" {
+		return fmt.Errorf("file and url are required")
+	}
+	for _, match := range templateVar.FindAllStringSubmatch(l.URL, -1) {
+		name := match[1]
+		if _, ok := l.Columns[name]; name != "base" && !ok {
+			if _, ok := l.Values[name]; !ok {
+				return fmt.Errorf("url uses {%s} but it is not a column or a value", name)
+			}
+		}
+	}
+	if _, ok := l.Columns["population"]; l.MinPopulation > 0 && !ok {
+		return fmt.Errorf("min_population needs a population column")
+	}
+	_, regionColumn := l.Columns["region"]
+	if _, regionValue := l.Values["region"]; len(l.Regions) > 0 && !regionColumn && !regionValue {
+		return fmt.Errorf("regions needs a region column or value")
+	}
+
+	file, err := os.Open(filepath.Join(dir, l.File))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", l.File, err)
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("%s is empty", l.File)
+	}
+	// first row names the columns
+	header := make(map[string]int, len(records[0]))
+	for i, column := range records[0] {
+		header[strings.TrimSpace(column)] = i
+	}
+	index := make(map[string]int, len(l.Columns))
+	for name, column := range l.Columns {
+		i, ok := header[column]
+		if !ok {
+			return fmt.Errorf("%s has no column %q for {%s}", l.File, column, name)
+		}
+		index[name] = i
+	}
+	l.rows = l.rows[:0]
+	for line, record := range records[1:] {
+		row := make(map[string]string, len(index)+len(l.Values))
+		for name, value := range l.Values {
+			row[name] = value
+		}
+		for name, i := range index {
+			if i >= len(record) {
+				return fmt.Errorf("%s line %d is missing column %q", l.File, line+2, l.Columns[name])
+			}
+			row[name] = strings.TrimSpace(record[i])
+		}
+		l.rows = append(l.rows, row)
+	}
+	return nil
+}
+
+// Seeds expands every enabled list against base, each url only once even when lists overlap
+func (r *SeedRegistry) Seeds(base string) []Seed {
+	var seeds []Seed
+	seen := make(map[string]bool)
+	for _, list := range r.Lists {
+		if !list.Enabled {
+			continue
+		}
+		for _, seed := range list.seeds(base) {
+			if seen[seed.URL] {
+				continue
+			}
+			seen[seed.URL] = true
+			seeds = append(seeds, seed)
+		}
+	}
+	return seeds
+}
+
+// ListSeeds is Seeds for only the named lists, all enabled lists when none are named
+func (r *SeedRegistry) ListSeeds(base string, names ...string) ([]Seed, error) {
+	if len(names) == 0 {
+		return r.Seeds(base), nil
+	}
+	only := &SeedRegistry{Source: r.Source}
+	for _, name := range names {
+		found := false
+		for _, list := range r.Lists {
+			if list.Name != name {
+				continue
+			}
+			if !list.Enabled {
+				return nil, fmt.Errorf("seed list %s is disabled", name)
+			}
+			only.Lists = append(only.Lists, list)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("no seed list named %s", name)
+		}
+	}
+	return only.Seeds(base), nil
+}
+
+func (l *SeedList) seeds(base string) []Seed {
+	regions := make(map[string]bool, len(l.Regions))
+	for _, region := range l.Regions {
+		regions[strings.ToLower(region)] = true
+	}
+	var seeds []Seed
+	for _, row := range l.rows {
+		population, err := strconv.ParseFloat(strings.ReplaceAll(row["population"], ",", ""), 64)
+		if l.MinPopulation > 0 && (err != nil || population < float64(l.MinPopulation)) {
+			continue
+		}
+		if len(regions) > 0 && !regions[strings.ToLower(row["region"])] {
+			continue
+		}
+		empty := false
+		url := templateVar.ReplaceAllStringFunc(l.URL, func(match string) string {
+			name := match[1 : len(match)-1]
+			if name == "base" {
+				return base
+			}
+			value := seedSlug(row[name])
+			if value == "" {
+				empty = true
+			}
+			return value
+		})
+		// a row missing the city would send us to the listing of the whole region
+		if !empty {
+			seeds = append(seeds, Seed{List: l.Name, URL: url, Population: int(population)})
+		}
+	}
+	return seeds
+}
+
+func seedSlug(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), "-")
+}
+
+// DryRunSeeds loads the seed registry the scraper would use and writes every seed it generates for the
+// site at base to w, followed by how many each list added. Nothing is fetched
+func DryRunSeeds(w io.Writer, base string) error {
+	registry, err := LoadSeeds(filepath.Join(staticFolder, seedsFile))
+	if err != nil {
+		return err
+	}
+	seeds := registry.Seeds(strings.TrimRight(base, "/"))
+	counts := make(map[string]int)
+	for _, seed := range seeds {
+		counts[seed.List]++
+		fmt.Fprintf(w, "%s\t%s\n", seed.List, seed.URL)
+	}
+	for _, list := range registry.Lists {
+		if list.Enabled {
+			fmt.Fprintf(w, "# %s: %d seeds from %s\n", list.Name, counts[list.Name], list.File)
+		} else {
+			fmt.Fprintf(w, "# %s: disabled\n", list.Name)
+		}
+	}
+	fmt.Fprintf(w, "# %d seeds\n", len(seeds))
+	return nil
+}
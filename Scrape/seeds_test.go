@@ -0,0 +1,106 @@
+package scrape
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lite/config"
+)
+
+func TestShippedSeeds(t *testing.T) {
+	registry, err := LoadSeeds(filepath.Join("..", staticFolder, seedsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := registry.Seeds(config.Default().Scrape.BaseURL)
+	if len(seeds) != 30 {
+		t.Fatalf("got %d seeds, want the 30 cities of nj.csv", len(seeds))
+	}
+	if seeds[1].URL != "https://www.eventbrite.com/d/nj--jersey-city/all-events/" {
+		t.Errorf("second seed = %s", seeds[1].URL)
+	}
+
+	// the disabled lists have to hold up too, for the day they are switched on
+	raw, err := os.ReadFile(filepath.Join("..", staticFolder, seedsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := strings.ReplaceAll(string(raw), `"enabled": false`, `"enabled": true`)
+	if _, err := parseSeeds([]byte(enabled), filepath.Join("..", staticFolder)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSeedFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "cities.csv"), "city,country,population\nToronto,Canada,\"5,647,656\"\nKingston,Canada,132485\nSan Juan,Puerto Rico,2000000\n,Canada,9000000\n")
+	writeFile(t, filepath.Join(dir, seedsFile), `{"source": "eventbrite", "lists": [
+		{"name": "big", "enabled": true, "file": "cities.csv", "columns": {"city": "city", "region": "country", "population": "population"},
+		 "url": "{base}/d/{region}--{city}/events/", "min_population": 1000000, "regions": ["canada", "Puerto Rico"]},
+		{"name": "again", "enabled": true, "file": "cities.csv", "columns": {"city": "city"}, "values": {"region": "canada"},
+		 "url": "{base}/d/{region}--{city}/events/", "regions": ["canada"]}]}`)
+	registry, err := LoadSeeds(filepath.Join(dir, seedsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, seed := range registry.Seeds("http://fake") {
+		got = append(got, seed.List+" "+seed.URL)
+	}
+	want := []string{
+		"big http://fake/d/canada--toronto/events/",
+		"big http://fake/d/puerto-rico--san-juan/events/",
+		"again http://fake/d/canada--kingston/events/",
+		"again http://fake/d/canada--san-juan/events/",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("seeds:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if only, err := registry.ListSeeds("http://fake", "again"); err != nil || len(only) != 3 || only[0].URL != "http://fake/d/canada--toronto/events/" {
+		t.Errorf("seeds of the again list = %v, %v", only, err)
+	}
+	if _, err := registry.ListSeeds("http://fake", "nj"); err == nil {
+		t.Error("crawled a list that doesnt exist")
+	}
+}
+
+func TestSeedValidation(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "cities.csv"), "name,state\nNewark,NJ\n")
+	tests := map[string]string{
+		"missing file":     `{"name": "us", "enabled": true, "file": "us_cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}"}`,
+		"missing column":   `{"name": "us", "enabled": true, "file": "cities.csv", "columns": {"city": "city"}, "url": "{base}/d/{city}"}`,
+		"unknown variable": `{"name": "us", "enabled": true, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{state}--{city}"}`,
+		"no population":    `{"name": "us", "enabled": true, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}", "min_population": 5}`,
+		"no region":        `{"name": "us", "enabled": true, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}", "regions": ["nj"]}`,
+		"unknown key":      `{"name": "us", "enabled": true, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}", "country": "us"}`,
+		"nothing enabled":  `{"name": "us", "enabled": false, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}"}`,
+		"duplicate name":   `{"name": "us", "enabled": true, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}"}, {"name": "us", "file": "cities.csv"}`,
+	}
+	for name, lists := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_")+".json")
+			writeFile(t, path, `{"source": "eventbrite", "lists": [`+lists+`]}`)
+			if _, err := LoadSeeds(path); err == nil {
+				t.Error("loaded without an error")
+			}
+		})
+	}
+	// disabled lists are not read, a missing csv there is fine
+	path := filepath.Join(dir, "disabled.json")
+	writeFile(t, path, `{"source": "eventbrite", "lists": [
+		{"name": "nj", "enabled": true, "file": "cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}"},
+		{"name": "us", "enabled": false, "file": "us_cities.csv", "columns": {"city": "name"}, "url": "{base}/d/{city}"}]}`)
+	if _, err := LoadSeeds(path); err != nil {
+		t.Error(err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
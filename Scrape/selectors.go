@@ -0,0 +1,393 @@
+package scrape
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/gocolly/colly"
+)
+
+/*
+The css selectors for each source live in selectors/<source>.json instead of the code, so when the site
+changes its markup (the listing class is a build hash that changes every few months) it is a file edit
+and not a deploy. Every field has a list of selectors tried in order, the first one that finds
+something wins, and can read an attribute instead of the text.
+A file is only used after it passes validation: every field is known and compiles, and the required ones
+find something in the sample pages that sit next to it. The running scraper polls the file and swaps in
+a new version when it changes, a broken edit is logged and the old selectors stay in use
+*/
+
+const (
+	selectorFolder      = "selectors"
+	eventbriteSelectors = "eventbrite.json"
+	selectorPollEvery   = 30 * time.Second
+)
+
+// listing page fields
+const (
+	fieldEventCard = "event_card"
+	fieldEventLink = "event_link" // inside an event card
+)
+
+// detail page fields
+const (
+	fieldTitle        = "title"
+	fieldHost         = "host"
+	fieldDate         = "date"
+	fieldLocation     = "location"
+	fieldExactAddress = "exact_address"
+	fieldBio          = "bio"
+	fieldOrganizerURL = "organizer_url"
+	fieldFollowers    = "followers"
+	fieldImage        = "image"
+	fieldRefundPolicy = "refund_policy"
+	fieldDescription  = "description"
+	fieldTags         = "tags"
+	fieldExtraInfo    = "extra_info"
+	fieldDatetimes    = "datetimes"
+)
+
+var (
+	listingFields = []string{fieldEventCard, fieldEventLink}
+	// fields read with Values instead of Text, every element the selector finds counts
+	multiValueFields = map[string]bool{fieldDescription: true, fieldTags: true, fieldExtraInfo: true, fieldDatetimes: true}
+	detailFields     = []string{
+		fieldTitle, fieldHost, fieldDate, fieldLocation, fieldExactAddress, fieldBio, fieldOrganizerURL,
+		fieldFollowers, fieldImage, fieldRefundPolicy, fieldDescription, fieldTags, fieldExtraInfo, fieldDatetimes,
+	}
+)
+
+// Selector finds one field. CSS holds fallbacks, tried in order
+type Selector struct {
+	CSS  []string `json:"css"`
+	Attr string   `json:"attr,omitempty"` // read this attribute instead of the text
+	// a required field has to show up in the sample page for the file to be accepted
+	Required bool `json:"required,omitempty"`
+}
+
+type SelectorSet struct {
+	Source  string              `json:"source"`
+	Version string              `json:"version"`
+	Listing map[string]Selector `json:"listing"`
+	Detail  map[string]Selector `json:"detail"`
+	// sample pages the selectors are checked against, relative to the file
+	Samples struct {
+		Listing string `json:"listing"`
+		Detail  string `json:"detail"`
+	} `json:"samples"`
+}
+
+// Text returns the first non empty value any of the field's selectors finds under h
+func (s *SelectorSet) Text(h *colly.HTMLElement, field string) string {
+	return firstValue(h.DOM, s.selector(field))
+}
+
+// Each calls fn for everything the first matching selector of the field finds under h
+func (s *SelectorSet) Each(h *colly.HTMLElement, field string, fn func(int, *colly.HTMLElement)) {
+	sel := s.selector(field)
+	for _, css := range sel.CSS {
+		found := h.DOM.Find(css)
+		if found.Length() == 0 {
+			continue
+		}
+		found.Each(func(i int, el *goquery.Selection) {
+			fn(i, colly.NewHTMLElementFromSelectionNode(h.Response, el, el.Nodes[0], i))
+		})
+		return
+	}
+}
+
+// Values returns the value of every element the first matching selector of the field finds under h
+func (s *SelectorSet) Values(h *colly.HTMLElement, field string) []string {
+	sel := s.selector(field)
+	var values []string
+	s.Each(h, field, func(_ int, el *colly.HTMLElement) {
+		values = append(values, value(el.DOM, sel.Attr))
+	})
+	return values
+}
+
+func (s *SelectorSet) selector(field string) Selector {
+	if sel, ok := s.Detail[field]; ok {
+		return sel
+	}
+	return s.Listing[field]
+}
+
+// FieldMatch is which of a field's selectors produced its value on a page
+type FieldMatch struct {
+	// empty when none of them found anything
+	CSS string `json:"css,omitempty"`
+	// position of CSS in the field's list, 0 is the primary selector and anything above a fallback
+	Fallback int    `json:"fallback"`
+	Attr     string `json:"attr,omitempty"`
+	Value    string `json:"value,omitempty"`
+	// elements found, for the fields that take every one of them
+	Count int `json:"count,omitempty"`
+}
+
+// Match tells which selector of the field Text or Values would take its value from under h
+func (s *SelectorSet) Match(h *colly.HTMLElement, field string) FieldMatch {
+	sel := s.selector(field)
+	match := FieldMatch{Fallback: -1, Attr: sel.Attr}
+	if !multiValueFields[field] {
+		if value, i := firstMatch(h.DOM, sel); i >= 0 {
+			match.CSS, match.Fallback, match.Value = sel.CSS[i], i, value
+		}
+		return match
+	}
+	for i, css := range sel.CSS {
+		found := h.DOM.Find(css)
+		if found.Length() == 0 {
+			continue
+		}
+		match.CSS, match.Fallback, match.Count = css, i, found.Length()
+		match.Value = strings.TrimSpace(value(found.First(), sel.Attr))
+		break
+	}
+	return match
+}
+
+func firstValue(root *goquery.Selection, sel Selector) string {
+	value, _ := firstMatch(root, sel)
+	return value
+}
+
+// firstMatch is firstValue along with the index of the selector it came from, -1 when nothing matched
+func firstMatch(root *goquery.Selection, sel Selector) (string, int) {
+	for i, css := range sel.CSS {
+		found := root.Find(css)
+		if found.Length() == 0 {
+			continue
+		}
+		if sel.Attr != "" {
+			// like colly's ChildAttr, the first element that has the attribute
+			var attr string
+			found.EachWithBreak(func(_ int, el *goquery.Selection) bool {
+				attr, _ = el.Attr(sel.Attr)
+				attr = strings.TrimSpace(attr)
+				return attr == ""
+			})
+			if attr != "" {
+				return attr, i
+			}
+			continue
+		}
+		if text := strings.TrimSpace(found.Text()); text != "" {
+			return text, i
+		}
+	}
+	return "", -1
+}
+
+func value(el *goquery.Selection, attr string) string {
+	if attr == "" {
+		return el.Text()
+	}
+	v, _ := el.Attr(attr)
+	return strings.TrimSpace(v)
+}
+
+// LoadSelectors reads and validates a selector file
+func LoadSelectors(path string) (*SelectorSet, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading selectors: %w", err)
+	}
+	var set SelectorSet
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&set); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := set.validate(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &set, nil
+}
+
+func (s *SelectorSet) validate(dir string) error {
+	if s.Source == "" || s.Version == "" {
+		return fmt.Errorf("source and version are required")
+	}
+	if err := checkFields("listing", s.Listing, listingFields); err != nil {
+		return err
+	}
+	if err := checkFields("detail", s.Detail, detailFields); err != nil {
+		return err
+	}
+	if s.Samples.Listing == "" || s.Samples.Detail == "" {
+		return fmt.Errorf("a listing and a detail sample page are required")
+	}
+
+	listing, err := loadSample(filepath.Join(dir, s.Samples.Listing))
+	if err != nil {
+		return err
+	}
+	var cards *goquery.Selection
+	for _, css := range s.Listing[fieldEventCard].CSS {
+		if found := listing.Find(css); found.Length() > 0 {
+			cards = found
+			break
+		}
+	}
+	if cards == nil {
+		return fmt.Errorf("no event cards found in the listing sample %s", s.Samples.Listing)
+	}
+	var links int
+	cards.Each(func(_ int, card *goquery.Selection) {
+		if firstValue(card, s.Listing[fieldEventLink]) != "" {
+			links++
+		}
+	})
+	if links == 0 {
+		return fmt.Errorf("no event links found in the listing sample %s", s.Samples.Listing)
+	}
+
+	detail, err := loadSample(filepath.Join(dir, s.Samples.Detail))
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, field := range detailFields {
+		sel := s.Detail[field]
+		if sel.Required && firstValue(detail, sel) == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required fields not found in the detail sample %s: %s", s.Samples.Detail, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkFields(page string, got map[string]Selector, want []string) error {
+	known := make(map[string]bool, len(want))
+	for _, field := range want {
+		known[field] = true
+		sel, ok := got[field]
+		if !ok || len(sel.CSS) == 0 {
+			return fmt.Errorf("%s field %q has no selectors", page, field)
+		}
+		for _, css := range sel.CSS {
+			if _, err := cascadia.Compile(css); err != nil {
+				return fmt.Errorf("%s field %q: invalid selector %q: %w", page, field, css, err)
+			}
+		}
+	}
+	var unknown []string
+	for field := range got {
+		if !known[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown %s fields: %s", page, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func loadSample(path string) (*goquery.Selection, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sample page: %w", err)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("parsing sample page %s: %w", path, err)
+	}
+	return doc.Selection, nil
+}
+
+// SelectorStore holds the selectors currently in use and swaps in new versions of the file
+type SelectorStore struct {
+	path    string
+	mu      sync.RWMutex
+	current *SelectorSet
+	modTime time.Time
+}
+
+// NewSelectorStore loads the file, failing if it doesnt validate
+func NewSelectorStore(path string) (*SelectorStore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading selectors: %w", err)
+	}
+	set, err := LoadSelectors(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SelectorStore{path: path, current: set, modTime: info.ModTime()}, nil
+}
+
+// StaticSelectors wraps an already loaded set that never reloads
+func StaticSelectors(set *SelectorSet) *SelectorStore {
+	return &SelectorStore{current: set}
+}
+
+func (s *SelectorStore) Current() *SelectorSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Reload picks up the file if it changed since the last load. A file that doesnt validate is not used,
+// the error is returned and the previous selectors stay in place
+func (s *SelectorStore) Reload() (bool, error) {
+	if s.path == "" {
+		return false, nil
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	set, err := LoadSelectors(s.path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// remember the broken version too, so it is reported once and not on every poll
+	s.modTime = info.ModTime()
+	if err != nil {
+		return false, err
+	}
+	s.current = set
+	return true, nil
+}
+
+// Watch polls the file for changes until stop is closed
+func (s *SelectorStore) Watch(every time.Duration, logger *slog.Logger, stop <-chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := s.Reload()
+			if err != nil {
+				logger.Error("selectors not reloaded", "version", s.Current().Version, "err", err)
+				continue
+			}
+			if reloaded {
+				set := s.Current()
+				logger.Info("reloaded selectors", "source", set.Source, "version", set.Version)
+			}
+		}
+	}
+}
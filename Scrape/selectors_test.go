@@ -0,0 +1,109 @@
+package scrape
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSelectors copies the real selector file and its samples into a temp dir, letting edit change the set first
+func writeSelectors(t *testing.T, dir string, edit func(*SelectorSet)) string {
+	t.Helper()
+	set, err := LoadSelectors(filepath.Join("..", selectorFolder, eventbriteSelectors))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sample := range []string{set.Samples.Listing, set.Samples.Detail} {
+		raw, err := os.ReadFile(filepath.Join("..", selectorFolder, sample))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(sample)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, sample), raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if edit != nil {
+		edit(set)
+	}
+	raw, _ := json.Marshal(set)
+	path := filepath.Join(dir, eventbriteSelectors)
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSelectorValidation(t *testing.T) {
+	tests := map[string]struct {
+		edit func(*SelectorSet)
+		want string
+	}{
+		"required field missing from sample": {
+			func(s *SelectorSet) {
+				s.Detail[fieldTitle] = Selector{CSS: []string{"h1.renamed-title"}, Required: true}
+			},
+			"required fields not found",
+		},
+		"invalid css": {
+			func(s *SelectorSet) { s.Detail[fieldTags] = Selector{CSS: []string{"li[class="}} },
+			"invalid selector",
+		},
+		"unknown field": {
+			func(s *SelectorSet) { s.Detail["ticket_price"] = Selector{CSS: []string{"span.price"}} },
+			"unknown detail fields: ticket_price",
+		},
+		"listing class changed": {
+			func(s *SelectorSet) {
+				s.Listing[fieldEventCard] = Selector{CSS: []string{"ul.EventCardList-new li"}, Required: true}
+			},
+			"no event cards",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadSelectors(writeSelectors(t, t.TempDir(), tt.edit))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadSelectors error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectorReload(t *testing.T) {
+	dir := t.TempDir()
+	path := writeSelectors(t, dir, nil)
+	store, err := NewSelectorStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := store.Current().Version
+
+	// a broken edit is rejected and the running version stays
+	writeSelectors(t, dir, func(s *SelectorSet) {
+		s.Version = "broken"
+		s.Detail[fieldDate] = Selector{CSS: []string{"span.nope"}, Required: true}
+	})
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if reloaded, err := store.Reload(); reloaded || err == nil {
+		t.Fatalf("broken file reloaded = %v, err = %v", reloaded, err)
+	}
+	if store.Current().Version != old {
+		t.Fatalf("version changed to %q after a broken edit", store.Current().Version)
+	}
+
+	writeSelectors(t, dir, func(s *SelectorSet) { s.Version = "next" })
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+	if reloaded, err := store.Reload(); !reloaded || err != nil {
+		t.Fatalf("valid file reloaded = %v, err = %v", reloaded, err)
+	}
+	if store.Current().Version != "next" {
+		t.Errorf("version = %q after reload, want next", store.Current().Version)
+	}
+	if reloaded, _ := store.Reload(); reloaded {
+		t.Errorf("unchanged file reloaded again")
+	}
+}
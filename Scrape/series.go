@@ -0,0 +1,83 @@
+package scrape
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"lite/DB"
+)
+
+// the date block on a series page reads "Multiple dates" instead of a date
+var multipleDates = regexp.MustCompile(`(?i)\bmultiple dates\b`)
+
+// seriesOccurrences returns the individual dates of a recurring event, or nil when the page is a one
+// off. JSON-LD sub events carry start, end and capacity; when those are missing but the page says it
+// has multiple dates we fall back to the machine readable <time datetime> values on the page
+func seriesOccurrences(ld *jsonLDEvent, dateText string, datetimes []string) []DB.Occurrence {
+	var occurrences []DB.Occurrence
+	if ld != nil {
+		for _, sub := range ld.subEvents() {
+			start, ok := parseISODate(sub.StartDate)
+			if !ok {
+				continue
+			}
+			occurrence := DB.Occurrence{
+				StartsAt:          start.UTC(),
+				MaxCapacity:       int(sub.MaximumCapacity),
+				RemainingCapacity: int(sub.RemainingCapacity),
+				URL:               sub.URL,
+			}
+			if end, ok := parseISODate(sub.EndDate); ok {
+				occurrence.EndsAt = utc(&end)
+			}
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+	if len(occurrences) == 0 && multipleDates.MatchString(dateText) {
+		for _, value := range datetimes {
+			if start, ok := parseISODate(value); ok {
+				occurrences = append(occurrences, DB.Occurrence{StartsAt: start.UTC()})
+			}
+		}
+	}
+	if len(occurrences) < 2 {
+		// one date isnt a series
+		return nil
+	}
+	sort.SliceStable(occurrences, func(i, j int) bool { return occurrences[i].StartsAt.Before(occurrences[j].StartsAt) })
+	deduped := occurrences[:1]
+	for _, o := range occurrences[1:] {
+		if last := &deduped[len(deduped)-1]; o.StartsAt.Equal(last.StartsAt) {
+			mergeOccurrence(last, o)
+			continue
+		}
+		deduped = append(deduped, o)
+	}
+	return deduped
+}
+
+// mergeOccurrence fills in what kept is missing from a listing of the same date, so it doesnt matter
+// which of the two came first
+func mergeOccurrence(kept *DB.Occurrence, other DB.Occurrence) {
+	if kept.EndsAt == nil {
+		kept.EndsAt = other.EndsAt
+	}
+	if kept.MaxCapacity == 0 {
+		kept.MaxCapacity, kept.RemainingCapacity = other.MaxCapacity, other.RemainingCapacity
+	}
+	if kept.URL == "" {
+		kept.URL = other.URL
+	}
+}
+
+// nextOccurrence is the first date that hasnt started yet, or the last one when the whole series is over.
+// The parent event's StartsAt follows it so date sorting still puts the series in a sensible place
+func nextOccurrence(occurrences []DB.Occurrence, now time.Time) DB.Occurrence {
+	for _, o := range occurrences {
+		if !o.StartsAt.Before(now) {
+			return o
+		}
+	}
+	return occurrences[len(occurrences)-1]
+}
@@ -0,0 +1,56 @@
+package scrape
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSeriesOccurrences(t *testing.T) {
+	var ld jsonLDEvent
+	raw := `{"@type":"Event","name":"Weekly Trivia","subEvent":[
+		{"@type":"Event","startDate":"2025-03-12T19:00:00-04:00","endDate":"2025-03-12T21:00:00-04:00","maximumAttendeeCapacity":40,"remainingAttendeeCapacity":"12"},
+		{"@type":"Event","startDate":"2025-03-05T19:00:00-05:00","endDate":"2025-03-05T21:00:00-05:00","maximumAttendeeCapacity":40},
+		{"@type":"Event","startDate":"2025-03-05T19:00:00-05:00"}
+	]}`
+	if err := json.Unmarshal([]byte(raw), &ld); err != nil {
+		t.Fatal(err)
+	}
+	occurrences := seriesOccurrences(&ld, "Multiple dates", nil)
+	if len(occurrences) != 2 {
+		t.Fatalf("expected 2 occurrences, got %+v", occurrences)
+	}
+	first, second := occurrences[0], occurrences[1]
+	if !first.StartsAt.Equal(time.Date(2025, 3, 6, 0, 0, 0, 0, time.UTC)) || first.MaxCapacity != 40 {
+		t.Errorf("unexpected first occurrence %+v", first)
+	}
+	if second.RemainingCapacity != 12 || second.EndsAt == nil || second.EndsAt.Sub(second.StartsAt) != 2*time.Hour {
+		t.Errorf("unexpected second occurrence %+v", second)
+	}
+	if next := nextOccurrence(occurrences, time.Date(2025, 3, 8, 0, 0, 0, 0, time.UTC)); !next.StartsAt.Equal(second.StartsAt) {
+		t.Errorf("nextOccurrence() = %v, want %v", next.StartsAt, second.StartsAt)
+	}
+
+	// the same date listed bare before the full listing still keeps the capacity and the end
+	var reversed jsonLDEvent
+	raw = `{"@type":"Event","name":"Weekly Trivia","subEvent":[
+		{"@type":"Event","startDate":"2025-03-05T19:00:00-05:00"},
+		{"@type":"Event","startDate":"2025-03-12T19:00:00-04:00"},
+		{"@type":"Event","startDate":"2025-03-05T19:00:00-05:00","endDate":"2025-03-05T21:00:00-05:00","maximumAttendeeCapacity":40}
+	]}`
+	if err := json.Unmarshal([]byte(raw), &reversed); err != nil {
+		t.Fatal(err)
+	}
+	if first := seriesOccurrences(&reversed, "Multiple dates", nil)[0]; first.MaxCapacity != 40 || first.EndsAt == nil {
+		t.Errorf("the bare listing of a date won over the full one: %+v", first)
+	}
+
+	// no json-ld, fall back to the <time> tags
+	occurrences = seriesOccurrences(nil, "Multiple dates", []string{"2025-03-05T19:00:00-05:00", "2025-03-12T19:00:00-04:00"})
+	if len(occurrences) != 2 {
+		t.Fatalf("expected 2 occurrences from datetime attributes, got %+v", occurrences)
+	}
+	if occurrences := seriesOccurrences(nil, "Saturday, March 8 · 7pm", []string{"2025-03-05T19:00:00-05:00", "2025-03-12T19:00:00-04:00"}); occurrences != nil {
+		t.Fatalf("a one off event isnt a series, got %+v", occurrences)
+	}
+}
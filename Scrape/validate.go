@@ -5,16 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
-	"os"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v9"
+
+	"lite/config"
+	"lite/logging"
+	"lite/secrets"
 )
 
 const linkCooldown = time.Hour * 24
@@ -33,43 +35,54 @@ type Cache interface {
 	Valid(key string) bool
 	Flush()
 	Save() error
+	// Inspect and Stats are for operators looking at the cache from the command line
+	Inspect(key string) (CacheEntry, error)
+	Stats() (CacheStats, error)
 }
 
-func newCache() Cache {
-	return newRedis()
+// CacheEntry is one key as the cache holds it
+type CacheEntry struct {
+	Key   string `json:"key"`
+	Found bool   `json:"found"`
+	Value string `json:"value"`
+	// zero when the key never expires
+	TTL time.Duration `json:"ttl"`
 }
 
-// for now just run on local host
-func newRedis() *redCache {
-	redisAddr := os.Getenv("REDIS_ADDR")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379" // Default to localhost for local development
-	}
+type CacheStats struct {
+	Backend string `json:"backend"`
+	Keys    int64  `json:"keys"`
+	// the backend's own figures, redis' memory and keyspace info
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// OpenCache connects to the cache the scraper uses
+func OpenCache(cfg config.RedisConfig) Cache {
+	return newCache(cfg)
+}
+
+func newCache(cfg config.RedisConfig) Cache {
+	return newRedis(cfg)
+}
+
+func newRedis(cfg config.RedisConfig) *redCache {
 	client := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
+		Addr:     cfg.Addr,
 		Password: "", // No password set
-		DB:       0,  // Use default DB
+		DB:       cfg.DB,
 	})
-
-	fileName := fmt.Sprintf("%s_%s", "DB/cache", ".log")
-	logFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatalf("failed to create/open log file: %v", err)
-	}
 	return &redCache{
-		errorLog: logFile,
-		client:   client,
+		client: client,
 	}
 }
 
+var cacheLog = logging.For(logging.Cache)
+
 type redCache struct {
-	errorLog *os.File
-	mu       sync.Mutex
-	client   *redis.Client
+	mu     sync.Mutex
+	client *redis.Client
 }
 
-// TODO: add better error handling to the error log file. This is where well need a mutext to handle the writing operations
-
 func (r *redCache) contextTimeout(seconds int) (context.Context, context.CancelFunc) {
 	return context.WithDeadline(context.Background(), time.Now().Add(time.Second*time.Duration(seconds)))
 }
@@ -81,9 +94,9 @@ func (r *redCache) Flush() {
 	ctx, _ := r.contextTimeout(2)
 	_, err := r.client.FlushAll(ctx).Result()
 	if err != nil {
-		log.Fatalf("Error flushing all keys: %v", err)
+		logging.Fatal(cacheLog, "flushing all keys failed", "err", err)
 	}
-	fmt.Println("Just FLushed all keys")
+	cacheLog.Info("flushed all keys")
 
 }
 
@@ -156,39 +169,140 @@ func (r *redCache) SetTTl(key string, ttl time.Duration) error {
 	_, err := r.client.Expire(ctx, key, ttl).Result()
 	return err
 }
+func (r *redCache) Inspect(key string) (CacheEntry, error) {
+	ctx, cancel := r.contextTimeout(3)
+	defer cancel()
+	entry := CacheEntry{Key: key}
+	val, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return entry, nil
+	}
+	if err != nil {
+		return entry, err
+	}
+	entry.Found, entry.Value = true, val
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if err != nil {
+		return entry, err
+	}
+	if ttl > 0 {
+		entry.TTL = ttl
+	}
+	return entry, nil
+}
+
+func (r *redCache) Stats() (CacheStats, error) {
+	ctx, cancel := r.contextTimeout(3)
+	defer cancel()
+	stats := CacheStats{Backend: "redis", Details: make(map[string]string)}
+	keys, err := r.client.DBSize(ctx).Result()
+	if err != nil {
+		return stats, err
+	}
+	stats.Keys = keys
+	info, err := r.client.Info(ctx, "memory", "keyspace").Result()
+	if err != nil {
+		return stats, err
+	}
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if ok && (name == "used_memory_human" || name == "used_memory_peak_human" || strings.HasPrefix(name, "db")) {
+			stats.Details[name] = value
+		}
+	}
+	return stats, nil
+}
+
 func (r *redCache) Save() error {
-	r.errorLog.Close()
 	return nil
 }
 
+// CustomCache is an in memory Cache, for tests and for running without redis. Nothing survives a restart
 type CustomCache struct {
-	// You can add fields like map, TTL handling, or a mutex here.
+	mu   sync.Mutex
 	data map[string]string
 	ttl  map[string]time.Time // Tracks key expiration times
 }
 
 // Ensure CustomCache implements the Cache interface
+var _ Cache = (*CustomCache)(nil)
+
+func newMemoryCache() *CustomCache {
+	return &CustomCache{
+		data: make(map[string]string),
+		ttl:  make(map[string]time.Time),
+	}
+}
+
+// live reports whether key is set and not expired, dropping it if it has. Callers hold the lock
+func (c *CustomCache) live(key string) bool {
+	if _, ok := c.data[key]; !ok {
+		return false
+	}
+	if expires, ok := c.ttl[key]; ok && !time.Now().Before(expires) {
+		delete(c.data, key)
+		delete(c.ttl, key)
+		return false
+	}
+	return true
+}
+
 func (c *CustomCache) Get(key string) (value string, found bool) {
-	return
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live(key) {
+		return "", false
+	}
+	return c.data[key], true
 }
 
+// Put stores the value for the same cooldown the redis cache uses
 func (c *CustomCache) Put(key string, value string) error {
+	if key == "" {
+		return fmt.Errorf("empty cache key")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data[key] = value
+	c.ttl[key] = time.Now().Add(linkCooldown)
 	return nil
 }
 
 func (c *CustomCache) Valid(key string) bool { return false }
 func (c *CustomCache) Exist(key string) bool {
-	return false
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.live(key)
 }
 
-func (c *CustomCache) Delete(key string) {
+func (c *CustomCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.data, key)
+	delete(c.ttl, key)
+	return nil
 }
 
+// IncreaseTTL behaves like the redis version: a missing key is created with extraTime to live
 func (c *CustomCache) IncreaseTTL(key string, extraTime time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live(key) {
+		c.data[key] = ""
+		c.ttl[key] = time.Now().Add(extraTime)
+		return nil
+	}
+	c.ttl[key] = c.ttl[key].Add(extraTime)
 	return nil
 }
 
 func (c *CustomCache) SetTTl(key string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.live(key) {
+		return fmt.Errorf("key doesn't exist")
+	}
+	c.ttl[key] = time.Now().Add(ttl)
 	return nil
 }
 
@@ -196,7 +310,36 @@ func (c *CustomCache) Save() error {
 	return nil
 }
 
-func (c *CustomCache) Flush() {}
+func (c *CustomCache) Inspect(key string) (CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := CacheEntry{Key: key}
+	if !c.live(key) {
+		return entry, nil
+	}
+	entry.Found, entry.Value = true, c.data[key]
+	if expires, ok := c.ttl[key]; ok {
+		entry.TTL = time.Until(expires)
+	}
+	return entry, nil
+}
+
+func (c *CustomCache) Stats() (CacheStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.data {
+		// drops the expired ones
+		c.live(key)
+	}
+	return CacheStats{Backend: "memory", Keys: int64(len(c.data))}, nil
+}
+
+func (c *CustomCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.data = make(map[string]string)
+	c.ttl = make(map[string]time.Time)
+}
 
 type CLeaner struct {
 }
@@ -262,13 +405,13 @@ type Geospatial struct {
 	Longitude float64 `json:"longitude"`
 }
 
-func BatchCoordinates(addresses []string) *[]Geospatial {
-	apiKey := os.Getenv("GELOKY_KEY")
+// BatchCoordinates geocodes addresses in one request to geloky, apiKey is the GELOKY_KEY secret
+func BatchCoordinates(addresses []string, apiKey string) (*[]Geospatial, error) {
 
 	// Convert addresses slice to a JSON array string
 	addressesJSON, err := json.Marshal(addresses)
 	if err != nil {
-		log.Fatal("Error marshalling addresses:", err)
+		return nil, fmt.Errorf("marshalling addresses: %w", err)
 	}
 
 	// Escape the JSON string for use in the query parameter
@@ -278,14 +421,14 @@ func BatchCoordinates(addresses []string) *[]Geospatial {
 	// Make the HTTP GET request
 	response, err := http.Get(apiURL)
 	if err != nil {
-		log.Fatal("Error making HTTP request:", err)
+		return nil, secrets.RedactError(err)
 	}
 	defer response.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
-		log.Fatal("Error reading response body:", err)
+		return nil, fmt.Errorf("reading response body: %w", err)
 	}
 
 	// Debug: Print raw response body
@@ -294,13 +437,12 @@ func BatchCoordinates(addresses []string) *[]Geospatial {
 	var geoResponse []Geospatial
 	err = json.Unmarshal(body, &geoResponse)
 	if err != nil {
-		log.Fatal("Error unmarshalling response:", err)
+		return nil, fmt.Errorf("unmarshalling response: %w", err)
 	}
 
-	return &geoResponse
+	return &geoResponse, nil
 }
-func Cordniates(address string) (*Geospatial, error) {
-	apiKey := os.Getenv("GELOKY_KEY")
+func Cordniates(address, apiKey string) (*Geospatial, error) {
 	normalizedAddress := strings.ReplaceAll(address, ",", "")
 
 	// Escape spaces and format the address for the API
@@ -308,7 +450,7 @@ func Cordniates(address string) (*Geospatial, error) {
 	apiURL := fmt.Sprintf("https://geloky.com/api/geo/geocode?address=%s&key=%s&format=geloky", escapedAddress, apiKey)
 	response, err := http.Get(apiURL)
 	if err != nil {
-		return nil, fmt.Errorf("issue making request to %s response returned %v", apiURL, err)
+		return nil, fmt.Errorf("issue making request to %s response returned %v", secrets.RedactURL(apiURL), secrets.RedactError(err))
 	}
 	if response.StatusCode != 200 {
 		return nil, fmt.Errorf("did not recieve 200 status code from deocoding api")
@@ -327,8 +469,8 @@ func Cordniates(address string) (*Geospatial, error) {
 	return &geoResponse[0], nil
 }
 
-func GeoPoints(address string) (float64, float64) {
-	geoObj, err := Cordniates(address)
+func GeoPoints(address, apiKey string) (float64, float64) {
+	geoObj, err := Cordniates(address, apiKey)
 	if err != nil {
 		return -1, -1
 	}
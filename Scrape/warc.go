@@ -0,0 +1,375 @@
+package scrape
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+/*
+WARC (ISO 28500) is the format every crawler and archive tool understands, so captures can be handed to
+other teams and a crawl can be replayed byte for byte to reproduce a bug. Only what we need is
+implemented: warcinfo and response records, each one its own gzip member when the file ends in .gz.
+Set WARC_OUTPUT to record every live fetch and WARC_REPLAY to serve the collectors out of a file
+*/
+
+const (
+	warcVersion = "WARC/1.0"
+	// not part of the standard, lets an import put a page back under the right snapshot kind
+	warcKindHeader = "WARC-Snapshot-Kind"
+)
+
+// WARCRecord is one record of a warc file, Block is everything after the record headers
+type WARCRecord struct {
+	Type      string
+	TargetURI string
+	Date      time.Time
+	Headers   http.Header
+	Block     []byte
+}
+
+// Response parses the http response carried by a response record
+func (r *WARCRecord) Response() (status int, headers http.Header, body []byte, err error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(r.Block)), nil)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("reading response record for %s: %w", r.TargetURI, err)
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+var errWARCClosed = errors.New("warc file already closed")
+
+type WARCWriter struct {
+	mu   sync.Mutex
+	file *os.File
+	gzip bool
+}
+
+// NewWARCWriter creates (or appends to) the warc file at path, gzipping every record if it ends in .gz
+func NewWARCWriter(path string) (*WARCWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening warc file: %w", err)
+	}
+	w := &WARCWriter{file: file, gzip: strings.HasSuffix(path, ".gz")}
+	info := fmt.Sprintf("software: lite\r\nformat: WARC File Format 1.0\r\nfilename: %s\r\n", path)
+	if err := w.write("warcinfo", "", time.Now(), "application/warc-fields", nil, []byte(info)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Sync flushes what was written so far to disk, the file stays open for the next crawl
+func (w *WARCWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return errWARCClosed
+	}
+	return w.file.Sync()
+}
+
+// Close waits for the record being written to be done and closes the file, later records are refused
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Sync()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	w.file = nil
+	return err
+}
+
+// WriteResponse stores one fetched page as a response record
+func (w *WARCWriter) WriteResponse(kind, url string, status int, headers http.Header, body []byte, fetchedAt time.Time) error {
+	digest := sha1.Sum(body)
+	extra := []string{"WARC-Payload-Digest: sha1:" + base32.StdEncoding.EncodeToString(digest[:])}
+	if kind != "" {
+		extra = append(extra, warcKindHeader+": "+kind)
+	}
+	return w.write("response", url, fetchedAt, "application/http; msgtype=response", extra, httpResponseBlock(status, headers, body))
+}
+
+// httpResponseBlock serializes the response the way it came over the wire. Bodies are stored decoded,
+// so the headers describing the transfer are rewritten to match
+func httpResponseBlock(status int, headers http.Header, body []byte) []byte {
+	headers = headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Del("Content-Encoding")
+	headers.Del("Transfer-Encoding")
+	headers.Set("Content-Length", strconv.Itoa(len(body)))
+	var block bytes.Buffer
+	fmt.Fprintf(&block, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+	headers.Write(&block)
+	block.WriteString("\r\n")
+	block.Write(body)
+	return block.Bytes()
+}
+
+func (w *WARCWriter) write(recordType, url string, date time.Time, contentType string, extra []string, block []byte) error {
+	var record bytes.Buffer
+	record.WriteString(warcVersion + "\r\n")
+	fmt.Fprintf(&record, "WARC-Type: %s\r\n", recordType)
+	fmt.Fprintf(&record, "WARC-Record-ID: <urn:uuid:%s>\r\n", newUUID())
+	fmt.Fprintf(&record, "WARC-Date: %s\r\n", date.UTC().Format(time.RFC3339))
+	if url != "" {
+		fmt.Fprintf(&record, "WARC-Target-URI: %s\r\n", url)
+	}
+	fmt.Fprintf(&record, "Content-Type: %s\r\n", contentType)
+	for _, header := range extra {
+		record.WriteString(header + "\r\n")
+	}
+	fmt.Fprintf(&record, "Content-Length: %d\r\n\r\n", len(block))
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return errWARCClosed
+	}
+	if !w.gzip {
+		_, err := w.file.Write(record.Bytes())
+		return err
+	}
+	// one gzip member per record, so tools can seek to a record without inflating the whole file
+	zw := gzip.NewWriter(w.file)
+	if _, err := zw.Write(record.Bytes()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Record hooks the writer into a collector so every response it gets lands in the warc file
+func (w *WARCWriter) Record(c *colly.Collector, kind string, logger *slog.Logger) {
+	save := func(r *colly.Response) {
+		if r == nil || r.Request == nil || r.StatusCode == 0 {
+			return
+		}
+		var headers http.Header
+		if r.Headers != nil {
+			headers = *r.Headers
+		}
+		if err := w.WriteResponse(kind, r.Request.URL.String(), r.StatusCode, headers, r.Body, time.Now()); err != nil {
+			logger.Error("writing page to warc failed", "url", r.Request.URL.String(), "err", err)
+		}
+	}
+	c.OnResponse(save)
+	c.OnError(func(r *colly.Response, _ error) { save(r) })
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ReadWARC calls fn for every record in the file, plain or gzipped
+func ReadWARC(path string, fn func(*WARCRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	in := bufio.NewReader(file)
+	var source io.Reader = in
+	if magic, err := in.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// gzip.Reader reads concatenated members as one stream
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		source = zr
+	}
+	reader := bufio.NewReader(source)
+	for {
+		record, err := readWARCRecord(reader)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func readWARCRecord(r *bufio.Reader) (*WARCRecord, error) {
+	// skip the blank lines between records
+	var version string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("reading warc record: %w", err)
+		}
+		if version = strings.TrimSpace(line); version != "" {
+			break
+		}
+	}
+	if !strings.HasPrefix(version, "WARC/") {
+		return nil, fmt.Errorf("not a warc record, starts with %q", version)
+	}
+	headers := http.Header{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("reading warc headers: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed warc header %q", line)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("warc record without a valid Content-Length")
+	}
+	block := make([]byte, length)
+	if _, err := io.ReadFull(r, block); err != nil {
+		return nil, fmt.Errorf("reading warc block: %w", err)
+	}
+	date, _ := time.Parse(time.RFC3339, headers.Get("WARC-Date"))
+	return &WARCRecord{
+		Type:      headers.Get("WARC-Type"),
+		TargetURI: strings.Trim(headers.Get("WARC-Target-URI"), "<>"),
+		Date:      date,
+		Headers:   headers,
+		Block:     block,
+	}, nil
+}
+
+// NewWARCTransport serves requests out of a warc file as if it were the live site. Every response record
+// is loaded up front, the last capture of a url wins and urls that were never captured get a 404
+func NewWARCTransport(path string) (http.RoundTripper, error) {
+	type capture struct {
+		status  int
+		headers http.Header
+		body    []byte
+	}
+	captures := make(map[string]capture)
+	err := ReadWARC(path, func(record *WARCRecord) error {
+		if record.Type != "response" || record.TargetURI == "" {
+			return nil
+		}
+		status, headers, body, err := record.Response()
+		if err != nil {
+			return err
+		}
+		captures[record.TargetURI] = capture{status, headers, body}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("loading warc %s: %w", path, err)
+	}
+	return replayTransport(func(req *http.Request) (*http.Response, error) {
+		found, ok := captures[req.URL.String()]
+		if !ok {
+			return notArchived(req), nil
+		}
+		return replayResponse(req, found.status, found.headers, found.body), nil
+	}), nil
+}
+
+// ExportWARC writes the latest capture of every archived url to a warc file
+func (a *Archive) ExportWARC(path string) (int, error) {
+	w, err := NewWARCWriter(path)
+	if err != nil {
+		return 0, err
+	}
+	defer w.Close()
+	written := 0
+	for _, kind := range []string{snapshotListing, snapshotDetail} {
+		snapshots, err := a.db.LatestSnapshots(kind)
+		if err != nil {
+			return written, err
+		}
+		for _, snapshot := range snapshots {
+			body, err := a.Body(snapshot.Hash)
+			if err != nil {
+				return written, fmt.Errorf("reading archived %s: %w", snapshot.URL, err)
+			}
+			if err := w.WriteResponse(kind, snapshot.URL, snapshot.Status, snapshotHeaders(&snapshot), body, snapshot.FetchedAt); err != nil {
+				return written, err
+			}
+			written++
+		}
+	}
+	return written, nil
+}
+
+// ImportWARC adds every response record of a warc file to the archive, so a capture from elsewhere
+// can be reparsed like one of our own
+func (a *Archive) ImportWARC(path string) (int, error) {
+	imported := 0
+	err := ReadWARC(path, func(record *WARCRecord) error {
+		if record.Type != "response" || record.TargetURI == "" {
+			return nil
+		}
+		status, headers, body, err := record.Response()
+		if err != nil {
+			return err
+		}
+		kind := record.Headers.Get(warcKindHeader)
+		if kind == "" {
+			kind = guessSnapshotKind(record.TargetURI)
+		}
+		fetchedAt := record.Date
+		if fetchedAt.IsZero() {
+			fetchedAt = time.Now()
+		}
+		if _, err := a.Save(kind, record.TargetURI, status, headers, body, fetchedAt); err != nil {
+			return err
+		}
+		imported++
+		return nil
+	})
+	return imported, err
+}
+
+// event pages live under /e/, everything else we crawl is a results page
+func guessSnapshotKind(url string) string {
+	if strings.Contains(url, "/e/") {
+		return snapshotDetail
+	}
+	return snapshotListing
+}
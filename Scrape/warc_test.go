@@ -0,0 +1,91 @@
+package scrape
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWARCRoundTrip(t *testing.T) {
+	for _, name := range []string{"crawl.warc", "crawl.warc.gz"} {
+		t.Run(name, func(t *testing.T) {
+			path := t.TempDir() + "/" + name
+			w, err := NewWARCWriter(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fetched := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			headers := http.Header{"Content-Type": {"text/html"}, "Content-Encoding": {"gzip"}}
+			url := "https://www.eventbrite.com/e/jazz-night-123"
+			if err := w.WriteResponse(snapshotDetail, url, 200, headers, []byte("<html>jazz</html>"), fetched); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteResponse("", "https://www.eventbrite.com/d/nj--newark/all-events/", 404, nil, nil, fetched); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			// a page that comes in while shutting down is refused and not half written
+			if err := w.WriteResponse("", url, 200, nil, nil, fetched); err == nil {
+				t.Error("wrote to a closed warc file")
+			}
+			if err := w.Close(); err != nil {
+				t.Errorf("closing twice: %v", err)
+			}
+
+			var types []string
+			err = ReadWARC(path, func(r *WARCRecord) error {
+				types = append(types, r.Type)
+				if r.Type == "response" && r.TargetURI == url {
+					if !r.Date.Equal(fetched) {
+						t.Errorf("WARC-Date = %v, want %v", r.Date, fetched)
+					}
+					if kind := r.Headers.Get(warcKindHeader); kind != snapshotDetail {
+						t.Errorf("kind = %q, want %q", kind, snapshotDetail)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(types) != 3 || types[0] != "warcinfo" {
+				t.Fatalf("records = %v, want warcinfo and two responses", types)
+			}
+
+			transport, err := NewWARCTransport(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: transport}
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != 200 || string(body) != "<html>jazz</html>" || resp.Header.Get("Content-Type") != "text/html" {
+				t.Errorf("replay = %d %q %v", resp.StatusCode, body, resp.Header)
+			}
+			resp, err = client.Get("https://www.eventbrite.com/d/nj--newark/all-events/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != 404 {
+				t.Errorf("captured 404 replayed as %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGuessSnapshotKind(t *testing.T) {
+	if kind := guessSnapshotKind("https://www.eventbrite.com/e/jazz-night-123"); kind != snapshotDetail {
+		t.Errorf("event page guessed as %q", kind)
+	}
+	if kind := guessSnapshotKind("https://www.eventbrite.com/d/nj--newark/all-events/"); kind != snapshotListing {
+		t.Errorf("results page guessed as %q", kind)
+	}
+}
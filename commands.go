@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"lite/DB"
+	scrape "lite/Scrape"
+	"lite/logging"
+	"lite/metrics"
+	"lite/pkg"
+	"lite/scheduler"
+	"lite/secrets"
+	api "lite/server"
+)
+
+// addresses the geocode backfill job looks up per run, the free geocoding tier is rate limited
+const geocodeBackfillBatch = 200
+
+func serveCommand(cl *cmdline, args []string) error {
+	noScheduler := cl.Bool("no-scheduler", false, "only serve the api and metrics, no job runs on its own")
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	cfg := cl.config
+	db, err := DB.NewStorage(cfg.Database.Path)
+	if err != nil {
+		return err
+	}
+	adminToken, err := cl.secrets.Optional(secrets.AdminToken)
+	if err != nil {
+		return err
+	}
+	slackWebhook, err := cl.secrets.Optional(secrets.SlackWebhook)
+	if err != nil {
+		return err
+	}
+	webCrawler := scrape.Config(cfg, db, cl.secrets)
+	starters := []pkg.Starter{metrics.NewCollector(cfg.Metrics), db}
+	var jobs *scheduler.Scheduler
+	if !*noScheduler {
+		jobs = scheduler.NewScheduler(db, logging.For(logging.Scheduler), pkg.NewNotifier(slackWebhook))
+		registerJobs(jobs, webCrawler)
+		if err := jobs.LoadSchedule(cfg.Scheduler.File); err != nil {
+			return fmt.Errorf("schedule invalid: %w", err)
+		}
+		starters = append(starters, jobs)
+	}
+	// the api blocks, it goes last
+	starters = append(starters, api.NewServer(cfg.Server, DB.NewQuery(cfg.Database.Path), jobs, webCrawler, adminToken))
+	defer webCrawler.Close()
+	// the api never returns, so the scheduler and the scraper are stopped when we are told to stop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- pkg.SetUp(starters...) }()
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+		logging.For(logging.Server).Info("shutting down")
+	}
+	// a crawl in progress is cut short, what it stored so far stays
+	if err := webCrawler.Cancel(); err != nil && !errors.Is(err, scrape.ErrNoRun) {
+		logging.For(logging.Server).Error("cancelling the crawl failed", "err", err)
+	}
+	if jobs != nil {
+		jobs.Stop()
+	}
+	return nil
+}
+
+// crawlJob runs a crawl as a scheduled job. A crawl already going (one started from the admin api) makes
+// the job skip its turn, that isnt a failure
+func crawlJob(crawl func() error) func() error {
+	return func() error {
+		err := crawl()
+		if errors.Is(err, scrape.ErrRunInProgress) {
+			return fmt.Errorf("%w: %w", scheduler.ErrSkipped, err)
+		}
+		return err
+	}
+}
+
+// scraper is what the commands need of the scraper
+type scraper interface {
+	Start() error
+	CrawlLists(lists ...string) error
+	Recheck() error
+	Crawl(ctx context.Context, opts scrape.CrawlOptions) error
+	ScrapeURL(pageURL string, store bool) (*scrape.Inspection, error)
+	BackfillGeocodes(limit int) (int, error)
+	Archive() *scrape.Archive
+	Reparse() (int, error)
+	Close() error
+}
+
+func registerJobs(jobs *scheduler.Scheduler, webCrawler scraper) {
+	jobs.Register("full-crawl", crawlJob(webCrawler.Start))
+	jobs.Register("nj-crawl", crawlJob(func() error { return webCrawler.CrawlLists("nj") }))
+	jobs.Register("stale-recheck", crawlJob(webCrawler.Recheck))
+	jobs.Register("geocode-backfill", func() error {
+		filled, err := webCrawler.BackfillGeocodes(geocodeBackfillBatch)
+		logging.For(logging.Scheduler).Info("geocode backfill done", "filled", filled)
+		return err
+	})
+}
+
+func scrapeCommand(cl *cmdline, args []string) error {
+	lists := cl.String("lists", "", "only crawl these seed lists, comma separated")
+	seeds := cl.String("seeds", "", "only crawl these seed urls, comma separated")
+	recheck := cl.Bool("recheck", false, "only revisit the event pages that are due")
+	pageURL := cl.String("url", "", "fetch and parse this one event page and print what every field came out as")
+	store := cl.Bool("store", false, "with -url, also write the event to the database")
+	dryRun := cl.Bool("dry-run", false, "print the seed urls a crawl would start from without fetching anything")
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	if *dryRun {
+		if err := scrape.DryRunSeeds(os.Stdout, cl.config.Scrape.BaseURL); err != nil {
+			return fmt.Errorf("seed registry invalid: %w", err)
+		}
+		return nil
+	}
+	webCrawler, err := newScraper(cl)
+	if err != nil {
+		return err
+	}
+	defer webCrawler.Close()
+	if *pageURL != "" {
+		inspection, err := webCrawler.ScrapeURL(*pageURL, *store)
+		if err != nil {
+			return fmt.Errorf("scraping %s failed: %w", *pageURL, err)
+		}
+		return printJSON(inspection)
+	}
+	// ctrl-c cancels the crawl, what it got done so far is still stored
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return webCrawler.Crawl(ctx, scrape.CrawlOptions{Lists: splitList(*lists), Seeds: splitList(*seeds), Recheck: *recheck})
+}
+
+func geocodeBackfillCommand(cl *cmdline, args []string) error {
+	limit := cl.Int("limit", geocodeBackfillBatch, "addresses to look up at most")
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	webCrawler, err := newScraper(cl)
+	if err != nil {
+		return err
+	}
+	defer webCrawler.Close()
+	filled, err := webCrawler.BackfillGeocodes(*limit)
+	fmt.Printf("Filled in %d addresses\n", filled)
+	return err
+}
+
+func exportCommand(cl *cmdline, args []string) error {
+	path, err := fileArg(cl, args)
+	if err != nil {
+		return err
+	}
+	webCrawler, err := newScraper(cl)
+	if err != nil {
+		return err
+	}
+	defer webCrawler.Close()
+	written, err := webCrawler.Archive().ExportWARC(path)
+	if err != nil {
+		return fmt.Errorf("warc export failed: %w", err)
+	}
+	fmt.Printf("Wrote %d pages to %s\n", written, path)
+	return nil
+}
+
+func importCommand(cl *cmdline, args []string) error {
+	path, err := fileArg(cl, args)
+	if err != nil {
+		return err
+	}
+	webCrawler, err := newScraper(cl)
+	if err != nil {
+		return err
+	}
+	defer webCrawler.Close()
+	imported, err := webCrawler.Archive().ImportWARC(path)
+	if err != nil {
+		return fmt.Errorf("warc import failed: %w", err)
+	}
+	fmt.Printf("Imported %d pages from %s\n", imported, path)
+	return nil
+}
+
+// fileArg parses a command that takes a single file
+func fileArg(cl *cmdline, args []string) (string, error) {
+	if err := cl.parse(args); err != nil {
+		return "", err
+	}
+	if cl.NArg() != 1 {
+		cl.Usage()
+		return "", fmt.Errorf("%s takes one file", cl.Name())
+	}
+	return cl.Arg(0), nil
+}
+
+func cacheCommand(cl *cmdline, args []string) error {
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	cache := scrape.OpenCache(cl.config.Redis)
+	defer cache.Save()
+	switch action := cl.Arg(0); {
+	case action == "flush" && cl.NArg() == 1:
+		cache.Flush()
+		return nil
+	case action == "stats" && cl.NArg() == 1:
+		stats, err := cache.Stats()
+		if err != nil {
+			return err
+		}
+		return printJSON(stats)
+	case action == "inspect" && cl.NArg() == 2:
+		entry, err := cache.Inspect(cl.Arg(1))
+		if err != nil {
+			return err
+		}
+		return printJSON(entry)
+	}
+	cl.Usage()
+	return fmt.Errorf("cache wants flush, stats or inspect <key>")
+}
+
+func migrateCommand(cl *cmdline, args []string) error {
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	// opening the database brings the models and the migrations up to date
+	if _, err := DB.NewStorage(cl.config.Database.Path); err != nil {
+		return err
+	}
+	fmt.Printf("Database schema of %s is up to date\n", cl.config.Database.Path)
+	return nil
+}
+
+func runsCommand(cl *cmdline, args []string) error {
+	limit := cl.Uint("limit", 20, "runs to show")
+	offset := cl.Uint("offset", 0, "newest runs to skip")
+	asJSON := cl.Bool("json", false, "print the runs as json")
+	if len(args) == 0 || args[0] != "list" {
+		cl.Usage()
+		return fmt.Errorf("runs wants list")
+	}
+	if err := cl.parse(args[1:]); err != nil {
+		return err
+	}
+	runs, err := DB.NewQuery(cl.config.Database.Path).ScrapeRuns(*offset, *limit)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return printJSON(runs)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tSTATUS\tSTARTED\tTOOK\tLISTINGS\tDETAILS\tNEW\tUPDATED\tERRORS")
+	for _, run := range runs {
+		took := "-"
+		if run.FinishedAt != nil {
+			took = run.FinishedAt.Sub(run.StartedAt).Round(time.Second).String()
+		}
+		errors := 0
+		for _, n := range run.Errors {
+			errors += n
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", run.ID, run.Kind, run.Status,
+			run.StartedAt.Local().Format("2006-01-02 15:04"), took, run.ListingPages, run.DetailPages,
+			run.EventsInserted, run.EventsUpdated, errors)
+	}
+	return w.Flush()
+}
+
+func replayCommand(cl *cmdline, args []string) error {
+	warc := cl.String("warc", "", "import this warc file into the archive first")
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	webCrawler, err := newScraper(cl)
+	if err != nil {
+		return err
+	}
+	defer webCrawler.Close()
+	if *warc != "" {
+		imported, err := webCrawler.Archive().ImportWARC(*warc)
+		if err != nil {
+			return fmt.Errorf("warc import failed: %w", err)
+		}
+		fmt.Printf("Imported %d pages from %s\n", imported, *warc)
+	}
+	parsed, err := webCrawler.Reparse()
+	if err != nil {
+		return fmt.Errorf("reparse failed: %w", err)
+	}
+	fmt.Printf("Rebuilt events from %d archived pages\n", parsed)
+	return nil
+}
+
+// newScraper opens the database and builds the scraper on it
+func newScraper(cl *cmdline) (scraper, error) {
+	db, err := DB.NewStorage(cl.config.Database.Path)
+	if err != nil {
+		return nil, err
+	}
+	return scrape.Config(cl.config, db, cl.secrets), nil
+}
+
+func secretsCommand(cl *cmdline, args []string) error {
+	if err := cl.parse(args); err != nil {
+		return err
+	}
+	if cl.config.Secrets.Store == "" {
+		return fmt.Errorf("there is no secrets store configured")
+	}
+	store, err := secrets.OpenStore(cl.config.Secrets.Store, os.Getenv(secrets.PassphraseEnv))
+	if err != nil {
+		return err
+	}
+	switch action, name := cl.Arg(0), cl.Arg(1); {
+	case action == "list" && cl.NArg() == 1:
+		// only the names, the values stay in the store
+		for _, name := range store.Names() {
+			fmt.Println(name)
+		}
+		return nil
+	case action == "set" && cl.NArg() == 2:
+		// from stdin so the value doesnt end up in the shell history
+		raw, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		if err := store.Set(name, strings.TrimRight(string(raw), "\r\n")); err != nil {
+			return err
+		}
+		if err := store.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Stored %s in %s\n", name, cl.config.Secrets.Store)
+		return nil
+	case action == "delete" && cl.NArg() == 2:
+		if !store.Delete(name) {
+			return fmt.Errorf("%s isnt in %s", name, cl.config.Secrets.Store)
+		}
+		return store.Save()
+	}
+	cl.Usage()
+	return fmt.Errorf("secrets wants list, set <name> or delete <name>")
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
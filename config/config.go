@@ -0,0 +1,284 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Every setting of the process in one place. A Config starts out as Default, a json file (config.json
+unless told otherwise) changes what it lists, environment variables override the file and the command
+line's -set overrides those, as it sets them before Load runs. The env tag on a field is the name it is
+overridden by. Load validates the result, so a typo in a port or a worker count stops the process at
+start up instead of halfway into a crawl. The packages get their own part of it handed to their
+constructors, nothing reads the environment for these on its own
+*/
+
+const File = "config.json"
+
+type Config struct {
+	Server    ServerConfig    `json:"server"`
+	Metrics   MetricsConfig   `json:"metrics"`
+	Database  DatabaseConfig  `json:"database"`
+	Redis     RedisConfig     `json:"redis"`
+	Scrape    ScrapeConfig    `json:"scrape"`
+	Scheduler SchedulerConfig `json:"scheduler"`
+	Secrets   SecretsConfig   `json:"secrets"`
+	Logging   LoggingConfig   `json:"logging"`
+}
+
+type ServerConfig struct {
+	Addr string `json:"addr" env:"SERVER_ADDR"`
+}
+
+type MetricsConfig struct {
+	Addr     string   `json:"addr" env:"METRICS_ADDR"`
+	Interval Duration `json:"interval" env:"METRICS_INTERVAL"`
+	// samples are appended to this file as a json array
+	File string `json:"file" env:"METRICS_FILE"`
+}
+
+type DatabaseConfig struct {
+	// the one sqlite file the scraper writes and the api reads
+	Path string `json:"path" env:"DATABASE_PATH"`
+}
+
+type RedisConfig struct {
+	Addr string `json:"addr" env:"REDIS_ADDR"`
+	DB   int    `json:"db" env:"REDIS_DB"`
+}
+
+type ScrapeConfig struct {
+	// where the seed links point
+	BaseURL        string `json:"base_url" env:"EVENTBRITE_URL"`
+	ListingWorkers int    `json:"listing_workers" env:"SCRAPE_LISTING_WORKERS"`
+	DetailWorkers  int    `json:"detail_workers" env:"SCRAPE_DETAIL_WORKERS"`
+	// links the listing and the detail queue hold before the workers producing them block
+	QueueSize int `json:"queue_size" env:"SCRAPE_QUEUE_SIZE"`
+	// how long the listing and the detail workers of a crawl may take, time spent paused not counted
+	Timeout Duration `json:"timeout" env:"SCRAPE_TIMEOUT"`
+	// capture every fetched page into this warc file as well, unless it is a replay
+	WARCOutput string `json:"warc_output" env:"WARC_OUTPUT"`
+	// answer every request from this warc file instead of the network
+	WARCReplay string `json:"warc_replay" env:"WARC_REPLAY"`
+}
+
+type SchedulerConfig struct {
+	File string `json:"file" env:"SCHEDULE_FILE"`
+}
+
+type LoggingConfig struct {
+	// debug, info, warn or error
+	Level string `json:"level" env:"LOG_LEVEL"`
+	// text is colored when it goes to a terminal, json is one object per line
+	Format string `json:"format" env:"LOG_FORMAT"`
+	// everything is written here as json lines as well, empty is the console only
+	File       string `json:"file" env:"LOG_FILE"`
+	MaxSizeMB  int    `json:"max_size_mb" env:"LOG_MAX_SIZE_MB"`
+	MaxBackups int    `json:"max_backups" env:"LOG_MAX_BACKUPS"`
+	// levels of single components over the default one, LOG_LEVELS is scrape=debug,db=warn
+	Levels map[string]string `json:"levels" env:"LOG_LEVELS"`
+}
+
+// SecretsConfig says where secrets are looked for after the environment, the values never go in here
+type SecretsConfig struct {
+	// a file per secret, named after it
+	Dir string `json:"dir" env:"SECRETS_DIR"`
+	// the encrypted store, used when the file is there
+	Store string `json:"store" env:"SECRETS_STORE"`
+}
+
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Addr: ":8080"},
+		Metrics:  MetricsConfig{Addr: ":9999", Interval: Duration(15 * time.Second), File: "metrics/metrics.json"},
+		Database: DatabaseConfig{Path: "DataStore.db"},
+		Redis:    RedisConfig{Addr: "localhost:6379"},
+		Scrape: ScrapeConfig{
+			BaseURL:        "https://www.eventbrite.com",
+			ListingWorkers: 50,
+			DetailWorkers:  50,
+			QueueSize:      33000,
+			Timeout:        Duration(120 * time.Second),
+		},
+		Scheduler: SchedulerConfig{File: "schedule.json"},
+		Secrets:   SecretsConfig{Store: "secrets.store"},
+		Logging: LoggingConfig{
+			Level:      "info",
+			Format:     "text",
+			File:       "ScapeLogs/lite.log",
+			MaxSizeMB:  50,
+			MaxBackups: 5,
+			Levels:     map[string]string{},
+		},
+	}
+}
+
+// Load reads the config in path over the defaults, no path means defaults only, then applies the
+// environment and validates it all
+func Load(path string) (*Config, error) {
+	c := Default()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	}
+	if err := c.applyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// applyEnv overrides every field whose env variable is set
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	sections := reflect.ValueOf(c).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			name := section.Type().Field(j).Tag.Get("env")
+			value, ok := lookup(name)
+			if name == "" || !ok {
+				continue
+			}
+			if err := setField(section.Field(j), value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	case Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	case map[string]string:
+		pairs := make(map[string]string)
+		for _, pair := range strings.Split(value, ",") {
+			key, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok || key == "" {
+				return fmt.Errorf("want key=value pairs, got %q", pair)
+			}
+			pairs[key] = v
+		}
+		field.Set(reflect.ValueOf(pairs))
+	default:
+		return fmt.Errorf("cant set a %s from the environment", field.Type())
+	}
+	return nil
+}
+
+// Validate checks every setting, and that the two servers dont want the same address
+func (c *Config) Validate() error {
+	for name, addr := range map[string]string{"server.addr": c.Server.Addr, "metrics.addr": c.Metrics.Addr, "redis.addr": c.Redis.Addr} {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if c.Server.Addr == c.Metrics.Addr {
+		return fmt.Errorf("server.addr and metrics.addr are both %s", c.Server.Addr)
+	}
+	if c.Metrics.Interval <= 0 {
+		return fmt.Errorf("metrics.interval has to be positive")
+	}
+	for name, path := range map[string]string{"metrics.file": c.Metrics.File, "database.path": c.Database.Path, "scheduler.file": c.Scheduler.File} {
+		if path == "" {
+			return fmt.Errorf("%s is empty", name)
+		}
+	}
+	if c.Redis.DB < 0 || c.Redis.DB > 15 {
+		return fmt.Errorf("redis.db %d is not between 0 and 15", c.Redis.DB)
+	}
+	base, err := url.Parse(c.Scrape.BaseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return fmt.Errorf("scrape.base_url %q is not an http(s) url", c.Scrape.BaseURL)
+	}
+	for name, n := range map[string]int{"scrape.listing_workers": c.Scrape.ListingWorkers, "scrape.detail_workers": c.Scrape.DetailWorkers} {
+		if n < 1 || n > 1000 {
+			return fmt.Errorf("%s %d is not between 1 and 1000", name, n)
+		}
+	}
+	if c.Scrape.QueueSize < 1 {
+		return fmt.Errorf("scrape.queue_size has to be positive")
+	}
+	if c.Scrape.Timeout <= 0 {
+		return fmt.Errorf("scrape.timeout has to be positive")
+	}
+	return c.Logging.validate()
+}
+
+func (l LoggingConfig) validate() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return fmt.Errorf("logging.level: %w", err)
+	}
+	for component, name := range l.Levels {
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return fmt.Errorf("logging.levels.%s: %w", component, err)
+		}
+	}
+	if l.Format != "text" && l.Format != "json" {
+		return fmt.Errorf("logging.format %q is neither text nor json", l.Format)
+	}
+	if l.MaxSizeMB < 1 {
+		return fmt.Errorf("logging.max_size_mb has to be positive")
+	}
+	if l.MaxBackups < 0 {
+		return fmt.Errorf("logging.max_backups cant be negative")
+	}
+	return nil
+}
+
+// Duration is a time.Duration written the way time.ParseDuration reads it, "90s" or "2m"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(raw []byte) error {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return fmt.Errorf("durations are strings like \"90s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShippedConfig(t *testing.T) {
+	c, err := Load(filepath.Join("..", File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the shipped file documents the defaults, it shouldnt drift from them
+	if !reflect.DeepEqual(c, Default()) {
+		t.Errorf("shipped config %+v\ndiffers from the defaults %+v", c, Default())
+	}
+}
+
+func TestLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	file := `{"server": {"addr": ":8081"}, "redis": {"addr": "cache:6379"}, "scrape": {"timeout": "5m", "detail_workers": 10}}`
+	if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("REDIS_ADDR", "redis.internal:6380")
+	t.Setenv("SCRAPE_LISTING_WORKERS", "8")
+	t.Setenv("LOG_LEVELS", "scrape=debug, db=warn")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Addr != ":8081" || c.Scrape.Timeout.Std() != 5*time.Minute || c.Scrape.DetailWorkers != 10 {
+		t.Errorf("file not applied: %+v", c)
+	}
+	if c.Redis.Addr != "redis.internal:6380" || c.Scrape.ListingWorkers != 8 {
+		t.Errorf("env not applied: redis %s listing workers %d", c.Redis.Addr, c.Scrape.ListingWorkers)
+	}
+	if c.Logging.Levels["scrape"] != "debug" || c.Logging.Levels["db"] != "warn" {
+		t.Errorf("LOG_LEVELS not applied: %v", c.Logging.Levels)
+	}
+	if c.Metrics.Addr != ":9999" || c.Database.Path != "DataStore.db" {
+		t.Errorf("defaults lost: %+v", c)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		env  map[string]string
+		want string
+	}{
+		{file: `{"server": {"port": 8080}}`, want: "unknown field"},
+		{file: `{"scrape": {"timeout": 120}}`, want: "durations are strings"},
+		{file: `{"metrics": {"addr": ":8080"}}`, want: "both :8080"},
+		{file: `{"scrape": {"base_url": "eventbrite.com"}}`, want: "base_url"},
+		{file: `{"scrape": {"listing_workers": 0}}`, want: "listing_workers"},
+		{file: `{"database": {"path": ""}}`, want: "database.path"},
+		{file: `{}`, env: map[string]string{"SERVER_ADDR": "8080"}, want: "server.addr"},
+		{file: `{}`, env: map[string]string{"SCRAPE_QUEUE_SIZE": "lots"}, want: "SCRAPE_QUEUE_SIZE"},
+		{file: `{"logging": {"format": "xml"}}`, want: "logging.format"},
+		{file: `{}`, env: map[string]string{"LOG_LEVELS": "scrape=loud"}, want: "logging.levels.scrape"},
+	} {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(tc.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range tc.env {
+			t.Setenv(key, value)
+		}
+		_, err := Load(path)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s %v: got %v, want an error about %s", tc.file, tc.env, err, tc.want)
+		}
+		for key := range tc.env {
+			os.Unsetenv(key)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+
+	"lite/config"
+)
+
+/*
+One structured logger for the whole process. Every package logs through For(its component), which puts
+a component field on each record and gives it a level of its own: the default level unless the config,
+or the admin api while running, overrides it for that component. Records go to the console, as colored
+text or as json lines, and when a file is configured to that file as well, always as json and rotated
+by size. Loggers can be made before Setup runs (package variables are), they pick up the output and the
+levels Setup sets whenever it is called
+*/
+
+// the components the packages log as
+const (
+	Main      = "main"
+	Scrape    = "scrape"
+	Cache     = "cache"
+	DB        = "db"
+	Server    = "server"
+	Scheduler = "scheduler"
+	Metrics   = "metrics"
+	Notify    = "notify"
+)
+
+const componentKey = "component"
+
+// the sink handlers take every record, the components decide what is logged
+const everything = slog.Level(-1 << 10)
+
+type sink struct {
+	handler slog.Handler
+	file    *rotatingFile
+}
+
+// until Setup runs it is colored text on stderr at info
+var current atomic.Pointer[sink]
+
+func init() {
+	current.Store(&sink{handler: newTextHandler(os.Stderr, !color.NoColor)})
+}
+
+type component struct {
+	level    slog.LevelVar
+	override bool
+}
+
+var registry = struct {
+	mu         sync.Mutex
+	base       slog.Level
+	components map[string]*component
+}{base: slog.LevelInfo, components: map[string]*component{}}
+
+// For is the logger of component
+func For(name string) *slog.Logger {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	c, ok := registry.components[name]
+	if !ok {
+		c = &component{}
+		c.level.Set(registry.base)
+		registry.components[name] = c
+	}
+	return slog.New(&componentHandler{level: &c.level, ops: []func(slog.Handler) slog.Handler{
+		func(h slog.Handler) slog.Handler { return h.WithAttrs([]slog.Attr{slog.String(componentKey, name)}) },
+	}})
+}
+
+// Setup sends the records where cfg says and sets the levels in it. When redact isnt nil every output is
+// written through it, so a secret that ends up in a record is scrubbed before it reaches the console or the file
+func Setup(cfg config.LoggingConfig, redact func(io.Writer) io.Writer) error {
+	if redact == nil {
+		redact = func(w io.Writer) io.Writer { return w }
+	}
+	registry.mu.Lock()
+	for _, c := range registry.components {
+		c.override = false
+	}
+	registry.mu.Unlock()
+	levels := map[string]string{"default": cfg.Level}
+	for name, level := range cfg.Levels {
+		levels[name] = level
+	}
+	if err := SetLevels(levels); err != nil {
+		return err
+	}
+
+	var console slog.Handler
+	switch cfg.Format {
+	case "json":
+		console = slog.NewJSONHandler(redact(os.Stderr), &slog.HandlerOptions{Level: everything})
+	default:
+		console = newTextHandler(redact(os.Stderr), !color.NoColor)
+	}
+	next := &sink{handler: console}
+	if cfg.File != "" {
+		file, err := openRotating(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return err
+		}
+		next.file = file
+		next.handler = multiHandler{console, slog.NewJSONHandler(redact(file), &slog.HandlerOptions{Level: everything, AddSource: true})}
+	}
+	if old := current.Swap(next); old.file != nil {
+		old.file.Close()
+	}
+	return nil
+}
+
+// SetLevel sets the level of a component, the default level without one. An empty level puts the
+// component back on the default
+func SetLevel(name, level string) error {
+	return SetLevels(map[string]string{name: level})
+}
+
+// SetLevels is SetLevel for every component in levels, none is changed when one of them is wrong
+func SetLevels(levels map[string]string) error {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	parsed := make(map[string]slog.Level, len(levels))
+	for name, level := range levels {
+		if name == "" {
+			name = "default"
+		}
+		if _, ok := registry.components[name]; !ok && name != "default" {
+			return fmt.Errorf("there is no %q component, there are %s", name, strings.Join(componentNames(), ", "))
+		}
+		if level == "" {
+			if name == "default" {
+				return fmt.Errorf("the default level cant be empty")
+			}
+			continue
+		}
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		parsed[name] = l
+	}
+	if l, ok := parsed["default"]; ok {
+		registry.base = l
+	}
+	for name := range levels {
+		if c, ok := registry.components[name]; ok {
+			_, c.override = parsed[name]
+		}
+	}
+	for name, c := range registry.components {
+		if l, ok := parsed[name]; ok {
+			c.level.Set(l)
+		} else if !c.override {
+			c.level.Set(registry.base)
+		}
+	}
+	return nil
+}
+
+// Levels is the level every component logs at, under "default" the one they get without an override
+func Levels() map[string]string {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	levels := map[string]string{"default": registry.base.String()}
+	for name, c := range registry.components {
+		levels[name] = c.level.Level().String()
+	}
+	return levels
+}
+
+func componentNames() []string {
+	names := make([]string, 0, len(registry.components))
+	for name := range registry.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Close closes the log file, what is logged afterwards only goes to the console
+func Close() error {
+	if file := current.Load().file; file != nil {
+		return file.Close()
+	}
+	return nil
+}
+
+// Fatal logs msg as an error and exits
+func Fatal(l *slog.Logger, msg string, args ...any) {
+	l.Error(msg, args...)
+	Close()
+	os.Exit(1)
+}
+
+// Discard is a logger that drops everything, for tests
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// componentHandler checks the level of its component and hands the record to the current sink, with
+// the attributes and groups it was given on top
+type componentHandler struct {
+	level *slog.LevelVar
+	ops   []func(slog.Handler) slog.Handler
+	// the sink with ops applied, made again when Setup swaps the sink
+	bound atomic.Pointer[boundHandler]
+}
+
+type boundHandler struct {
+	sink    *sink
+	handler slog.Handler
+}
+
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	s := current.Load()
+	b := h.bound.Load()
+	if b == nil || b.sink != s {
+		b = &boundHandler{sink: s, handler: s.handler}
+		for _, op := range h.ops {
+			b.handler = op(b.handler)
+		}
+		h.bound.Store(b)
+	}
+	return b.handler.Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithAttrs(attrs) })
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(next slog.Handler) slog.Handler { return next.WithGroup(name) })
+}
+
+func (h *componentHandler) with(op func(slog.Handler) slog.Handler) *componentHandler {
+	ops := make([]func(slog.Handler) slog.Handler, len(h.ops), len(h.ops)+1)
+	copy(ops, h.ops)
+	return &componentHandler{level: h.level, ops: append(ops, op)}
+}
+
+// multiHandler hands every record to all of its handlers
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var first error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := make(multiHandler, len(m))
+	for i, h := range m {
+		next[i] = h.WithAttrs(attrs)
+	}
+	return next
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	next := make(multiHandler, len(m))
+	for i, h := range m {
+		next[i] = h.WithGroup(name)
+	}
+	return next
+}
+
+// RunTag puts the id of the run in progress, as run_id, on every record of the loggers made with it
+type RunTag struct {
+	id atomic.Int64
+}
+
+func (t *RunTag) Set(id int) {
+	t.id.Store(int64(id))
+}
+
+func (t *RunTag) Clear() {
+	t.id.Store(0)
+}
+
+func (t *RunTag) Logger(l *slog.Logger) *slog.Logger {
+	return slog.New(&runHandler{next: l.Handler(), tag: t})
+}
+
+type runHandler struct {
+	next slog.Handler
+	tag  *RunTag
+}
+
+func (h *runHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *runHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := h.tag.id.Load(); id != 0 {
+		r = r.Clone()
+		r.AddAttrs(slog.Int64("run_id", id))
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *runHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &runHandler{next: h.next.WithAttrs(attrs), tag: h.tag}
+}
+
+func (h *runHandler) WithGroup(name string) slog.Handler {
+	return &runHandler{next: h.next.WithGroup(name), tag: h.tag}
+}
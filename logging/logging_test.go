@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lite/config"
+)
+
+func TestLevelsAndFile(t *testing.T) {
+	// made before Setup, the way package variables are
+	crawler, db := For("test-crawler"), For("test-db")
+	path := filepath.Join(t.TempDir(), "logs", "lite.log")
+	cfg := config.Default().Logging
+	cfg.Format, cfg.File, cfg.Levels = "json", path, map[string]string{"test-crawler": "debug"}
+	if err := Setup(cfg, hide("hunter2")); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cfg := config.Default().Logging
+		cfg.File = ""
+		Setup(cfg, nil)
+	}()
+
+	tag := &RunTag{}
+	tagged := tag.Logger(crawler)
+	tag.Set(42)
+	tagged.Debug("visiting", "url", "https://example.com")
+	tag.Clear()
+	db.Debug("not logged")
+	db.Info("stored", "event_id", 7, "url", "https://example.com/?key=hunter2")
+
+	if err := SetLevels(map[string]string{"test-db": "debug", "test-nothing": "debug"}); err == nil {
+		t.Error("an unknown component was accepted")
+	}
+	if err := SetLevels(map[string]string{"test-db": "loud"}); err == nil {
+		t.Error("an unknown level was accepted")
+	}
+	if err := SetLevel("test-db", "debug"); err != nil {
+		t.Fatal(err)
+	}
+	db.Debug("logged now")
+	if levels := Levels(); levels["test-db"] != "DEBUG" || levels["default"] != "INFO" {
+		t.Errorf("levels %v", levels)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var records []map[string]any
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("%s is not json: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 3 {
+		t.Fatalf("want 3 records, got %v", records)
+	}
+	if r := records[0]; r["component"] != "test-crawler" || r["level"] != "DEBUG" || r["run_id"] != float64(42) {
+		t.Errorf("crawler record %v", r)
+	}
+	if r := records[1]; r["component"] != "test-db" || r["msg"] != "stored" || r["run_id"] != nil || r["url"] != "https://example.com/?key=REDACTED" {
+		t.Errorf("db record %v", r)
+	}
+	if r := records[2]; r["msg"] != "logged now" {
+		t.Errorf("db record after the level change %v", r)
+	}
+}
+
+// hide is what secrets.Writer does, for a single secret
+func hide(secret string) func(io.Writer) io.Writer {
+	return func(w io.Writer) io.Writer {
+		return writerFunc(func(p []byte) (int, error) {
+			if _, err := w.Write([]byte(strings.ReplaceAll(string(p), secret, "REDACTED"))); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		})
+	}
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestTextHandler(t *testing.T) {
+	var out strings.Builder
+	l := slog.New(newTextHandler(&out, false)).With(componentKey, "scrape", "collector", "side")
+	l.WithGroup("page").Error("request failed", "url", "https://example.com/e/1", "err", "gateway timed out")
+	got := out.String()
+	want := `ERROR [scrape] request failed collector=side page.url=https://example.com/e/1 page.err="gateway timed out"` + "\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lite.log")
+	file, err := openRotating(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	line := strings.Repeat("x", 39) + "\n"
+	for i := 0; i < 8; i++ {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("%s grew to %d bytes", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more backups kept than asked for: %v", err)
+	}
+}
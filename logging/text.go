@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// textHandler writes a record per line for people to read, "15:04:05 INFO  [scrape] message key=value",
+// with the level colored when color is set
+type textHandler struct {
+	mu        *sync.Mutex
+	w         io.Writer
+	color     bool
+	component string
+	// group names of WithGroup, put in front of the keys
+	prefix string
+	// the attributes of WithAttrs, already written out
+	attrs []byte
+}
+
+var levelColors = map[slog.Level]*color.Color{
+	slog.LevelDebug: color.New(color.FgBlue),
+	slog.LevelInfo:  color.New(color.FgGreen),
+	slog.LevelWarn:  color.New(color.FgYellow, color.Bold),
+	slog.LevelError: color.New(color.FgRed, color.Bold),
+}
+
+func newTextHandler(w io.Writer, useColor bool) *textHandler {
+	return &textHandler{mu: &sync.Mutex{}, w: w, color: useColor}
+}
+
+func (h *textHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := make([]byte, 0, 256)
+	if !r.Time.IsZero() {
+		buf = r.Time.AppendFormat(buf, "2006-01-02 15:04:05 ")
+	}
+	buf = append(buf, h.level(r.Level)...)
+	if h.component != "" {
+		buf = append(buf, " ["...)
+		buf = append(buf, h.component...)
+		buf = append(buf, ']')
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, r.Message...)
+	buf = append(buf, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		buf = appendAttr(buf, h.prefix, a)
+		return true
+	})
+	buf = append(buf, '\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf)
+	return err
+}
+
+func (h *textHandler) level(l slog.Level) string {
+	name := l.String()
+	name += strings.Repeat(" ", max(0, 5-len(name)))
+	if c, ok := levelColors[l]; ok && h.color {
+		return c.Sprint(name)
+	}
+	return name
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := *h
+	next.attrs = append([]byte(nil), h.attrs...)
+	for _, a := range attrs {
+		// the component goes up front, not with the other fields
+		if a.Key == componentKey && h.prefix == "" {
+			next.component = a.Value.String()
+			continue
+		}
+		next.attrs = appendAttr(next.attrs, h.prefix, a)
+	}
+	return &next
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.prefix += name + "."
+	return &next
+}
+
+func appendAttr(buf []byte, prefix string, a slog.Attr) []byte {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return buf
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, member := range a.Value.Group() {
+			buf = appendAttr(buf, prefix, member)
+		}
+		return buf
+	}
+	buf = append(buf, ' ')
+	buf = append(buf, prefix...)
+	buf = append(buf, a.Key...)
+	buf = append(buf, '=')
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " =\"\t\n") {
+		return strconv.AppendQuote(buf, value)
+	}
+	return append(buf, value...)
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
-	"log"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/joho/godotenv"
 
-	"lite/DB"
-	scrape "lite/Scrape"
-	"lite/metrics"
-	"lite/pkg"
-	api "lite/server"
+	"lite/config"
+	"lite/logging"
+	"lite/secrets"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -19,19 +23,154 @@ Add notifications on certian conditoons (start , stop, crash) -> textbelt API
 Figure out what to do with the location data we are getting
 Figure out what to do with the Invalid Date Format we  are recieveing
 */
-func init() {
-	err := godotenv.Load()
+
+/*
+Every part of the scraper can be run on its own: `lite serve` is what the binary always did (scheduler, api
+and metrics), the other commands do one thing and exit. Without a command it serves, so existing deploys
+that start ./main keep working. Every command reads .env first when there is one (.env.example lists what
+goes in it), -env points it elsewhere. The typed config is loaded from config.json, or the file -config
+names, with the environment over it. There are no flags for single settings, -set KEY=VALUE is the flag
+layer: it sets the environment variable of a setting (-set SCRAPE_TIMEOUT=5m) before the config is loaded,
+so it wins over the file and .env. API keys and tokens arent settings, they come from the secrets the
+config points at
+*/
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(cl *cmdline, args []string) error
+}
+
+var commands = []command{
+	{"serve", "serve [-no-scheduler]", "run the scheduled jobs, the api and the metrics until killed", serveCommand},
+	{"scrape", "scrape [-lists nj,...] [-seeds url,...] [-recheck] [-url page [-store]] [-dry-run]", "run one crawl, or fetch and show a single event page", scrapeCommand},
+	{"geocode-backfill", "geocode-backfill [-limit n]", "look up coordinates for venues and addresses that have none", geocodeBackfillCommand},
+	{"export", "export <file.warc>", "write the latest capture of every archived page to a warc file", exportCommand},
+	{"import", "import <file.warc>", "add the responses in a warc file to the html archive", importCommand},
+	{"cache", "cache flush|stats|inspect <key>", "look at or empty the link cache", cacheCommand},
+	{"migrate", "migrate", "bring the database schema up to date", migrateCommand},
+	{"runs", "runs list [-limit n] [-offset n] [-json]", "show the recorded scrape runs", runsCommand},
+	{"replay", "replay [-warc file]", "rebuild every event from the html archive without fetching anything", replayCommand},
+	{"secrets", "secrets list|set <name>|delete <name>", "manage the encrypted secrets store, set reads the value from stdin", secretsCommand},
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+		logging.Fatal(logging.For(logging.Main), "command failed", "err", err)
+	}
+	logging.Close()
+}
+
+func run(args []string) error {
+	// no command, or only flags, is the old behaviour
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" {
+		args = append([]string{"serve"}, args...)
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" {
+		usage(os.Stdout)
+		return nil
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(newCmdline(cmd), args[1:])
+		}
+	}
+	usage(os.Stderr)
+	return fmt.Errorf("unknown command %q", name)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: lite <command> [flags]")
+	fmt.Fprintln(w)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-18s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "every command takes -config file, -env file and -set KEY=VALUE, run lite <command> -h for its flags")
+}
+
+// cmdline is the flag set of a command, with the settings every command has on it
+type cmdline struct {
+	*flag.FlagSet
+	configFile string
+	envFile    string
+	overrides  overrides
+	// loaded by parse
+	config  *config.Config
+	secrets *secrets.Secrets
+}
+
+type overrides map[string]string
+
+func (o overrides) String() string {
+	pairs := make([]string, 0, len(o))
+	for key, value := range o {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (o overrides) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("want KEY=VALUE, got %q", pair)
+	}
+	o[key] = value
+	return nil
+}
+
+func newCmdline(cmd command) *cmdline {
+	cl := &cmdline{FlagSet: flag.NewFlagSet(cmd.name, flag.ContinueOnError), overrides: overrides{}}
+	cl.StringVar(&cl.configFile, "config", config.File, "config file, the defaults are used when the default one isnt there")
+	cl.StringVar(&cl.envFile, "env", ".env", "file to read settings from")
+	cl.Var(cl.overrides, "set", "override a setting, KEY=VALUE, can be repeated")
+	cl.Usage = func() {
+		fmt.Fprintf(cl.Output(), "usage: lite %s\n\n%s\n\n", cmd.usage, cmd.summary)
+		cl.PrintDefaults()
+	}
+	return cl
+}
+
+// parse parses the command's flags, applies the settings and loads the config, before the command builds anything
+func (cl *cmdline) parse(args []string) error {
+	if err := cl.Parse(args); err != nil {
+		return err
+	}
+	// .env isnt checked in, without one the settings come from the environment alone
+	if _, err := os.Stat(cl.envFile); err == nil || cl.isSet("env") {
+		if err := godotenv.Load(cl.envFile); err != nil {
+			return fmt.Errorf("loading %s: %w", cl.envFile, err)
+		}
+	}
+	for key, value := range cl.overrides {
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	path := cl.configFile
+	if _, err := os.Stat(path); os.IsNotExist(err) && !cl.isSet("config") {
+		path = ""
+	}
+	cfg, err := config.Load(path)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return fmt.Errorf("config invalid: %w", err)
+	}
+	cl.config = cfg
+	if cl.secrets, err = secrets.Open(cfg.Secrets); err != nil {
+		return fmt.Errorf("secrets: %w", err)
 	}
+	// every key or token handed out from here on is scrubbed from what is logged
+	if err := logging.Setup(cfg.Logging, cl.secrets.Writer); err != nil {
+		return fmt.Errorf("logging: %w", err)
+	}
+	return nil
 }
-func main() {
-	colorOP := pkg.NewTextStyler()
-	db := DB.GetStorage()
-	webCrawler := scrape.Config()
-	met := &metrics.Metrics{}
-	s := api.NewServer()
-	pkg.SetUp(met, db, webCrawler, s)
-	colorOP.BoldRed("Complete with webscraper")
 
+func (cl *cmdline) isSet(name string) bool {
+	set := false
+	cl.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
 }
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// application level numbers (scrape fill rates, alert counts, ...) next to the system metrics, served on /metrics/app
+
+var (
+	appMu       sync.Mutex
+	appGauges   = make(map[string]float64)
+	appCounters = make(map[string]int64)
+)
+
+// SetGauge records the latest value of name
+func SetGauge(name string, value float64) {
+	appMu.Lock()
+	defer appMu.Unlock()
+	appGauges[name] = value
+}
+
+// IncCounter adds one to name
+func IncCounter(name string) {
+	appMu.Lock()
+	defer appMu.Unlock()
+	appCounters[name]++
+}
+
+func appMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	appMu.Lock()
+	snapshot := map[string]interface{}{
+		"gauges":   copyMap(appGauges),
+		"counters": copyMap(appCounters),
+	}
+	appMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func copyMap[V any](m map[string]V) map[string]V {
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -3,18 +3,21 @@ package metrics
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"runtime"
 	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/mem"
+
+	"lite/config"
+	"lite/logging"
 )
 
+var logger = logging.For(logging.Metrics)
+
 type Metrics struct {
 	Time            string  `json:"time"`
 	CPUUsage        float64 `json:"cpu_usage_percent"`
@@ -31,7 +34,7 @@ type Metrics struct {
 var currentMetrics Metrics
 
 func CollectMetrics(fileName string, interval time.Duration) {
-	fmt.Println("Metrics is up and running")
+	logger.Info("collecting metrics", "interval", interval, "file", fileName)
 	go func() {
 		for {
 			// Collect metrics
@@ -64,7 +67,7 @@ func saveMetricsToFile(fileName string) {
 	// Open the file in append mode
 	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Printf("Error opening file: %v\n", err)
+		logger.Error("opening the metrics file failed", "file", fileName, "err", err)
 		return
 	}
 	defer file.Close()
@@ -72,7 +75,7 @@ func saveMetricsToFile(fileName string) {
 	// Marshal the metrics to JSON
 	metricsJSON, err := json.MarshalIndent(currentMetrics, "", "  ")
 	if err != nil {
-		log.Printf("Error marshaling JSON: %v\n", err)
+		logger.Error("marshaling the metrics failed", "err", err)
 		return
 	}
 
@@ -91,7 +94,7 @@ func saveMetricsToFile(fileName string) {
 	file.Write(metricsJSON)
 	file.WriteString("\n]") // Close the JSON array
 
-	log.Printf("Metrics saved to file: %s", currentMetrics.Time)
+	logger.Debug("metrics saved", "file", fileName, "time", currentMetrics.Time)
 }
 
 // API handler to serve the latest metrics as JSON
@@ -112,27 +115,32 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	var message = fmt.Sprintf("Sever is Live %v", time.Now())
 	w.Write([]byte(message))
 }
-func StartMetricsJob(interval time.Duration, fileName string) {
+func StartMetricsJob(interval time.Duration, fileName string, addr string) {
 	// Start collecting metrics every 5 seconds in a separate goroutine
 	go CollectMetrics(fileName, interval)
 
 	go func() {
 		http.HandleFunc("/metrics", metricsHandler)
+		http.HandleFunc("/metrics/app", appMetricsHandler)
 		http.HandleFunc("/Life", healthCheck)
 
 		// Start the HTTP server (blocking operation)
-		port := ":9999"
-		fmt.Printf("Starting server on http://localhost%s...\n", port)
-		log.Fatal(http.ListenAndServe(port, nil))
+		logger.Info("serving metrics", "addr", addr)
+		logging.Fatal(logger, "metrics server failed", "err", http.ListenAndServe(addr, nil))
 	}()
 
 }
 
-func (m *Metrics) Start() error {
-	StartMetricsJob(time.Second*15, "metrics/metrics.json")
-	err := godotenv.Load()
-	if err != nil {
-		return err
-	}
+// Collector samples the host every interval and serves the latest sample
+type Collector struct {
+	cfg config.MetricsConfig
+}
+
+func NewCollector(cfg config.MetricsConfig) *Collector {
+	return &Collector{cfg: cfg}
+}
+
+func (c *Collector) Start() error {
+	StartMetricsJob(c.cfg.Interval.Std(), c.cfg.File, c.cfg.Addr)
 	return nil // this cant fail but must fufil the interface
 }
@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"lite/logging"
+)
+
+var logger = logging.For(logging.Notify)
+
+// Notifier tells a person that something needs a look
+type Notifier interface {
+	Notify(subject, message string) error
+}
+
+// NewNotifier posts to the slack webhook, the SLACK_WEBHOOK_URL secret, and only logs without one
+func NewNotifier(webhook string) Notifier {
+	if webhook != "" {
+		return &SlackNotifier{webhook: webhook, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	return LogNotifier{}
+}
+
+type SlackNotifier struct {
+	webhook string
+	client  *http.Client
+}
+
+func (s *SlackNotifier) Notify(subject, message string) error {
+	body, err := json.Marshal(map[string]string{"text": fmt.Sprintf("*%s*\n%s", subject, message)})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the webhook url is the secret, leave it out
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("posting to slack: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(subject, message string) error {
+	logger.Warn(subject, "notification", message)
+	return nil
+}
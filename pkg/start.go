@@ -1,7 +1,7 @@
 package pkg
 
 import (
-	"log"
+	"lite/logging"
 )
 
 type Starter interface {
@@ -12,7 +12,7 @@ func SetUp(input ...Starter) error {
 	for _, config := range input {
 		err := config.Start()
 		if err != nil {
-			log.Fatal(err)
+			logging.Fatal(logging.For(logging.Main), "start up failed", "err", err)
 		}
 	}
 	return nil
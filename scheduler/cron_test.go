@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// a wednesday
+	from := time.Date(2030, 1, 2, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2030, 1, 2, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2030, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2030, 1, 2, 10, 25, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2030, 1, 3, 3, 0, 0, 0, time.UTC)},
+		{"0 9,15,21 * * *", time.Date(2030, 1, 2, 15, 0, 0, 0, time.UTC)},
+		{"30 8-11/2 * * *", time.Date(2030, 1, 2, 10, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2030, 1, 6, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 1-5", time.Date(2030, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// both day fields set: the 15th or any monday, whichever comes first
+		{"0 12 15 * 1", time.Date(2030, 1, 7, 12, 0, 0, 0, time.UTC)},
+		// a stepped star is still unrestricted: odd days that are mondays, not odd days or mondays
+		{"0 0 */2 * 1", time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2032, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		schedule, err := ParseCron(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(test.want) {
+			t.Errorf("%s: next = %v, want %v", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@yearly"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("%q parsed without an error", spec)
+		}
+	}
+}
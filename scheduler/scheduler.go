@@ -0,0 +1,267 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"lite/DB"
+	"lite/pkg"
+)
+
+/*
+Runs the scrape jobs inside the process on cron expressions from schedule.json instead of once at start
+up. Only one job runs at a time, they all share the scraper and the database: a job that comes due while
+another is still going is recorded as skipped and waits for its next turn. Every run, skipped ones too,
+ends up in the job_runs table, which is where the admin api reads the last runs from
+*/
+
+const (
+	ScheduleFile = "schedule.json"
+	// how often the loop looks for due jobs, cron only goes down to the minute anyway
+	tickEvery = 20 * time.Second
+)
+
+// ErrSkipped is returned by a job that didnt run because something else was busy (a crawl started from the
+// admin api, say). The run is recorded as skipped, not failed
+var ErrSkipped = errors.New("skipped")
+
+// JobConfig is one entry of schedule.json
+type JobConfig struct {
+	Job     string `json:"job"`
+	Cron    string `json:"cron"`
+	Enabled bool   `json:"enabled"`
+	// also run once right after start up, the way the scraper always used to
+	RunAtStart bool `json:"run_at_start,omitempty"`
+}
+
+type job struct {
+	config   JobConfig
+	schedule *Schedule
+	run      func() error
+	next     time.Time
+}
+
+// JobStatus is what the admin api shows for a job
+type JobStatus struct {
+	Job     string     `json:"job"`
+	Cron    string     `json:"cron"`
+	Enabled bool       `json:"enabled"`
+	Running bool       `json:"running"`
+	NextRun *time.Time `json:"next_run"`
+	LastRun *DB.JobRun `json:"last_run"`
+}
+
+type Scheduler struct {
+	db       *DB.Storage
+	logger   *slog.Logger
+	notifier pkg.Notifier
+	now      func() time.Time
+	// jobs that can be scheduled, by name
+	available map[string]func() error
+	mu        sync.Mutex
+	jobs      []*job
+	running   string
+	wg        sync.WaitGroup
+	stop      chan struct{}
+}
+
+func NewScheduler(db *DB.Storage, logger *slog.Logger, notifier pkg.Notifier) *Scheduler {
+	return &Scheduler{
+		db:        db,
+		logger:    logger,
+		notifier:  notifier,
+		now:       time.Now,
+		available: make(map[string]func() error),
+		stop:      make(chan struct{}),
+	}
+}
+
+// Register makes a job available to the schedule under name
+func (s *Scheduler) Register(name string, run func() error) {
+	s.available[name] = run
+}
+
+// LoadSchedule reads and validates the schedule, every job in it has to be registered
+func (s *Scheduler) LoadSchedule(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading schedule: %w", err)
+	}
+	var file struct {
+		Jobs []JobConfig `json:"jobs"`
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	jobs := make([]*job, 0, len(file.Jobs))
+	seen := make(map[string]bool)
+	for _, config := range file.Jobs {
+		run, ok := s.available[config.Job]
+		if !ok {
+			return fmt.Errorf("%s: unknown job %q", path, config.Job)
+		}
+		if seen[config.Job] {
+			return fmt.Errorf("%s: job %q is scheduled twice", path, config.Job)
+		}
+		seen[config.Job] = true
+		schedule, err := ParseCron(config.Cron)
+		if err != nil {
+			return fmt.Errorf("%s: job %s: %w", path, config.Job, err)
+		}
+		jobs = append(jobs, &job{config: config, schedule: schedule, run: run})
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = jobs
+	return nil
+}
+
+// Start runs the jobs that run at start up and then keeps checking for due ones until Stop
+func (s *Scheduler) Start() error {
+	now := s.now()
+	s.mu.Lock()
+	var atStart []*job
+	for _, j := range s.jobs {
+		j.next = j.schedule.Next(now)
+		if j.config.Enabled && j.config.RunAtStart {
+			atStart = append(atStart, j)
+		}
+	}
+	s.mu.Unlock()
+	go func() {
+		// one after the other, the later ones would only be skipped otherwise
+		for _, j := range atStart {
+			s.trigger(j)
+			s.wg.Wait()
+		}
+		ticker := time.NewTicker(tickEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.tick(s.now())
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop ends the loop and waits for a running job to finish
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// tick starts every enabled job that is due at now
+func (s *Scheduler) tick(now time.Time) {
+	s.mu.Lock()
+	var due []*job
+	for _, j := range s.jobs {
+		if j.next.IsZero() || j.next.After(now) {
+			continue
+		}
+		j.next = j.schedule.Next(now)
+		if j.config.Enabled {
+			due = append(due, j)
+		}
+	}
+	s.mu.Unlock()
+	for _, j := range due {
+		s.trigger(j)
+	}
+}
+
+func (s *Scheduler) trigger(j *job) {
+	s.mu.Lock()
+	if s.running != "" {
+		running := s.running
+		s.mu.Unlock()
+		now := s.now()
+		s.logger.Warn("job came due while another one is still running, skipping it", "job", j.config.Job, "running", running)
+		s.record(&DB.JobRun{Job: j.config.Job, StartedAt: now, FinishedAt: now, Status: DB.JobSkipped,
+			Error: fmt.Sprintf("%s was still running", running)})
+		return
+	}
+	s.running = j.config.Job
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		run := &DB.JobRun{Job: j.config.Job, StartedAt: s.now(), Status: DB.JobSucceeded}
+		logger := s.logger.With("job", j.config.Job)
+		logger.Info("starting job")
+		err := runJob(j.run)
+		run.FinishedAt = s.now()
+		switch {
+		case errors.Is(err, ErrSkipped):
+			run.Status, run.Error = DB.JobSkipped, err.Error()
+			logger.Warn("job skipped", "err", err)
+		case err != nil:
+			run.Status, run.Error = DB.JobFailed, err.Error()
+			logger.Error("job failed", "took", run.FinishedAt.Sub(run.StartedAt), "err", err)
+			if s.notifier != nil {
+				s.notifier.Notify(fmt.Sprintf("scheduled job %s failed", j.config.Job), err.Error())
+			}
+		default:
+			logger.Info("job finished", "took", run.FinishedAt.Sub(run.StartedAt))
+		}
+		s.record(run)
+		s.mu.Lock()
+		s.running = ""
+		s.mu.Unlock()
+	}()
+}
+
+// runJob turns a panic inside a job into its error, one broken run shouldnt take the process down
+func runJob(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
+
+func (s *Scheduler) record(run *DB.JobRun) {
+	if err := s.db.AddJobRun(run); err != nil {
+		s.logger.Error("recording the job run failed", "job", run.Job, "err", err)
+	}
+}
+
+// Status lists every scheduled job with its next and last run, by name
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := JobStatus{
+			Job:     j.config.Job,
+			Cron:    j.config.Cron,
+			Enabled: j.config.Enabled,
+			Running: s.running == j.config.Job,
+		}
+		if next := j.next; j.config.Enabled && !next.IsZero() {
+			status.NextRun = &next
+		}
+		statuses = append(statuses, status)
+	}
+	s.mu.Unlock()
+	for i := range statuses {
+		if last, found := s.db.LastJobRun(statuses[i].Job); found {
+			statuses[i].LastRun = last
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Job < statuses[j].Job })
+	return statuses
+}
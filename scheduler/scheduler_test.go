@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"lite/DB"
+	"lite/logging"
+)
+
+func newTestScheduler(t *testing.T, schedule string, jobs map[string]func() error) *Scheduler {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := DB.NewStorage(filepath.Join(dir, "scheduler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(db, logging.Discard(), nil)
+	for name, run := range jobs {
+		s.Register(name, run)
+	}
+	path := filepath.Join(dir, ScheduleFile)
+	if err := os.WriteFile(path, []byte(schedule), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.LoadSchedule(path); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSchedulerRuns(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	count := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[name]++
+	}
+	s := newTestScheduler(t, `{"jobs": [
+		{"job": "crawl", "cron": "0 * * * *", "enabled": true},
+		{"job": "backfill", "cron": "0 * * * *", "enabled": true},
+		{"job": "broken", "cron": "30 * * * *", "enabled": true},
+		{"job": "off", "cron": "* * * * *", "enabled": false}]}`,
+		map[string]func() error{
+			"crawl":    func() error { count("crawl"); <-release; return nil },
+			"backfill": func() error { count("backfill"); return nil },
+			"broken":   func() error { count("broken"); panic("selector missing") },
+			"off":      func() error { count("off"); return errors.New("should not run") },
+		})
+	now := time.Date(2030, 1, 2, 9, 59, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	for _, j := range s.jobs {
+		j.next = j.schedule.Next(now)
+	}
+
+	// crawl and backfill come due together, backfill has to wait for the next hour
+	now = now.Add(time.Minute)
+	s.tick(now)
+	close(release)
+	s.wg.Wait()
+	now = now.Add(30 * time.Minute)
+	s.tick(now)
+	s.wg.Wait()
+
+	if calls["crawl"] != 1 || calls["backfill"] != 0 || calls["broken"] != 1 || calls["off"] != 0 {
+		t.Errorf("calls = %v", calls)
+	}
+	statuses := make(map[string]JobStatus)
+	for _, status := range s.Status() {
+		statuses[status.Job] = status
+	}
+	for job, want := range map[string]string{"crawl": DB.JobSucceeded, "backfill": DB.JobSkipped, "broken": DB.JobFailed} {
+		last := statuses[job].LastRun
+		if last == nil || last.Status != want {
+			t.Errorf("%s last run = %+v, want %s", job, last, want)
+		}
+	}
+	if last := statuses["broken"].LastRun; last == nil || last.Error != "panic: selector missing" {
+		t.Errorf("broken job error = %+v", last)
+	}
+	if next := statuses["backfill"].NextRun; next == nil || !next.Equal(time.Date(2030, 1, 2, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("backfill next run = %v", next)
+	}
+	if off := statuses["off"]; off.NextRun != nil || off.LastRun != nil {
+		t.Errorf("disabled job = %+v", off)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	dir := t.TempDir()
+	db, err := DB.NewStorage(filepath.Join(dir, "scheduler.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewScheduler(db, logging.Discard(), nil)
+	s.Register("crawl", func() error { return nil })
+	for name, schedule := range map[string]string{
+		"unknown job": `{"jobs": [{"job": "recrawl", "cron": "@daily", "enabled": true}]}`,
+		"bad cron":    `{"jobs": [{"job": "crawl", "cron": "0 25 * * *", "enabled": true}]}`,
+		"twice":       `{"jobs": [{"job": "crawl", "cron": "@daily"}, {"job": "crawl", "cron": "@hourly"}]}`,
+		"unknown key": `{"jobs": [{"job": "crawl", "cron": "@daily", "timezone": "UTC"}]}`,
+	} {
+		path := filepath.Join(dir, "schedule.json")
+		if err := os.WriteFile(path, []byte(schedule), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.LoadSchedule(path); err == nil {
+			t.Errorf("%s: loaded without an error", name)
+		}
+	}
+}
+
+func TestShippedSchedule(t *testing.T) {
+	s := NewScheduler(nil, logging.Discard(), nil)
+	for _, name := range []string{"full-crawl", "nj-crawl", "stale-recheck", "geocode-backfill"} {
+		s.Register(name, func() error { return nil })
+	}
+	if err := s.LoadSchedule(filepath.Join("..", ScheduleFile)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type countingNotifier struct{ sent int }
+
+func (c *countingNotifier) Notify(subject, message string) error {
+	c.sent++
+	return nil
+}
+
+func TestBusyJobIsSkipped(t *testing.T) {
+	s := newTestScheduler(t, `{"jobs": [{"job": "crawl", "cron": "0 * * * *", "enabled": true}]}`,
+		map[string]func() error{
+			"crawl": func() error { return fmt.Errorf("%w: a scrape run is already in progress", ErrSkipped) },
+		})
+	notifier := &countingNotifier{}
+	s.notifier = notifier
+	s.trigger(s.jobs[0])
+	s.wg.Wait()
+
+	last := s.Status()[0].LastRun
+	if last == nil || last.Status != DB.JobSkipped {
+		t.Errorf("busy job recorded as %+v, want skipped", last)
+	}
+	if notifier.sent != 0 {
+		t.Errorf("a skipped job sent %d notifications", notifier.sent)
+	}
+}
@@ -0,0 +1,196 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"lite/config"
+	"lite/logging"
+)
+
+/*
+API keys, tokens and webhooks are never in the code or config.json. Whoever needs one asks a Provider
+for it by name. The environment is checked first (.env and -set land there), then a directory with one
+file per secret (docker and kubernetes mount secrets like that), then the encrypted store that
+`lite secrets set` writes. Every value handed out is remembered, so Redact can scrub it out of anything
+about to be logged. RedactURL hides the key parameters of a url, even for keys we never handed out
+*/
+
+// PassphraseEnv is where the passphrase of the encrypted store is read from. It cant live in the store
+const PassphraseEnv = "SECRETS_PASSPHRASE"
+
+// the names the rest of the code asks for
+const (
+	GelokyKey    = "GELOKY_KEY"
+	MapsCoKey    = "MAPS_CO_KEY"
+	AdminToken   = "ADMIN_TOKEN"
+	SlackWebhook = "SLACK_WEBHOOK_URL"
+)
+
+// deprecatedNames are what the keys were called before, an old .env still works but gets a warning
+var deprecatedNames = map[string]string{
+	MapsCoKey: "API_KEY",
+	GelokyKey: "GEOKEY",
+}
+
+var ErrNotFound = errors.New("secret not set")
+
+// Provider looks secrets up by name, it returns ErrNotFound for one it doesnt have
+type Provider interface {
+	Secret(name string) (string, error)
+}
+
+// Env reads secrets from the environment, an empty variable counts as not set
+type Env struct{}
+
+func (Env) Secret(name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+// Dir reads the secret name from the file of that name in the directory, without a trailing newline
+type Dir string
+
+func (d Dir) Secret(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || name == "" || name[0] == '.' {
+		return "", fmt.Errorf("%q is not a secret name", name)
+	}
+	raw, err := os.ReadFile(filepath.Join(string(d), name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimRight(string(raw), "\r\n")
+	if value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// Chain asks each provider in turn, the first that has the secret wins
+type Chain []Provider
+
+func (c Chain) Secret(name string) (string, error) {
+	for _, p := range c {
+		value, err := p.Secret(name)
+		if !errors.Is(err, ErrNotFound) {
+			return value, err
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Secrets is the provider the process uses, it remembers what it handed out for Redact
+type Secrets struct {
+	provider Provider
+	mu       sync.Mutex
+	seen     map[string]struct{}
+}
+
+func New(p Provider) *Secrets {
+	return &Secrets{provider: p, seen: make(map[string]struct{})}
+}
+
+// Open chains the environment, the directory and the store of cfg. The store is only opened when its
+// file is there, and then it needs the passphrase
+func Open(cfg config.SecretsConfig) (*Secrets, error) {
+	chain := Chain{Env{}}
+	if cfg.Dir != "" {
+		chain = append(chain, Dir(cfg.Dir))
+	}
+	if cfg.Store != "" {
+		if _, err := os.Stat(cfg.Store); err == nil {
+			store, err := OpenStore(cfg.Store, os.Getenv(PassphraseEnv))
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, store)
+		}
+	}
+	return New(chain), nil
+}
+
+// Get returns the secret, or an error saying which one is missing
+func (s *Secrets) Get(name string) (string, error) {
+	value, err := s.provider.Secret(name)
+	if old, ok := deprecatedNames[name]; ok && errors.Is(err, ErrNotFound) {
+		if value, err = s.provider.Secret(old); err == nil {
+			logging.For(logging.Main).Warn("secret set under its old name, rename it", "old", old, "secret", name)
+		}
+	}
+	if errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", name, err)
+	}
+	s.mu.Lock()
+	s.seen[value] = struct{}{}
+	s.mu.Unlock()
+	return value, nil
+}
+
+// Optional is Get for a secret that turns a feature off when it isnt set, it is "" then
+func (s *Secrets) Optional(name string) (string, error) {
+	value, err := s.Get(name)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return value, err
+}
+
+// Redact replaces every secret handed out so far in text
+func (s *Secrets) Redact(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for value := range s.seen {
+		text = strings.ReplaceAll(text, value, redacted)
+	}
+	return text
+}
+
+// Writer redacts everything written through it before passing it on to w, for log outputs
+func (s *Secrets) Writer(w io.Writer) io.Writer {
+	return redactingWriter{s, w}
+}
+
+type redactingWriter struct {
+	secrets *Secrets
+	w       io.Writer
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, r.secrets.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+const redacted = "REDACTED"
+
+var keyParams = regexp.MustCompile(`(?i)((?:^|[?&])(?:key|api_?key|token|access_token|secret|password)=)[^&#]*`)
+
+// RedactURL hides the values of the query parameters that hold keys, the rest of the url stays readable
+func RedactURL(u string) string {
+	return keyParams.ReplaceAllString(u, "${1}"+redacted)
+}
+
+// RedactError is RedactURL for the url a failed request puts into its error
+func RedactError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: RedactURL(urlErr.URL), Err: urlErr.Err}
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.store")
+	store, err := OpenStore(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(GelokyKey, "geloky-key-value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "geloky-key-value") {
+		t.Errorf("store holds the value in the clear: %s", raw)
+	}
+	if _, err := OpenStore(path, "battery staple"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("wrong passphrase opened the store: %v", err)
+	}
+
+	reopened, err := OpenStore(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, err := reopened.Secret(GelokyKey); err != nil || value != "geloky-key-value" {
+		t.Errorf("got %q %v back", value, err)
+	}
+	if _, err := reopened.Secret(MapsCoKey); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unset secret: %v", err)
+	}
+	// a value moved to another name doesnt open
+	reopened.file.Secrets[MapsCoKey] = reopened.file.Secrets[GelokyKey]
+	if _, err := reopened.Secret(MapsCoKey); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("swapped value opened: %v", err)
+	}
+}
+
+func TestChainAndRedact(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, AdminToken), []byte("from-the-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, GelokyKey), []byte("file-key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(GelokyKey, "env-key")
+	keys := New(Chain{Env{}, Dir(dir)})
+
+	if token, err := keys.Get(AdminToken); err != nil || token != "from-the-file" {
+		t.Errorf("admin token %q %v", token, err)
+	}
+	if key, _ := keys.Get(GelokyKey); key != "env-key" {
+		t.Errorf("environment should win over the directory, got %q", key)
+	}
+	if _, err := keys.Get(SlackWebhook); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), SlackWebhook) {
+		t.Errorf("missing secret: %v", err)
+	}
+	if value, err := keys.Optional(SlackWebhook); value != "" || err != nil {
+		t.Errorf("optional secret: %q %v", value, err)
+	}
+	if _, err := keys.Get("../config.json"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("path as a secret name: %v", err)
+	}
+
+	var logged strings.Builder
+	keys.Writer(&logged).Write([]byte("token from-the-file and key env-key\n"))
+	if got := logged.String(); got != "token REDACTED and key REDACTED\n" {
+		t.Errorf("logged %q", got)
+	}
+	url := "https://geloky.com/api/geo/geocode?address=1%20Main%20St&key=abc123&format=geloky"
+	if got := RedactURL(url); got != "https://geloky.com/api/geo/geocode?address=1%20Main%20St&key=REDACTED&format=geloky" {
+		t.Errorf("redacted url %s", got)
+	}
+}
+
+func TestDeprecatedNames(t *testing.T) {
+	// an .env from before the secrets had their current names
+	t.Setenv("API_KEY", "old-maps-key")
+	t.Setenv("GEOKEY", "old-geloky-key")
+	t.Setenv(GelokyKey, "new-geloky-key")
+	keys := New(Env{})
+
+	if key, err := keys.Get(MapsCoKey); err != nil || key != "old-maps-key" {
+		t.Errorf("maps.co key from API_KEY: %q %v", key, err)
+	}
+	if key, _ := keys.Get(GelokyKey); key != "new-geloky-key" {
+		t.Errorf("the current name should win over the old one, got %q", key)
+	}
+	if got := keys.Redact("key old-maps-key"); got != "key REDACTED" {
+		t.Errorf("a key read under its old name isnt redacted: %q", got)
+	}
+}
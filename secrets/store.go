@@ -0,0 +1,200 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/*
+The encrypted store is a json file that can sit next to the binary without giving anything away. The
+key is derived from a passphrase with PBKDF2-HMAC-SHA256 and a random salt, every secret is sealed with
+AES-256-GCM under its own nonce and with its name as additional data, so values cant be swapped between
+names. A sealed check value tells a wrong passphrase apart from a damaged file when the store is opened.
+Names are in the clear, values are not
+*/
+
+const (
+	storeVersion = 1
+	kdfRounds    = 600000
+	saltSize     = 16
+	checkName    = "\x00check"
+	checkValue   = "lite secrets store"
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase for the secrets store")
+
+type storeFile struct {
+	Version int               `json:"version"`
+	Rounds  int               `json:"rounds"`
+	Salt    []byte            `json:"salt"`
+	Check   []byte            `json:"check"`
+	Secrets map[string][]byte `json:"secrets"`
+}
+
+// Store is the encrypted secrets file at path, changes are only written by Save
+type Store struct {
+	path string
+	mu   sync.Mutex
+	file storeFile
+	aead cipher.AEAD
+}
+
+// OpenStore opens the store at path, or starts an empty one when there is no file yet
+func OpenStore(path, passphrase string) (*Store, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("the secrets store %s needs a passphrase in %s", path, PassphraseEnv)
+	}
+	s := &Store{path: path}
+	raw, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		s.file = storeFile{Version: storeVersion, Rounds: kdfRounds, Salt: make([]byte, saltSize), Secrets: map[string][]byte{}}
+		if _, err := rand.Read(s.file.Salt); err != nil {
+			return nil, err
+		}
+		if s.aead, err = newAEAD(passphrase, s.file.Salt, s.file.Rounds); err != nil {
+			return nil, err
+		}
+		if s.file.Check, err = s.seal(checkName, checkValue); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case err != nil:
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&s.file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.file.Version != storeVersion || s.file.Rounds < 1 || len(s.file.Salt) == 0 {
+		return nil, fmt.Errorf("%s is not a version %d secrets store", path, storeVersion)
+	}
+	if s.file.Secrets == nil {
+		s.file.Secrets = map[string][]byte{}
+	}
+	if s.aead, err = newAEAD(passphrase, s.file.Salt, s.file.Rounds); err != nil {
+		return nil, err
+	}
+	if check, err := s.open(checkName, s.file.Check); err != nil || check != checkValue {
+		return nil, ErrWrongPassphrase
+	}
+	return s, nil
+}
+
+func (s *Store) Secret(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sealed, ok := s.file.Secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	value, err := s.open(name, sealed)
+	if err != nil {
+		return "", fmt.Errorf("%s is damaged in %s", name, s.path)
+	}
+	return value, nil
+}
+
+func (s *Store) Set(name, value string) error {
+	if name == "" || value == "" {
+		return fmt.Errorf("a secret needs a name and a value")
+	}
+	sealed, err := s.seal(name, value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.file.Secrets[name] = sealed
+	return nil
+}
+
+// Delete removes the secret, it is false when there wasnt one
+func (s *Store) Delete(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.file.Secrets[name]
+	delete(s.file.Secrets, name)
+	return ok
+}
+
+func (s *Store) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.file.Secrets))
+	for name := range s.file.Secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save writes the store, readable by its owner only. It goes through a temporary file so a crash
+// halfway doesnt lose the old one
+func (s *Store) Save() error {
+	s.mu.Lock()
+	raw, err := json.MarshalIndent(s.file, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// seal returns the nonce followed by the ciphertext
+func (s *Store) seal(name, value string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(value)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, []byte(value), []byte(name)), nil
+}
+
+func (s *Store) open(name string, sealed []byte) (string, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("sealed value too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	plain, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func newAEAD(passphrase string, salt []byte, rounds int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, rounds, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	scrape "lite/Scrape"
+	"lite/logging"
+)
+
+// Crawler is the scraper as the admin api controls it
+type Crawler interface {
+	StartRun(opts scrape.CrawlOptions) (int, error)
+	Pause() error
+	Resume() error
+	Cancel() error
+	Progress() scrape.Progress
+	ScrapeURL(pageURL string, store bool) (*scrape.Inspection, error)
+}
+
+// admin only lets requests with the admin token through to next
+func (s *Server) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if s.adminToken == "" {
+			http.Error(w, "The admin api is disabled, set ADMIN_TOKEN to enable it", http.StatusForbidden)
+			return
+		}
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Missing or wrong admin token", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
+}
+
+// schedule lists the scheduled jobs with their next and last run
+func (s *Server) schedule(w http.ResponseWriter, req *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "No scheduler is running in this process", http.StatusNotFound)
+		return
+	}
+	jobs := s.scheduler.Status()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventResponse{
+		Total:   len(jobs),
+		Payload: jobs,
+	})
+}
+
+// runs lists the scrape runs, newest first
+func (s *Server) runs(w http.ResponseWriter, req *http.Request) {
+	queryParams := req.URL.Query()
+	cleanOffset, cleanLimit, err := handleAndClean(queryParams.Get("offset"), queryParams.Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid offset or limit passed in request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	runs, err := s.disk.ScrapeRuns(uint(cleanOffset), uint(cleanLimit))
+	if err != nil {
+		http.Error(w, "Database Operation to fetch scrape runs has failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventResponse{
+		Total:   len(runs),
+		Payload: runs,
+	})
+}
+
+// run serves GET /admin/runs/{id}
+func (s *Server) run(w http.ResponseWriter, req *http.Request) {
+	id, err := resourceID(req.URL.Path, "/admin/runs/", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	run, err := s.disk.ScrapeRun(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("scrape run %d not found", id), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// crawl serves GET /admin/crawl with the progress of the crawl in progress, and POST /admin/crawl which
+// starts one, limited by the lists, seeds or url in the body
+func (s *Server) crawl(w http.ResponseWriter, req *http.Request) {
+	if s.crawler == nil {
+		http.Error(w, "No scraper is running in this process", http.StatusNotFound)
+		return
+	}
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s.crawler.Progress())
+	case http.MethodPost:
+		var opts scrape.CrawlOptions
+		if req.ContentLength != 0 {
+			decoder := json.NewDecoder(req.Body)
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&opts); err != nil {
+				http.Error(w, "Invalid crawl options: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		id, err := s.crawler.StartRun(opts)
+		if errors.Is(err, scrape.ErrRunInProgress) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Starting the crawl failed: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", fmt.Sprintf("/admin/runs/%d", id))
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]int{"run_id": id})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// crawlControl serves POST /admin/crawl/pause, /admin/crawl/resume and /admin/crawl/cancel
+func (s *Server) crawlControl(w http.ResponseWriter, req *http.Request) {
+	if s.crawler == nil {
+		http.Error(w, "No scraper is running in this process", http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	actions := map[string]func() error{
+		"pause":  s.crawler.Pause,
+		"resume": s.crawler.Resume,
+		"cancel": s.crawler.Cancel,
+	}
+	action, ok := actions[strings.TrimPrefix(req.URL.Path, "/admin/crawl/")]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if err := action(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.crawler.Progress())
+}
+
+// inspect serves /admin/inspect?url=, which fetches and parses that one event page and shows where every
+// field came from. A POST also stores the event
+func (s *Server) inspect(w http.ResponseWriter, req *http.Request) {
+	if s.crawler == nil {
+		http.Error(w, "No scraper is running in this process", http.StatusNotFound)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pageURL := req.URL.Query().Get("url")
+	if pageURL == "" {
+		http.Error(w, "Missing url parameter", http.StatusBadRequest)
+		return
+	}
+	inspection, err := s.crawler.ScrapeURL(pageURL, req.Method == http.MethodPost)
+	if errors.Is(err, scrape.ErrNotSitePage) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Scraping the page failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inspection)
+}
+
+// logLevels serves GET /admin/log-levels with the level of every component, and PUT which changes the
+// levels in the body, {"scrape": "debug", "default": "warn"}. An empty level puts a component back on
+// the default
+func (s *Server) logLevels(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var levels map[string]string
+		decoder := json.NewDecoder(req.Body)
+		if err := decoder.Decode(&levels); err != nil {
+			http.Error(w, "Invalid levels: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := logging.SetLevels(levels); err != nil {
+			http.Error(w, "Invalid levels: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		logger.Info("log levels changed", "levels", levels)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logging.Levels())
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	db "lite/DB"
+	scrape "lite/Scrape"
+	"lite/config"
+)
+
+// fakeCrawler answers for the scraper, every call is counted so a request that got past the token shows
+type fakeCrawler struct {
+	calls int
+}
+
+func (f *fakeCrawler) StartRun(scrape.CrawlOptions) (int, error) {
+	f.calls++
+	return 1, nil
+}
+
+func (f *fakeCrawler) Pause() error  { f.calls++; return nil }
+func (f *fakeCrawler) Resume() error { f.calls++; return nil }
+func (f *fakeCrawler) Cancel() error { f.calls++; return nil }
+
+func (f *fakeCrawler) Progress() scrape.Progress {
+	f.calls++
+	return scrape.Progress{}
+}
+
+func (f *fakeCrawler) ScrapeURL(pageURL string, store bool) (*scrape.Inspection, error) {
+	f.calls++
+	return &scrape.Inspection{URL: pageURL}, nil
+}
+
+func TestAdminToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.db")
+	if _, err := db.NewStorage(path); err != nil {
+		t.Fatal(err)
+	}
+	disk := db.NewQuery(path)
+
+	endpoints := []string{"/admin/crawl", "/admin/runs", "/admin/inspect?url=https://www.eventbrite.com/e/jazz-1"}
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{name: "no token", token: "s3cret", want: http.StatusUnauthorized},
+		{name: "wrong token", token: "s3cret", authorization: "Bearer guess", want: http.StatusUnauthorized},
+		{name: "not a bearer token", token: "s3cret", authorization: "s3cret", want: http.StatusUnauthorized},
+		{name: "admin api disabled", token: "", authorization: "Bearer ", want: http.StatusForbidden},
+		{name: "valid token", token: "s3cret", authorization: "Bearer s3cret", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crawler := &fakeCrawler{}
+			mux := http.NewServeMux()
+			NewServer(config.Default().Server, disk, nil, crawler, tt.token).register(mux)
+			for _, endpoint := range endpoints {
+				req := httptest.NewRequest(http.MethodGet, endpoint, nil)
+				if tt.authorization != "" {
+					req.Header.Set("Authorization", tt.authorization)
+				}
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+				if rec.Code != tt.want {
+					t.Errorf("%s answered %d, want %d: %s", endpoint, rec.Code, tt.want, rec.Body)
+				}
+				if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("%s didnt ask for a bearer token", endpoint)
+				}
+			}
+			if reached := crawler.calls > 0; reached != (tt.want == http.StatusOK) {
+				t.Errorf("the crawler was called %d times", crawler.calls)
+			}
+		})
+	}
+}
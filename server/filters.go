@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	db "lite/DB"
+)
+
+const defaultRadiusKm = 10.0
+
+// parseEventFilter reads the filters shared by /events and /search:
+// tag, mode (online, in_person, hybrid), from and to (YYYY-MM-DD or RFC3339), lat, lng with an optional radius in km
+// and duplicates=true to bring back the listings the dedup pass hid
+func parseEventFilter(values url.Values) (db.EventFilter, error) {
+	filter := db.EventFilter{Tag: values.Get("tag")}
+	switch mode := values.Get("mode"); mode {
+	case "", "online", "in_person", "hybrid":
+		filter.Mode = mode
+	default:
+		return filter, fmt.Errorf("invalid mode %q, expected online, in_person or hybrid", mode)
+	}
+	if duplicates := values.Get("duplicates"); duplicates != "" {
+		include, err := strconv.ParseBool(duplicates)
+		if err != nil {
+			return filter, fmt.Errorf("invalid duplicates %q", duplicates)
+		}
+		filter.IncludeDuplicates = include
+	}
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		raw := values.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, err := parseFilterTime(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %w", bound.name, err)
+		}
+		*bound.dest = &t
+	}
+
+	lat, long := values.Get("lat"), values.Get("lng")
+	if lat == "" && long == "" {
+		return filter, nil
+	}
+	if lat == "" || long == "" {
+		return filter, fmt.Errorf("lat and lng must be passed together")
+	}
+	var err error
+	if filter.Lat, err = strconv.ParseFloat(lat, 64); err != nil || filter.Lat < -90 || filter.Lat > 90 {
+		return filter, fmt.Errorf("invalid lat %q", lat)
+	}
+	if filter.Long, err = strconv.ParseFloat(long, 64); err != nil || filter.Long < -180 || filter.Long > 180 {
+		return filter, fmt.Errorf("invalid lng %q", long)
+	}
+	filter.RadiusKm = defaultRadiusKm
+	if radius := values.Get("radius"); radius != "" {
+		if filter.RadiusKm, err = strconv.ParseFloat(radius, 64); err != nil || filter.RadiusKm <= 0 {
+			return filter, fmt.Errorf("invalid radius %q", radius)
+		}
+	}
+	filter.Near = true
+	return filter, nil
+}
+
+func parseFilterTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
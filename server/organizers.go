@@ -0,0 +1,14 @@
+package server
+
+import (
+	"net/http"
+)
+
+func (s *Server) organizers(w http.ResponseWriter, req *http.Request) {
+	listPage(w, req, "organizers", s.disk.GetOrganizers)
+}
+
+// organizerEvents serves GET /organizers/{id}/events
+func (s *Server) organizerEvents(w http.ResponseWriter, req *http.Request) {
+	eventsOf(w, req, "organizer", "/organizers/", s.disk.GetOrganizer, s.disk.EventsByOrganizer)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	db "lite/DB"
+)
+
+// resourceID pulls the id out of paths shaped like /<prefix>/{id}/<suffix>
+func resourceID(path, prefix, suffix string) (int, error) {
+	rest := strings.TrimPrefix(path, prefix)
+	rest = strings.TrimSuffix(strings.TrimSuffix(rest, "/"), suffix)
+	rest = strings.Trim(rest, "/")
+	id, err := strconv.Atoi(rest)
+	if err != nil || id <= 0 {
+		return -1, fmt.Errorf("invalid id %q", rest)
+	}
+	return id, nil
+}
+
+// listPage serves a page of what list returns, offset and limit come from the query. name is what the
+// list holds, for the error messages
+func listPage[T any](w http.ResponseWriter, req *http.Request, name string, list func(offset, limit uint) ([]T, error)) {
+	queryParams := req.URL.Query()
+	cleanOffset, cleanLimit, err := handleAndClean(queryParams.Get("offset"), queryParams.Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid offset or limit passed in request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	items, err := list(uint(cleanOffset), uint(cleanLimit))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Database Operation to fetch %s has failed: %s", name, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventResponse{
+		Total:   len(items),
+		Payload: items,
+	})
+}
+
+// eventsOf serves GET <prefix>{id}/events, a page of the events of one venue, organizer and the like.
+// exists looks the owner up so an unknown id is a 404 and not an empty list
+func eventsOf[T any](w http.ResponseWriter, req *http.Request, name, prefix string, exists func(id int) (T, error),
+	events func(id int, offset, limit uint) ([]db.Event, error)) {
+	if !strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/"), "/events") {
+		http.NotFound(w, req)
+		return
+	}
+	id, err := resourceID(req.URL.Path, prefix, "/events")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := exists(id); err != nil {
+		http.Error(w, fmt.Sprintf("%s %d not found", name, id), http.StatusNotFound)
+		return
+	}
+	listPage(w, req, name+" events", func(offset, limit uint) ([]db.Event, error) {
+		return events(id, offset, limit)
+	})
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	db "lite/DB"
+)
+
+// search serves GET /search?q= with the same filters as /events, best match first
+func (s *Server) search(w http.ResponseWriter, req *http.Request) {
+	queryParams := req.URL.Query()
+	text := queryParams.Get("q")
+	if text == "" {
+		http.Error(w, "missing search query q", http.StatusBadRequest)
+		return
+	}
+	cleanOffset, cleanLimit, err := handleAndClean(queryParams.Get("offset"), queryParams.Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid offset or limit passed in request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseEventFilter(queryParams)
+	if err != nil {
+		http.Error(w, "Invalid filter passed in request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	results, err := s.disk.Search(text, filter, uint(cleanOffset), uint(cleanLimit))
+	if errors.Is(err, db.ErrSearchUnavailable) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database Operation to search events has failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventResponse{
+		Total:   len(results),
+		Payload: results,
+	})
+}
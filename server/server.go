@@ -3,15 +3,24 @@ package server
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 
 	db "lite/DB"
+	"lite/config"
+	"lite/logging"
+	"lite/scheduler"
 )
 
+var logger = logging.For(logging.Server)
+
 type Server struct {
-	disk *db.Queries
+	addr      string
+	disk      *db.Queries
+	scheduler *scheduler.Scheduler
+	crawler   Crawler
+	// bearer token every /admin request has to carry, the admin api is off without one
+	adminToken string
 }
 
 var (
@@ -53,9 +62,15 @@ func (s *Server) events(w http.ResponseWriter, req *http.Request) {
 		http.Error(w, "Invalid offset or limit passed in request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	events, err := s.disk.GetAllEvents(uint(cleanOffset), uint(cleanLimit))
+	filter, err := parseEventFilter(queryParams)
+	if err != nil {
+		http.Error(w, "Invalid filter passed in request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	events, err := s.disk.FindEvents(filter, uint(cleanOffset), uint(cleanLimit))
 	if err != nil {
 		http.Error(w, "Database Operation to fetch events has failed: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -67,6 +82,27 @@ func (s *Server) events(w http.ResponseWriter, req *http.Request) {
 
 	// rest of this is just  a simple databse call
 }
+
+// tags serves the tag counts used to build the filter ui, most used first
+func (s *Server) tags(w http.ResponseWriter, req *http.Request) {
+	queryParams := req.URL.Query()
+	cleanOffset, cleanLimit, err := handleAndClean(queryParams.Get("offset"), queryParams.Get("limit"))
+	if err != nil {
+		http.Error(w, "Invalid offset or limit passed in request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	counts, err := s.disk.TagCounts(uint(cleanOffset), uint(cleanLimit))
+	if err != nil {
+		http.Error(w, "Database Operation to fetch tags has failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventResponse{
+		Total:   len(counts),
+		Payload: counts,
+	})
+}
+
 func (s *Server) eventLocation(w http.ResponseWriter, req *http.Request) {
 
 	queryParams := req.URL.Query()
@@ -94,14 +130,16 @@ func (s *Server) eventLocation(w http.ResponseWriter, req *http.Request) {
 }
 
 func (s *Server) Start() error {
-	http.HandleFunc("/life", s.life)
-	http.HandleFunc("/events", s.events)
-	http.HandleFunc("/eventLocation", s.eventLocation)
+	// a mux of our own, the metrics server serves the default one on its port and the admin endpoints
+	// mustnt show up there
+	mux := http.NewServeMux()
+	s.register(mux)
 
 	// Run the server in a goroutine
+	logger.Info("serving the api", "addr", s.addr)
 	go func() {
-		if err := http.ListenAndServe(":8080", nil); err != nil {
-			log.Fatalf("HTTP server failed: %v", err)
+		if err := http.ListenAndServe(s.addr, mux); err != nil {
+			logging.Fatal(logger, "http server failed", "err", err)
 		}
 	}()
 
@@ -109,9 +147,36 @@ func (s *Server) Start() error {
 	select {}
 }
 
-func NewServer() *Server {
+// register puts every endpoint on mux
+func (s *Server) register(mux *http.ServeMux) {
+	mux.HandleFunc("/life", s.life)
+	mux.HandleFunc("/events", s.events)
+	mux.HandleFunc("/eventLocation", s.eventLocation)
+	mux.HandleFunc("/venues", s.venues)
+	mux.HandleFunc("/venues/", s.venueEvents)
+	mux.HandleFunc("/organizers", s.organizers)
+	mux.HandleFunc("/organizers/", s.organizerEvents)
+	mux.HandleFunc("/tags", s.tags)
+	mux.HandleFunc("/search", s.search)
+	mux.HandleFunc("/admin/schedule", s.admin(s.schedule))
+	mux.HandleFunc("/admin/runs", s.admin(s.runs))
+	mux.HandleFunc("/admin/runs/", s.admin(s.run))
+	mux.HandleFunc("/admin/crawl", s.admin(s.crawl))
+	mux.HandleFunc("/admin/crawl/", s.admin(s.crawlControl))
+	mux.HandleFunc("/admin/inspect", s.admin(s.inspect))
+	mux.HandleFunc("/admin/log-levels", s.admin(s.logLevels))
+}
+
+// NewServer serves the scraped data in disk, and under /admin the state of schedule and control over
+// crawler when they arent nil. The admin endpoints need adminToken, the ADMIN_TOKEN secret, and are
+// disabled without it
+func NewServer(cfg config.ServerConfig, disk *db.Queries, schedule *scheduler.Scheduler, crawler Crawler, adminToken string) *Server {
 	return &Server{
-		disk: db.NewQuery(),
+		addr:       cfg.Addr,
+		disk:       disk,
+		scheduler:  schedule,
+		crawler:    crawler,
+		adminToken: adminToken,
 	}
 }
 
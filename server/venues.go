@@ -0,0 +1,14 @@
+package server
+
+import (
+	"net/http"
+)
+
+func (s *Server) venues(w http.ResponseWriter, req *http.Request) {
+	listPage(w, req, "venues", s.disk.GetVenues)
+}
+
+// venueEvents serves GET /venues/{id}/events
+func (s *Server) venueEvents(w http.ResponseWriter, req *http.Request) {
+	eventsOf(w, req, "venue", "/venues/", s.disk.GetVenue, s.disk.EventsByVenue)
+}